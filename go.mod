@@ -1,12 +1,17 @@
 module github.com/oxia-db/oxia-client-golang
 
-
 go 1.25.2
 
 require (
-	go.uber.org/multierr v1.11.0
-	github.com/stretchr/testify v1.10.0
 	github.com/cenkalti/backoff/v4 v4.3.0
-		google.golang.org/grpc v1.72.0
-    	google.golang.org/protobuf v1.36.6
-)
\ No newline at end of file
+	github.com/stretchr/testify v1.10.0
+	go.uber.org/multierr v1.11.0
+	google.golang.org/grpc v1.72.0
+	google.golang.org/protobuf v1.36.6
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -29,14 +29,17 @@ type BatcherFactory struct {
 	Executor       internal.Executor
 	RequestTimeout time.Duration
 	Metrics        *metrics.Metrics
+	Retrier        *internal.Retrier
 }
 
 func NewBatcherFactory(
 	executor internal.Executor,
 	namespace string,
 	batchLinger time.Duration,
+	adaptiveLinger bool,
 	maxRequestsPerBatch int,
 	metric *metrics.Metrics,
+	retrier *internal.Retrier,
 	requestTimeout time.Duration) *BatcherFactory {
 	return &BatcherFactory{
 		Namespace: namespace,
@@ -44,26 +47,49 @@ func NewBatcherFactory(
 		BatcherFactory: batch.BatcherFactory{
 			Linger:              batchLinger,
 			MaxRequestsPerBatch: maxRequestsPerBatch,
+			AdaptiveLinger:      adaptiveLinger,
 		},
 		Metrics:        metric,
+		Retrier:        retrier,
 		RequestTimeout: requestTimeout,
 	}
 }
 
-func (b *BatcherFactory) NewWriteBatcher(ctx context.Context, shardId *int64, maxWriteBatchSize int) batch.Batcher {
-	return b.newBatcher(ctx, shardId, "write", writeBatchFactory{
+// NewWriteBatcher creates a batcher for the writes of a shard, that keeps up to
+// `maxBatchesInFlight` batches in flight at once. If `coalesceWrites` is set,
+// the unconditional writes of the same key in a batch are collapsed into the
+// last one.
+func (b *BatcherFactory) NewWriteBatcher(ctx context.Context, shardId *int64, maxWriteBatchSize int,
+	coalesceWrites bool, maxBatchesInFlight int) batch.Batcher {
+	factory := writeBatchFactory{
+		namespace:      b.Namespace,
 		execute:        b.Executor.ExecuteWrite,
 		metrics:        b.Metrics,
+		retrier:        b.Retrier,
 		requestTimeout: b.RequestTimeout,
 		maxByteSize:    maxWriteBatchSize,
-	}.newBatch)
+		coalesce:       coalesceWrites,
+	}
+	return b.NewPipelinedBatcher(ctx, *shardId, "write", maxBatchesInFlight, func() batch.Batch {
+		return factory.newBatch(shardId)
+	})
 }
 
-func (b *BatcherFactory) NewReadBatcher(ctx context.Context, shardId *int64) batch.Batcher {
+// NewReadBatcher creates a batcher for the gets of a shard. The batches are
+// limited to `maxReadBatchSize` bytes, based on an estimate of the size of the
+// responses. If `streamResponses` is set, each get is completed as soon as its
+// response is received.
+func (b *BatcherFactory) NewReadBatcher(ctx context.Context, shardId *int64, maxReadBatchSize int,
+	streamResponses bool) batch.Batcher {
 	return b.newBatcher(ctx, shardId, "read", readBatchFactory{
-		execute:        b.Executor.ExecuteRead,
-		metrics:        b.Metrics,
-		requestTimeout: b.RequestTimeout,
+		namespace:       b.Namespace,
+		execute:         b.Executor.ExecuteRead,
+		metrics:         b.Metrics,
+		retrier:         b.Retrier,
+		requestTimeout:  b.RequestTimeout,
+		maxByteSize:     maxReadBatchSize,
+		streamResponses: streamResponses,
+		valueSizes:      newValueSizeEstimator(),
 	}.newBatch)
 }
 
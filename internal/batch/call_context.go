@@ -0,0 +1,53 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch
+
+import (
+	"context"
+	"time"
+
+	"github.com/oxia-db/oxia-client-golang/internal/model"
+)
+
+// Removes the calls whose context is already done, failing them with the
+// error of their context.
+func dropDoneCalls[CALL any](calls []CALL, getContext func(CALL) context.Context, fail func(CALL, error)) []CALL {
+	kept := calls[:0]
+	for _, call := range calls {
+		if err := model.ContextErr(getContext(call)); err != nil {
+			fail(call, err)
+			continue
+		}
+		kept = append(kept, call)
+	}
+	return kept
+}
+
+// Returns the context of a batch request. It expires after the request
+// timeout, or at the earliest deadline of the calls in the batch, whichever
+// comes first.
+func newRequestContext(requestTimeout time.Duration, contexts []context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	deadline, ok := model.EarliestDeadline(contexts)
+	if !ok {
+		return ctx, cancel
+	}
+
+	ctx, cancelDeadline := context.WithDeadline(ctx, deadline)
+	return ctx, func() {
+		cancelDeadline()
+		cancel()
+	}
+}
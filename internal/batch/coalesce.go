@@ -0,0 +1,95 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch
+
+import (
+	"github.com/oxia-db/oxia-client-golang/internal/model"
+	"github.com/oxia-db/oxia-client-golang/proto"
+)
+
+// Collapses the unconditional puts, and the unconditional deletes, of the same
+// key into the last one, whose result is passed to all of them. Since the puts
+// of a request are applied before its deletes, this doesn't change the final
+// state. The keys that are also the target of a conditional put or delete, a
+// sequence, or an ephemeral record, are left alone.
+func (b *writeBatch) coalesceWrites() {
+	excluded := make(map[string]bool)
+	for _, put := range b.puts {
+		if put.ExpectedVersionId != nil || len(put.SequenceKeysDeltas) > 0 || put.SessionId != nil {
+			excluded[put.Key] = true
+		}
+	}
+	for _, _delete := range b.deletes {
+		if _delete.ExpectedVersionId != nil {
+			excluded[_delete.Key] = true
+		}
+	}
+
+	b.puts = coalesceCalls(b.puts, excluded,
+		func(c model.PutCall) string { return c.Key },
+		func(c model.PutCall) func(*proto.PutResponse, error) { return c.Callback },
+		func(c model.PutCall, callback func(*proto.PutResponse, error)) model.PutCall {
+			c.Callback = callback
+			return c
+		})
+	b.deletes = coalesceCalls(b.deletes, excluded,
+		func(c model.DeleteCall) string { return c.Key },
+		func(c model.DeleteCall) func(*proto.DeleteResponse, error) { return c.Callback },
+		func(c model.DeleteCall, callback func(*proto.DeleteResponse, error)) model.DeleteCall {
+			c.Callback = callback
+			return c
+		})
+}
+
+// Keeps only the last call of each key that is not excluded. Its callback also
+// completes the calls that were dropped.
+func coalesceCalls[CALL any, RES any](calls []CALL, excluded map[string]bool, getKey func(CALL) string,
+	getCallback func(CALL) func(RES, error), setCallback func(CALL, func(RES, error)) CALL) []CALL {
+	last := make(map[string]int)
+	for i, call := range calls {
+		if key := getKey(call); !excluded[key] {
+			last[key] = i
+		}
+	}
+
+	followers := make(map[int][]func(RES, error))
+	for i, call := range calls {
+		if j, ok := last[getKey(call)]; ok && j != i {
+			followers[j] = append(followers[j], getCallback(call))
+		}
+	}
+	if len(followers) == 0 {
+		return calls
+	}
+
+	kept := make([]CALL, 0, len(calls))
+	for i, call := range calls {
+		if j, ok := last[getKey(call)]; ok && j != i {
+			continue
+		}
+
+		if callbacks, ok := followers[i]; ok {
+			callback := getCallback(call)
+			call = setCallback(call, func(response RES, err error) {
+				callback(response, err)
+				for _, follower := range callbacks {
+					follower(response, err)
+				}
+			})
+		}
+		kept = append(kept, call)
+	}
+	return kept
+}
@@ -22,10 +22,15 @@ import (
 	"go.uber.org/multierr"
 )
 
-func NewManager(ctx context.Context, batcherFactory func(context.Context, *int64) batch.Batcher) *Manager {
+// NewManager creates a manager of the batchers of each shard. If a limiter is
+// passed, the batchers only accept the calls for which there's room among the
+// pending requests.
+func NewManager(ctx context.Context, batcherFactory func(context.Context, *int64) batch.Batcher,
+	limiter *PendingLimiter) *Manager {
 	return &Manager{
 		ctx:            ctx,
 		batcherFactory: batcherFactory,
+		limiter:        limiter,
 		batchers:       make(map[int64]batch.Batcher),
 	}
 }
@@ -34,6 +39,7 @@ type Manager struct {
 	sync.RWMutex
 	ctx            context.Context
 	batcherFactory func(context.Context, *int64) batch.Batcher
+	limiter        *PendingLimiter
 	batchers       map[int64]batch.Batcher
 }
 
@@ -52,11 +58,43 @@ func (m *Manager) Get(shardId int64) batch.Batcher {
 
 	if batcher, ok = m.batchers[shardId]; !ok {
 		batcher = m.batcherFactory(m.ctx, &shardId)
+		if m.limiter != nil {
+			batcher = &limitedBatcher{
+				Batcher: batcher,
+				ctx:     m.ctx,
+				shard:   shardId,
+				limiter: m.limiter,
+			}
+		}
 		m.batchers[shardId] = batcher
 	}
 	return batcher
 }
 
+// Flush waits until all the calls added so far to the batchers are completed.
+func (m *Manager) Flush(ctx context.Context) error {
+	m.RLock()
+	batchers := make([]batch.Batcher, 0, len(m.batchers))
+	for _, batcher := range m.batchers {
+		batchers = append(batchers, batcher)
+	}
+	m.RUnlock()
+
+	// The batchers are flushed in parallel, since each one only waits for its
+	// own calls
+	var wg sync.WaitGroup
+	errs := make([]error, len(batchers))
+	for i, batcher := range batchers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = batcher.Flush(ctx)
+		}()
+	}
+	wg.Wait()
+	return multierr.Combine(errs...)
+}
+
 func (m *Manager) Close() error {
 	m.Lock()
 	defer m.Unlock()
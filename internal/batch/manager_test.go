@@ -36,6 +36,8 @@ func (b *testBatcher) Close() error {
 
 func (b *testBatcher) Add(any) {}
 
+func (b *testBatcher) Flush(context.Context) error { return nil }
+
 func (b *testBatcher) Run() {}
 
 func TestManager(t *testing.T) {
@@ -47,7 +49,7 @@ func TestManager(t *testing.T) {
 		return testBatcher
 	}
 
-	manager := NewManager(context.Background(), batcherFactory)
+	manager := NewManager(context.Background(), batcherFactory, nil)
 
 	batcher := manager.Get(shardId)
 	assert.Equal(t, testBatcher, batcher)
@@ -0,0 +1,310 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/oxia-db/oxia/common/process"
+
+	"github.com/oxia-db/oxia-client-golang/internal/metrics"
+	"github.com/oxia-db/oxia-client-golang/internal/model"
+	"github.com/oxia-db/oxia-client-golang/pkg/batch"
+	"github.com/oxia-db/oxia-client-golang/proto"
+)
+
+var ErrBackpressure = errors.New("too many pending requests")
+
+// PendingLimiter limits the requests that were submitted to the batchers and
+// are not completed yet, either by number or by size.
+type PendingLimiter struct {
+	sync.Mutex
+
+	maxBytes    int64
+	maxRequests int64
+	failFast    bool
+	timeout     time.Duration
+	metrics     *metrics.PendingMetrics
+
+	bytes    int64
+	requests int64
+	shards   map[int64]*pendingLoad
+	// Closed, and replaced, every time some room is released
+	released chan struct{}
+}
+
+type pendingLoad struct {
+	requests int64
+	bytes    int64
+}
+
+// NewPendingLimiter creates a limiter for the pending requests. A limit of
+// zero means no limit. When there's no room for a request, the limiter waits
+// for it for up to `timeout`, unless `failFast` is set, in which case it fails
+// right away with ErrBackpressure.
+func NewPendingLimiter(maxBytes int64, maxRequests int, failFast bool, timeout time.Duration,
+	meterProvider metric.MeterProvider) *PendingLimiter {
+	l := &PendingLimiter{
+		maxBytes:    maxBytes,
+		maxRequests: int64(maxRequests),
+		failFast:    failFast,
+		timeout:     timeout,
+		shards:      make(map[int64]*pendingLoad),
+		released:    make(chan struct{}),
+	}
+	l.metrics = metrics.NewPendingMetrics(meterProvider, l.observe)
+	return l
+}
+
+// Acquire reserves room for a request of the given size to the shard. The
+// returned function releases it.
+func (l *PendingLimiter) Acquire(ctx context.Context, shard int64, size int64) (func(), error) {
+	var timeout <-chan time.Time
+	for {
+		release, released := l.tryAcquire(shard, size)
+		if release != nil {
+			return release, nil
+		}
+
+		if l.failFast {
+			return nil, ErrBackpressure
+		}
+
+		if timeout == nil {
+			timer := time.NewTimer(l.timeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-timeout:
+			return nil, errors.Wrap(ErrBackpressure, "timed out waiting for the pending requests to complete")
+		}
+	}
+}
+
+// Reserves room for the request if there's any. Otherwise, it returns the
+// channel that is closed when some room is released.
+func (l *PendingLimiter) tryAcquire(shard int64, size int64) (release func(), released chan struct{}) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.fits(size) {
+		l.add(shard, 1, size)
+		return sync.OnceFunc(func() { l.release(shard, size) }), nil
+	}
+	return nil, l.released
+}
+
+func (l *PendingLimiter) fits(size int64) bool {
+	if l.maxRequests > 0 && l.requests >= l.maxRequests {
+		return false
+	}
+	// A request larger than the limit is let through when nothing else is pending,
+	// otherwise it would never be sent
+	return l.maxBytes == 0 || l.requests == 0 || l.bytes+size <= l.maxBytes
+}
+
+func (l *PendingLimiter) add(shard int64, requests int64, size int64) {
+	load, ok := l.shards[shard]
+	if !ok {
+		load = &pendingLoad{}
+		l.shards[shard] = load
+	}
+	load.requests += requests
+	load.bytes += size
+	l.requests += requests
+	l.bytes += size
+}
+
+func (l *PendingLimiter) release(shard int64, size int64) {
+	l.Lock()
+	defer l.Unlock()
+
+	l.add(shard, -1, -size)
+	close(l.released)
+	l.released = make(chan struct{})
+}
+
+func (l *PendingLimiter) observe(report func(shard int64, requests int64, bytes int64)) {
+	l.Lock()
+	defer l.Unlock()
+
+	for shard, load := range l.shards {
+		report(shard, load.requests, load.bytes)
+	}
+}
+
+func (l *PendingLimiter) Close() error {
+	return l.metrics.Close()
+}
+
+// A batcher that only accepts the calls for which there's room among the
+// pending requests. The room is released when the call completes.
+//
+// Add never blocks: when the calls have to wait for some room, they're queued
+// and added in order, in the background, so that they can't be overtaken by
+// the later calls.
+type limitedBatcher struct {
+	batch.Batcher
+	sync.Mutex
+	ctx     context.Context
+	shard   int64
+	limiter *PendingLimiter
+
+	waiting []any
+}
+
+func (b *limitedBatcher) Add(call any) {
+	b.Lock()
+	if len(b.waiting) == 0 {
+		release, _ := b.limiter.tryAcquire(b.shard, int64(pendingSize(call)))
+		if release != nil {
+			b.Batcher.Add(withRelease(call, release))
+			b.Unlock()
+			return
+		}
+		if b.limiter.failFast {
+			b.Unlock()
+			failCall(call, ErrBackpressure)
+			return
+		}
+	}
+
+	b.waiting = append(b.waiting, call)
+	if len(b.waiting) == 1 {
+		go process.DoWithLabels(b.ctx, map[string]string{
+			"oxia":  "pending-limiter",
+			"shard": fmt.Sprintf("%d", b.shard),
+		}, b.addWaiting)
+	}
+	b.Unlock()
+}
+
+// Adds the queued calls as soon as there's room for them, until the queue is
+// empty.
+func (b *limitedBatcher) addWaiting() {
+	for {
+		b.Lock()
+		call := b.waiting[0]
+		b.Unlock()
+
+		ctx := b.ctx
+		if callCtx := callContext(call); callCtx != nil {
+			ctx = callCtx
+		}
+		release, err := b.limiter.Acquire(ctx, b.shard, int64(pendingSize(call)))
+
+		b.Lock()
+		b.waiting = b.waiting[1:]
+		if err == nil {
+			// Added with the lock held, so that the new calls are not added
+			// ahead of it
+			b.Batcher.Add(withRelease(call, release))
+		}
+		done := len(b.waiting) == 0
+		b.Unlock()
+
+		if err != nil {
+			failCall(call, err)
+		}
+		if done {
+			return
+		}
+	}
+}
+
+func pendingSize(call any) int {
+	if c, ok := call.(model.GetCall); ok {
+		return len(c.Key)
+	}
+	return getByteSize(call)
+}
+
+func callContext(call any) context.Context {
+	switch c := call.(type) {
+	case model.PutCall:
+		return c.Context
+	case model.DeleteCall:
+		return c.Context
+	case model.DeleteRangeCall:
+		return c.Context
+	case model.GetCall:
+		return c.Context
+	default:
+		panic("invalid call")
+	}
+}
+
+func failCall(call any, err error) {
+	switch c := call.(type) {
+	case model.PutCall:
+		c.Callback(nil, err)
+	case model.DeleteCall:
+		c.Callback(nil, err)
+	case model.DeleteRangeCall:
+		c.Callback(nil, err)
+	case model.GetCall:
+		c.Callback(nil, err)
+	default:
+		panic("invalid call")
+	}
+}
+
+// Returns a copy of the call that releases its room among the pending requests
+// before invoking the callback.
+func withRelease(call any, release func()) any {
+	switch c := call.(type) {
+	case model.PutCall:
+		callback := c.Callback
+		c.Callback = func(response *proto.PutResponse, err error) {
+			release()
+			callback(response, err)
+		}
+		return c
+	case model.DeleteCall:
+		callback := c.Callback
+		c.Callback = func(response *proto.DeleteResponse, err error) {
+			release()
+			callback(response, err)
+		}
+		return c
+	case model.DeleteRangeCall:
+		callback := c.Callback
+		c.Callback = func(response *proto.DeleteRangeResponse, err error) {
+			release()
+			callback(response, err)
+		}
+		return c
+	case model.GetCall:
+		callback := c.Callback
+		c.Callback = func(response *proto.GetResponse, err error) {
+			release()
+			callback(response, err)
+		}
+		return c
+	default:
+		panic("invalid call")
+	}
+}
@@ -0,0 +1,170 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/oxia-db/oxia-client-golang/internal/model"
+	"github.com/oxia-db/oxia-client-golang/pkg/batch"
+	"github.com/oxia-db/oxia-client-golang/proto"
+)
+
+func TestPendingLimiterFailFast(t *testing.T) {
+	limiter := NewPendingLimiter(0, 1, true, time.Minute, noop.NewMeterProvider())
+	defer limiter.Close()
+
+	release, err := limiter.Acquire(context.Background(), shardId, 1)
+	require.NoError(t, err)
+
+	_, err = limiter.Acquire(context.Background(), shardId, 1)
+	assert.ErrorIs(t, err, ErrBackpressure)
+
+	release()
+	// Releasing twice must not free more room
+	release()
+
+	_, err = limiter.Acquire(context.Background(), shardId, 1)
+	assert.NoError(t, err)
+	_, err = limiter.Acquire(context.Background(), shardId, 1)
+	assert.ErrorIs(t, err, ErrBackpressure)
+}
+
+func TestPendingLimiterBlock(t *testing.T) {
+	limiter := NewPendingLimiter(10, 0, false, time.Minute, noop.NewMeterProvider())
+	defer limiter.Close()
+
+	release, err := limiter.Acquire(context.Background(), shardId, 8)
+	require.NoError(t, err)
+
+	acquired := make(chan error, 1)
+	go func() {
+		_, err := limiter.Acquire(context.Background(), shardId, 5)
+		acquired <- err
+	}()
+
+	select {
+	case <-acquired:
+		assert.Fail(t, "acquired while the limit was reached")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	release()
+
+	select {
+	case err := <-acquired:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		assert.Fail(t, "not acquired after release")
+	}
+}
+
+func TestPendingLimiterTimeoutAndContext(t *testing.T) {
+	limiter := NewPendingLimiter(0, 1, false, 50*time.Millisecond, noop.NewMeterProvider())
+	defer limiter.Close()
+
+	_, err := limiter.Acquire(context.Background(), shardId, 1)
+	require.NoError(t, err)
+
+	_, err = limiter.Acquire(context.Background(), shardId, 1)
+	assert.ErrorIs(t, err, ErrBackpressure)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = limiter.Acquire(ctx, shardId, 1)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestPendingLimiterOversizedRequest(t *testing.T) {
+	limiter := NewPendingLimiter(10, 0, true, time.Minute, noop.NewMeterProvider())
+	defer limiter.Close()
+
+	// Let through when nothing else is pending
+	release, err := limiter.Acquire(context.Background(), shardId, 100)
+	require.NoError(t, err)
+
+	_, err = limiter.Acquire(context.Background(), shardId, 1)
+	assert.ErrorIs(t, err, ErrBackpressure)
+
+	release()
+	_, err = limiter.Acquire(context.Background(), shardId, 1)
+	assert.NoError(t, err)
+}
+
+// A batcher that records the calls added to it.
+type recordingBatcher struct {
+	batch.Batcher
+	added chan any
+}
+
+func (b *recordingBatcher) Add(call any) {
+	b.added <- call
+}
+
+func TestLimitedBatcher(t *testing.T) {
+	limiter := NewPendingLimiter(0, 1, false, time.Minute, noop.NewMeterProvider())
+	defer limiter.Close()
+
+	recording := &recordingBatcher{added: make(chan any, 10)}
+	batcher := &limitedBatcher{
+		Batcher: recording,
+		ctx:     context.Background(),
+		shard:   shardId,
+		limiter: limiter,
+	}
+
+	results := make(chan string, 10)
+	put := func(key string) model.PutCall {
+		return model.PutCall{Key: key, Callback: func(_ *proto.PutResponse, err error) {
+			results <- key
+		}}
+	}
+
+	// The calls that have to wait don't block the caller, and they're added
+	// in order once there's room for them
+	batcher.Add(put("a"))
+	batcher.Add(put("b"))
+	batcher.Add(put("c"))
+
+	added := (<-recording.added).(model.PutCall)
+	assert.Equal(t, "a", added.Key)
+	assert.Empty(t, recording.added)
+
+	added.Callback(nil, nil)
+	assert.Equal(t, "a", <-results)
+	added = (<-recording.added).(model.PutCall)
+	assert.Equal(t, "b", added.Key)
+
+	added.Callback(nil, nil)
+	assert.Equal(t, "b", <-results)
+	added = (<-recording.added).(model.PutCall)
+	assert.Equal(t, "c", added.Key)
+
+	// A waiting call fails once its context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	failed := make(chan error, 1)
+	batcher.Add(model.PutCall{Key: "d", Context: ctx, Callback: func(_ *proto.PutResponse, err error) {
+		failed <- err
+	}})
+	cancel()
+	assert.ErrorIs(t, <-failed, context.Canceled)
+	assert.Empty(t, recording.added)
+}
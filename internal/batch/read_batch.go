@@ -19,12 +19,12 @@ import (
 	"errors"
 	"io"
 	"log/slog"
+	"sync/atomic"
 	"time"
 
-	"github.com/cenkalti/backoff/v4"
+	"github.com/oxia-db/oxia-client-golang/internal"
 	"github.com/oxia-db/oxia-client-golang/internal/metrics"
 	"github.com/oxia-db/oxia-client-golang/internal/model"
-	"github.com/oxia-db/oxia-client-golang/internal/utils"
 	"github.com/oxia-db/oxia-client-golang/pkg/batch"
 	"github.com/oxia-db/oxia-client-golang/proto"
 )
@@ -33,19 +33,29 @@ type readBatchFactory struct {
 	namespace      string
 	execute        func(context.Context, *proto.ReadRequest) (proto.OxiaClient_ReadClient, error)
 	metrics        *metrics.Metrics
+	retrier        *internal.Retrier
 	requestTimeout time.Duration
+	maxByteSize    int
+	// Whether the gets are completed as soon as their response is received,
+	// rather than after the whole batch
+	streamResponses bool
+	valueSizes      *valueSizeEstimator
 }
 
 func (b readBatchFactory) newBatch(shardId *int64) batch.Batch {
 	return &readBatch{
-		namespace:      b.namespace,
-		shardId:        shardId,
-		execute:        b.execute,
-		gets:           make([]model.GetCall, 0),
-		start:          time.Now(),
-		metrics:        b.metrics,
-		callback:       b.metrics.ReadCallback(),
-		requestTimeout: b.requestTimeout,
+		namespace:       b.namespace,
+		shardId:         shardId,
+		execute:         b.execute,
+		gets:            make([]model.GetCall, 0),
+		start:           time.Now(),
+		metrics:         b.metrics,
+		retrier:         b.retrier,
+		callback:        b.metrics.ReadCallback(),
+		requestTimeout:  b.requestTimeout,
+		maxByteSize:     b.maxByteSize,
+		streamResponses: b.streamResponses,
+		valueSizes:      b.valueSizes,
 	}
 }
 
@@ -57,11 +67,22 @@ type readBatch struct {
 	start          time.Time
 	requestTimeout time.Duration
 	metrics        *metrics.Metrics
+	retrier        *internal.Retrier
 	callback       func(time.Time, *proto.ReadRequest, *proto.ReadResponse, error)
+	maxByteSize    int
+	// Estimated size of the responses of the gets in the batch
+	byteSize        int
+	streamResponses bool
+	valueSizes      *valueSizeEstimator
+	// Number of gets, from the start, whose callback was already invoked
+	completed int
 }
 
-func (*readBatch) CanAdd(_ any) bool {
-	return true
+func (b *readBatch) CanAdd(call any) bool {
+	if b.maxByteSize == 0 || b.Size() == 0 {
+		return true
+	}
+	return b.byteSize+b.estimateResponseSize(call) <= b.maxByteSize
 }
 
 func (b *readBatch) Add(call any) {
@@ -71,6 +92,21 @@ func (b *readBatch) Add(call any) {
 	default:
 		panic("invalid call")
 	}
+	b.byteSize += b.estimateResponseSize(call)
+}
+
+func (b *readBatch) estimateResponseSize(call any) int {
+	c, ok := call.(model.GetCall)
+	if !ok {
+		panic("invalid call")
+	}
+	// The key of the response may differ from the requested one, though it
+	// has a similar size
+	size := len(c.Key)
+	if c.IncludeValue && b.valueSizes != nil {
+		size += b.valueSizes.estimate()
+	}
+	return size
 }
 
 func (b *readBatch) Size() int {
@@ -78,9 +114,17 @@ func (b *readBatch) Size() int {
 }
 
 func (b *readBatch) Complete() {
+	// Drop the calls whose caller has already given up, before they're sent
+	b.gets = dropDoneCalls(b.gets,
+		func(c model.GetCall) context.Context { return c.Context },
+		func(c model.GetCall, err error) { c.Callback(nil, err) })
+	if b.Size() == 0 {
+		return
+	}
+
 	executionStart := time.Now()
 	request := b.toProto()
-	response, err := b.doRequestWithRetries(request)
+	response, err := b.doRequestWithRetries()
 	b.callback(executionStart, request, response, err)
 	if err != nil {
 		b.Fail(err)
@@ -89,19 +133,21 @@ func (b *readBatch) Complete() {
 	}
 }
 
-func (b *readBatch) doRequestWithRetries(request *proto.ReadRequest) (response *proto.ReadResponse, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), b.requestTimeout)
+func (b *readBatch) doRequestWithRetries() (response *proto.ReadResponse, err error) {
+	contexts := make([]context.Context, len(b.gets))
+	for i, get := range b.gets {
+		contexts[i] = get.Context
+	}
+	ctx, cancel := newRequestContext(b.requestTimeout, contexts)
 	defer cancel()
 
-	backOff := utils.NewBackOff(ctx)
+	operation := internal.RetryOperation{Type: internal.RetryOperationRead, Idempotent: true}
+	backOff := b.retrier.NewBackOff(ctx, operation)
 
-	err = backoff.RetryNotify(func() error {
-		response, err = b.doRequest(ctx, request)
-		if !isRetriable(err) {
-			return backoff.Permanent(err)
-		}
-		return err
-	}, backOff, func(err error, duration time.Duration) {
+	response = &proto.ReadResponse{}
+	err = b.retrier.RetryRequest(operation, *b.shardId, backOff, func() error {
+		return b.doRequest(ctx, response)
+	}, func(err error, duration time.Duration) {
 		slog.Debug(
 			"Failed to perform request, retrying later",
 			slog.Any("error", err),
@@ -114,36 +160,47 @@ func (b *readBatch) doRequestWithRetries(request *proto.ReadRequest) (response *
 	return response, err
 }
 
-func (b *readBatch) doRequest(ctx context.Context, request *proto.ReadRequest) (*proto.ReadResponse, error) {
+// Appends the received gets to the response. The gets that were received by a
+// previous attempt are not requested again.
+func (b *readBatch) doRequest(ctx context.Context, response *proto.ReadResponse) error {
+	request := b.toProto()
+	request.Gets = request.Gets[len(response.Gets):]
 	stream, err := b.execute(ctx, request)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	response := &proto.ReadResponse{}
-
 	for {
 		recv, err := stream.Recv()
 		if errors.Is(err, io.EOF) {
-			return response, nil
+			return nil
 		}
 		if err != nil {
-			return response, err
+			return err
 		}
 		response.Gets = append(response.Gets, recv.Gets...)
+		if b.valueSizes != nil {
+			b.valueSizes.update(recv.Gets)
+		}
+		if b.streamResponses {
+			b.handle(response)
+		}
 	}
 }
 
 func (b *readBatch) Fail(err error) {
-	for _, get := range b.gets {
+	for _, get := range b.gets[b.completed:] {
 		get.Callback(nil, err)
 	}
+	b.completed = len(b.gets)
 }
 
+// Completes the gets whose response was received and that are not completed yet.
 func (b *readBatch) handle(response *proto.ReadResponse) {
-	for i, get := range b.gets {
-		get.Callback(response.Gets[i], nil)
+	for i := b.completed; i < min(len(response.Gets), len(b.gets)); i++ {
+		b.gets[i].Callback(response.Gets[i], nil)
 	}
+	b.completed = min(len(response.Gets), len(b.gets))
 }
 
 func (b *readBatch) toProto() *proto.ReadRequest {
@@ -152,3 +209,33 @@ func (b *readBatch) toProto() *proto.ReadRequest {
 		Gets:  model.Convert[model.GetCall, *proto.GetRequest](b.gets, model.GetCall.ToProto),
 	}
 }
+
+// Initial estimate of the size of a value, until some gets are received.
+const initialValueSizeEstimate = 1024
+
+// Estimates the size of the values returned by the gets of a shard, with a
+// moving average of the previous responses.
+type valueSizeEstimator struct {
+	average atomic.Int64
+}
+
+func newValueSizeEstimator() *valueSizeEstimator {
+	e := &valueSizeEstimator{}
+	e.average.Store(initialValueSizeEstimate)
+	return e
+}
+
+func (e *valueSizeEstimator) estimate() int {
+	return int(e.average.Load())
+}
+
+func (e *valueSizeEstimator) update(gets []*proto.GetResponse) {
+	for _, get := range gets {
+		if get.Status != proto.Status_OK {
+			continue
+		}
+		average := e.average.Load()
+		// Each new value has a weight of 1/8 in the average
+		e.average.Store(average + (int64(len(get.Value))-average)/8)
+	}
+}
@@ -25,7 +25,9 @@ import (
 	"github.com/oxia-db/oxia-client-golang/internal/model"
 	"github.com/oxia-db/oxia-client-golang/proto"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 func TestReadBatchAdd(t *testing.T) {
@@ -41,6 +43,7 @@ func TestReadBatchAdd(t *testing.T) {
 	} {
 		factory := &readBatchFactory{
 			metrics: metrics.NewMetrics(noop.NewMeterProvider()),
+			retrier: testRetrier,
 		}
 		batch := factory.newBatch(&shardId)
 
@@ -104,6 +107,7 @@ func TestReadBatchComplete(t *testing.T) {
 		factory := &readBatchFactory{
 			execute: execute,
 			metrics: metrics.NewMetrics(noop.NewMeterProvider()),
+			retrier: testRetrier,
 		}
 		batch := factory.newBatch(&shardId)
 
@@ -133,6 +137,86 @@ func TestReadBatchComplete(t *testing.T) {
 	}
 }
 
+func TestReadBatchCanAdd(t *testing.T) {
+	factory := &readBatchFactory{
+		metrics:     metrics.NewMetrics(noop.NewMeterProvider()),
+		maxByteSize: 3000,
+		valueSizes:  newValueSizeEstimator(),
+	}
+	batch := factory.newBatch(&shardId)
+
+	// An empty batch always accepts a call
+	assert.True(t, batch.CanAdd(model.GetCall{Key: "a", IncludeValue: true}))
+	batch.Add(model.GetCall{Key: "a", IncludeValue: true})
+	batch.Add(model.GetCall{Key: "b", IncludeValue: true})
+
+	// The keys-only gets don't count the estimated value size
+	assert.False(t, batch.CanAdd(model.GetCall{Key: "c", IncludeValue: true}))
+	assert.True(t, batch.CanAdd(model.GetCall{Key: "c", IncludeValue: false}))
+
+	// The estimate follows the received values
+	factory.valueSizes.update([]*proto.GetResponse{{Status: proto.Status_OK, Value: make([]byte, 0)}})
+	assert.Less(t, factory.valueSizes.estimate(), initialValueSizeEstimate)
+}
+
+func TestReadBatchStreamResponses(t *testing.T) {
+	getA := &proto.GetResponse{Status: proto.Status_OK, Value: []byte("a")}
+	getB := &proto.GetResponse{Status: proto.Status_OK, Value: []byte("b")}
+
+	aCompleted := make(chan struct{})
+	attempts := 0
+	execute := func(ctx context.Context, request *proto.ReadRequest) (proto.OxiaClient_ReadClient, error) {
+		attempts++
+		if attempts == 1 {
+			assert.Len(t, request.Gets, 2)
+			ch := make(chan readResult, 2)
+			ch <- readResult{response: &proto.ReadResponse{Gets: []*proto.GetResponse{getA}}}
+			go func() {
+				// The stream fails only after the first get was completed
+				<-aCompleted
+				ch <- readResult{err: status.Error(codes.Unavailable, "unavailable")}
+			}()
+			return &testOxiaClientReadClient{ch: ch}, nil
+		}
+
+		// Only the get that was not received is requested again
+		assert.Equal(t, []*proto.GetRequest{{Key: "/b", IncludeValue: true}}, request.Gets)
+		return readClient([]*proto.ReadResponse{{Gets: []*proto.GetResponse{getB}}}), nil
+	}
+
+	factory := &readBatchFactory{
+		execute:         execute,
+		metrics:         metrics.NewMetrics(noop.NewMeterProvider()),
+		retrier:         testRetrier,
+		streamResponses: true,
+	}
+	batch := factory.newBatch(&shardId)
+
+	responses := map[string]*proto.GetResponse{}
+	batch.Add(model.GetCall{
+		Key:          "/a",
+		IncludeValue: true,
+		Callback: func(response *proto.GetResponse, err error) {
+			assert.NoError(t, err)
+			responses["/a"] = response
+			close(aCompleted)
+		},
+	})
+	batch.Add(model.GetCall{
+		Key:          "/b",
+		IncludeValue: true,
+		Callback: func(response *proto.GetResponse, err error) {
+			assert.NoError(t, err)
+			responses["/b"] = response
+		},
+	})
+
+	batch.Complete()
+
+	assert.Equal(t, 2, attempts)
+	assert.Equal(t, map[string]*proto.GetResponse{"/a": getA, "/b": getB}, responses)
+}
+
 type readResult struct {
 	response *proto.ReadResponse
 	err      error
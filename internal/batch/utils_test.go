@@ -20,6 +20,8 @@ var (
 	shardId = int64(1)
 	one     = int64(1)
 	two     = int64(2)
+
+	testRetrier = internal.NewRetrier(internal.NewDefaultRetryPolicy(), noop.NewMeterProvider())
 )
 
 func add(b batch.Batch, call any) (panicked bool) {
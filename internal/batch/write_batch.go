@@ -27,8 +27,11 @@ type writeBatchFactory struct {
 	namespace      string
 	execute        func(context.Context, *proto.WriteRequest) (*proto.WriteResponse, error)
 	metrics        *metrics.Metrics
+	retrier        *internal.Retrier
 	requestTimeout time.Duration
 	maxByteSize    int
+	// Whether the unconditional writes of the same key are collapsed
+	coalesce bool
 }
 
 func (b writeBatchFactory) newBatch(shardId *int64) batch.Batch {
@@ -41,9 +44,11 @@ func (b writeBatchFactory) newBatch(shardId *int64) batch.Batch {
 		deleteRanges:   make([]model.DeleteRangeCall, 0),
 		requestTimeout: b.requestTimeout,
 		metrics:        b.metrics,
+		retrier:        b.retrier,
 		callback:       b.metrics.WriteCallback(),
 		maxByteSize:    b.maxByteSize,
 		byteSize:       0,
+		coalesce:       b.coalesce,
 	}
 }
 
@@ -55,10 +60,12 @@ type writeBatch struct {
 	deletes        []model.DeleteCall
 	deleteRanges   []model.DeleteRangeCall
 	metrics        *metrics.Metrics
+	retrier        *internal.Retrier
 	requestTimeout time.Duration
 	callback       func(time.Time, *proto.WriteRequest, *proto.WriteResponse, error)
 	maxByteSize    int
 	byteSize       int
+	coalesce       bool
 }
 
 func (b *writeBatch) CanAdd(call any) bool {
@@ -84,10 +91,30 @@ func (b *writeBatch) Size() int {
 	return len(b.puts) + len(b.deletes) + len(b.deleteRanges)
 }
 
+// Keys returns the keys of the puts and deletes of the batch. A delete range can
+// affect any key.
+func (b *writeBatch) Keys() (keys []string, all bool) {
+	if len(b.deleteRanges) > 0 {
+		return nil, true
+	}
+	keys = make([]string, 0, len(b.puts)+len(b.deletes))
+	for _, put := range b.puts {
+		keys = append(keys, put.Key)
+	}
+	for _, _delete := range b.deletes {
+		keys = append(keys, _delete.Key)
+	}
+	return keys, false
+}
+
 func (b *writeBatch) Complete() {
+	b.dropDoneCalls()
 	if b.Size() == 0 {
 		return
 	}
+	if b.coalesce {
+		b.coalesceWrites()
+	}
 	executionStart := time.Now()
 	request := b.toProto()
 
@@ -103,18 +130,16 @@ func (b *writeBatch) Complete() {
 }
 
 func (b *writeBatch) doRequestWithRetries(request *proto.WriteRequest) (response *proto.WriteResponse, err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), b.requestTimeout)
+	ctx, cancel := newRequestContext(b.requestTimeout, b.contexts())
 	defer cancel()
 
-	backOff := time2.NewBackOff(ctx)
+	operation := internal.RetryOperation{Type: internal.RetryOperationWrite, Idempotent: internal.IsIdempotentWrite(request)}
+	backOff := b.retrier.NewBackOff(ctx, operation)
 
-	err = backoff.RetryNotify(func() error {
+	err = b.retrier.RetryRequest(operation, *b.shardId, backOff, func() error {
 		response, err = b.execute(ctx, request)
-		if !isRetriable(err) {
-			return backoff.Permanent(err)
-		}
 		return err
-	}, backOff, func(err error, duration time.Duration) {
+	}, func(err error, duration time.Duration) {
 		slog.Debug(
 			"Failed to perform request, retrying later",
 			slog.Any("error", err),
@@ -127,6 +152,33 @@ func (b *writeBatch) doRequestWithRetries(request *proto.WriteRequest) (response
 	return response, err
 }
 
+// Drops the calls whose caller has already given up, before they're sent.
+func (b *writeBatch) dropDoneCalls() {
+	b.puts = dropDoneCalls(b.puts,
+		func(c model.PutCall) context.Context { return c.Context },
+		func(c model.PutCall, err error) { c.Callback(nil, err) })
+	b.deletes = dropDoneCalls(b.deletes,
+		func(c model.DeleteCall) context.Context { return c.Context },
+		func(c model.DeleteCall, err error) { c.Callback(nil, err) })
+	b.deleteRanges = dropDoneCalls(b.deleteRanges,
+		func(c model.DeleteRangeCall) context.Context { return c.Context },
+		func(c model.DeleteRangeCall, err error) { c.Callback(nil, err) })
+}
+
+func (b *writeBatch) contexts() []context.Context {
+	contexts := make([]context.Context, 0, b.Size())
+	for _, put := range b.puts {
+		contexts = append(contexts, put.Context)
+	}
+	for _, _delete := range b.deletes {
+		contexts = append(contexts, _delete.Context)
+	}
+	for _, deleteRange := range b.deleteRanges {
+		contexts = append(contexts, deleteRange.Context)
+	}
+	return contexts
+}
+
 func (b *writeBatch) Fail(err error) {
 	for _, put := range b.puts {
 		put.Callback(nil, err)
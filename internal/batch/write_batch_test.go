@@ -20,6 +20,7 @@ import (
 	"reflect"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestWriteBatchAdd(t *testing.T) {
@@ -35,6 +36,7 @@ func TestWriteBatchAdd(t *testing.T) {
 	} {
 		factory := &writeBatchFactory{
 			metrics:     metrics.NewMetrics(noop.NewMeterProvider()),
+			retrier:     testRetrier,
 			maxByteSize: 1024,
 		}
 		batch := factory.newBatch(&shardId)
@@ -149,6 +151,7 @@ func TestWriteBatchComplete(t *testing.T) {
 		factory := &writeBatchFactory{
 			execute:     execute,
 			metrics:     metrics.NewMetrics(noop.NewMeterProvider()),
+			retrier:     testRetrier,
 			maxByteSize: 1024,
 		}
 		batch := factory.newBatch(&shardId)
@@ -225,6 +228,7 @@ func TestWriteBatchCanAdd(t *testing.T) {
 		t.Run(item.name, func(t *testing.T) {
 			factory := &writeBatchFactory{
 				metrics:     metrics.NewMetrics(noop.NewMeterProvider()),
+				retrier:     testRetrier,
 				maxByteSize: 100,
 			}
 			batch := factory.newBatch(&shardId)
@@ -242,3 +246,138 @@ func TestWriteBatchCanAdd(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteBatchKeys(t *testing.T) {
+	factory := &writeBatchFactory{
+		metrics:     metrics.NewMetrics(noop.NewMeterProvider()),
+		retrier:     testRetrier,
+		maxByteSize: 1024,
+	}
+	b := factory.newBatch(&shardId).(*writeBatch)
+	b.Add(model.PutCall{Key: "a"})
+	b.Add(model.DeleteCall{Key: "b"})
+
+	keys, all := b.Keys()
+	assert.Equal(t, []string{"a", "b"}, keys)
+	assert.False(t, all)
+
+	// A range of keys conflicts with any key
+	b.Add(model.DeleteRangeCall{MinKeyInclusive: "c", MaxKeyExclusive: "d"})
+	keys, all = b.Keys()
+	assert.Empty(t, keys)
+	assert.True(t, all)
+}
+
+func TestWriteBatchCallContext(t *testing.T) {
+	var requestDeadline time.Time
+	execute := func(ctx context.Context, request *proto.WriteRequest) (*proto.WriteResponse, error) {
+		requestDeadline, _ = ctx.Deadline()
+
+		// The call whose context is done was dropped
+		assert.Len(t, request.Puts, 1)
+		assert.Equal(t, "/b", request.Puts[0].Key)
+		return &proto.WriteResponse{
+			Puts: []*proto.PutResponse{{Status: proto.Status_OK}},
+		}, nil
+	}
+
+	factory := &writeBatchFactory{
+		execute:        execute,
+		metrics:        metrics.NewMetrics(noop.NewMeterProvider()),
+		retrier:        testRetrier,
+		requestTimeout: 30 * time.Second,
+		maxByteSize:    1024,
+	}
+	batch := factory.newBatch(&shardId)
+
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	deadline := time.Now().Add(10 * time.Second)
+	deadlineCtx, cancelDeadline := context.WithDeadline(context.Background(), deadline)
+	defer cancelDeadline()
+
+	var errA, errB error
+	batch.Add(model.PutCall{
+		Key:      "/a",
+		Context:  cancelledCtx,
+		Callback: func(_ *proto.PutResponse, err error) { errA = err },
+	})
+	batch.Add(model.PutCall{
+		Key:      "/b",
+		Context:  deadlineCtx,
+		Callback: func(_ *proto.PutResponse, err error) { errB = err },
+	})
+	batch.Complete()
+
+	assert.ErrorIs(t, errA, context.Canceled)
+	assert.NoError(t, errB)
+
+	// The request is bound by the earliest deadline of the calls
+	assert.Equal(t, deadline, requestDeadline)
+}
+
+func TestWriteBatchCoalesce(t *testing.T) {
+	version := int64(1)
+	execute := func(_ context.Context, request *proto.WriteRequest) (*proto.WriteResponse, error) {
+		// The conditional put leaves the writes of its key alone
+		assert.Equal(t, []*proto.PutRequest{
+			{Key: "/b", Value: []byte("b1")},
+			{Key: "/b", Value: []byte("b2"), ExpectedVersionId: &version},
+			{Key: "/a", Value: []byte("a3")},
+		}, request.Puts)
+		assert.Equal(t, []*proto.DeleteRequest{{Key: "/c"}}, request.Deletes)
+		return &proto.WriteResponse{
+			Puts: []*proto.PutResponse{
+				{Version: &proto.Version{VersionId: 10}},
+				{Version: &proto.Version{VersionId: 11}},
+				{Version: &proto.Version{VersionId: 12}},
+			},
+			Deletes: []*proto.DeleteResponse{{Status: proto.Status_OK}},
+		}, nil
+	}
+
+	factory := &writeBatchFactory{
+		execute:        execute,
+		metrics:        metrics.NewMetrics(noop.NewMeterProvider()),
+		retrier:        testRetrier,
+		requestTimeout: 30 * time.Second,
+		maxByteSize:    1024,
+		coalesce:       true,
+	}
+	batch := factory.newBatch(&shardId)
+
+	versions := map[string][]int64{}
+	put := func(key string, value string, expectedVersionId *int64) {
+		batch.Add(model.PutCall{
+			Key:               key,
+			Value:             []byte(value),
+			ExpectedVersionId: expectedVersionId,
+			Callback: func(response *proto.PutResponse, err error) {
+				assert.NoError(t, err)
+				versions[key] = append(versions[key], response.Version.VersionId)
+			},
+		})
+	}
+	deletes := 0
+	deleteCall := model.DeleteCall{
+		Key: "/c",
+		Callback: func(_ *proto.DeleteResponse, err error) {
+			assert.NoError(t, err)
+			deletes++
+		},
+	}
+
+	put("/a", "a1", nil)
+	put("/b", "b1", nil)
+	put("/a", "a2", nil)
+	put("/b", "b2", &version)
+	put("/a", "a3", nil)
+	batch.Add(deleteCall)
+	batch.Add(deleteCall)
+	batch.Complete()
+
+	// All the collapsed puts get the result of the last one
+	assert.Equal(t, []int64{12, 12, 12}, versions["/a"])
+	assert.Equal(t, []int64{10, 11}, versions["/b"])
+	assert.Equal(t, 2, deletes)
+}
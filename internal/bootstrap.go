@@ -0,0 +1,201 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	dnsScheme = "dns:///"
+	srvScheme = "srv:///"
+)
+
+var ErrInvalidServiceAddress = errors.New("oxia: invalid service address")
+
+type resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+type bootstrapTarget struct {
+	scheme  string
+	address string
+}
+
+// BootstrapEndpoints keeps track of the addresses used to bootstrap the client.
+//
+// The service address is a comma-separated list of targets, each of which can be:
+//   - a `host:port` address
+//   - a `dns:///host:port` target, which is passed as it is to gRPC, so that it's
+//     resolved to all the IP addresses of the host while the host name is still
+//     used for the TLS verification
+//   - a `srv:///name` target, resolved to the addresses of the DNS SRV records of the name
+//
+// The same endpoint is used for as long as it is healthy. When it fails, the next
+// one is picked, and once all of them have been tried, the targets are resolved again.
+type BootstrapEndpoints struct {
+	sync.Mutex
+
+	targets  []bootstrapTarget
+	resolver resolver
+	logger   *slog.Logger
+
+	addresses []string
+	current   int
+	healthy   map[string]bool
+}
+
+func NewBootstrapEndpoints(serviceAddress string) (*BootstrapEndpoints, error) {
+	return newBootstrapEndpoints(serviceAddress, net.DefaultResolver)
+}
+
+func newBootstrapEndpoints(serviceAddress string, r resolver) (*BootstrapEndpoints, error) {
+	b := &BootstrapEndpoints{
+		resolver: r,
+		healthy:  make(map[string]bool),
+		logger: slog.With(
+			slog.String("component", "bootstrap-endpoints"),
+		),
+	}
+
+	for _, entry := range strings.Split(serviceAddress, ",") {
+		target, err := parseBootstrapTarget(strings.TrimSpace(entry))
+		if err != nil {
+			return nil, err
+		}
+		b.targets = append(b.targets, target)
+	}
+	return b, nil
+}
+
+func parseBootstrapTarget(entry string) (bootstrapTarget, error) {
+	target := bootstrapTarget{address: entry}
+	for _, scheme := range []string{dnsScheme, srvScheme} {
+		if address, ok := strings.CutPrefix(entry, scheme); ok {
+			target = bootstrapTarget{scheme, address}
+			break
+		}
+	}
+
+	if target.address == "" {
+		return target, errors.Wrapf(ErrInvalidServiceAddress, "empty target in %q", entry)
+	}
+	if target.scheme == srvScheme {
+		return target, nil
+	}
+	if _, _, err := net.SplitHostPort(target.address); err != nil {
+		return target, errors.Wrapf(ErrInvalidServiceAddress, "%q: %v", entry, err)
+	}
+	return target, nil
+}
+
+// Next returns the endpoint to use for the next attempt.
+func (b *BootstrapEndpoints) Next(ctx context.Context) (string, error) {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.current >= len(b.addresses) {
+		if err := b.resolve(ctx); err != nil {
+			return "", err
+		}
+	}
+	return b.addresses[b.current], nil
+}
+
+// Healthy records that the endpoint was used successfully. Healthy endpoints
+// are preferred after the targets are resolved again.
+func (b *BootstrapEndpoints) Healthy(address string) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.healthy[address] = true
+}
+
+// Failed records that the endpoint has failed, so that the next attempt will
+// use a different one.
+func (b *BootstrapEndpoints) Failed(address string) {
+	b.Lock()
+	defer b.Unlock()
+
+	delete(b.healthy, address)
+	if b.current < len(b.addresses) && b.addresses[b.current] == address {
+		b.current++
+	}
+}
+
+func (b *BootstrapEndpoints) resolve(ctx context.Context) error {
+	var addresses []string
+	var errs error
+	seen := make(map[string]bool)
+	for _, target := range b.targets {
+		resolved, err := b.resolveTarget(ctx, target)
+		if err != nil {
+			b.logger.Warn(
+				"Failed to resolve bootstrap target",
+				slog.String("target", target.scheme+target.address),
+				slog.Any("error", err),
+			)
+			errs = err
+			continue
+		}
+		for _, address := range resolved {
+			if !seen[address] {
+				seen[address] = true
+				addresses = append(addresses, address)
+			}
+		}
+	}
+
+	if len(addresses) == 0 {
+		return errors.Wrap(errs, "oxia: failed to resolve any bootstrap address")
+	}
+
+	// Try the endpoints that have been healthy before first
+	sort.SliceStable(addresses, func(i, j int) bool {
+		return b.healthy[addresses[i]] && !b.healthy[addresses[j]]
+	})
+	b.addresses = addresses
+	b.current = 0
+	return nil
+}
+
+func (b *BootstrapEndpoints) resolveTarget(ctx context.Context, target bootstrapTarget) ([]string, error) {
+	switch target.scheme {
+	case dnsScheme:
+		return []string{target.scheme + target.address}, nil
+
+	case srvScheme:
+		_, records, err := b.resolver.LookupSRV(ctx, "", "", target.address)
+		if err != nil {
+			return nil, err
+		}
+		addresses := make([]string, len(records))
+		for i, record := range records {
+			addresses[i] = net.JoinHostPort(strings.TrimSuffix(record.Target, "."), strconv.Itoa(int(record.Port)))
+		}
+		return addresses, nil
+
+	default:
+		return []string{target.address}, nil
+	}
+}
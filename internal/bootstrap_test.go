@@ -0,0 +1,125 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeResolver struct {
+	srv map[string][]*net.SRV
+}
+
+func (r *fakeResolver) LookupSRV(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+	if records, ok := r.srv[name]; ok {
+		return name, records, nil
+	}
+	return "", nil, errors.New("name not found")
+}
+
+func TestParseBootstrapTarget(t *testing.T) {
+	for _, item := range []struct {
+		entry  string
+		target bootstrapTarget
+		err    bool
+	}{
+		{"localhost:6648", bootstrapTarget{"", "localhost:6648"}, false},
+		{"dns:///oxia:6648", bootstrapTarget{dnsScheme, "oxia:6648"}, false},
+		{"srv:///_oxia._tcp.example.com", bootstrapTarget{srvScheme, "_oxia._tcp.example.com"}, false},
+		{"", bootstrapTarget{}, true},
+		{"localhost", bootstrapTarget{}, true},
+		{"dns:///oxia", bootstrapTarget{}, true},
+		{"srv:///", bootstrapTarget{}, true},
+	} {
+		target, err := parseBootstrapTarget(item.entry)
+		if item.err {
+			assert.ErrorIs(t, err, ErrInvalidServiceAddress, item.entry)
+		} else {
+			assert.NoError(t, err, item.entry)
+			assert.Equal(t, item.target, target)
+		}
+	}
+
+	_, err := NewBootstrapEndpoints("a:1,,b:2")
+	assert.ErrorIs(t, err, ErrInvalidServiceAddress)
+}
+
+func TestBootstrapEndpoints_Failover(t *testing.T) {
+	r := &fakeResolver{
+		srv: map[string][]*net.SRV{
+			"_oxia._tcp.example.com": {
+				{Target: "oxia-0.example.com.", Port: 6648},
+				{Target: "a", Port: 1},
+			},
+		},
+	}
+	b, err := newBootstrapEndpoints("a:1, dns:///oxia:6648, srv:///_oxia._tcp.example.com, srv:///unknown", r)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	var tried []string
+	for i := 0; i < 3; i++ {
+		address, err := b.Next(ctx)
+		assert.NoError(t, err)
+		tried = append(tried, address)
+		b.Failed(address)
+	}
+	// Duplicates and unresolvable targets are skipped, while the DNS targets
+	// are kept as they are, for gRPC to resolve them
+	assert.Equal(t, []string{"a:1", "dns:///oxia:6648", "oxia-0.example.com:6648"}, tried)
+
+	// The endpoint is kept for as long as it doesn't fail
+	address, err := b.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "a:1", address)
+	b.Failed(address)
+
+	address, err = b.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "dns:///oxia:6648", address)
+	b.Failed(address)
+
+	address, err = b.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "oxia-0.example.com:6648", address)
+	b.Healthy(address)
+
+	address, err = b.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "oxia-0.example.com:6648", address)
+
+	// Healthy endpoints are tried first after resolving the targets again
+	b.Failed("oxia-0.example.com:6648")
+	b.Healthy("dns:///oxia:6648")
+	b.Failed("dns:///oxia:6648")
+	b.Healthy("dns:///oxia:6648")
+
+	address, err = b.Next(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "dns:///oxia:6648", address)
+}
+
+func TestBootstrapEndpoints_NothingResolved(t *testing.T) {
+	b, err := newBootstrapEndpoints("srv:///unknown", &fakeResolver{})
+	assert.NoError(t, err)
+
+	_, err = b.Next(context.Background())
+	assert.Error(t, err)
+}
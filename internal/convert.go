@@ -15,26 +15,36 @@
 package internal
 
 import (
+	"github.com/pkg/errors"
+
 	"github.com/oxia-db/oxia/proto"
 )
 
-func toShard(assignment *proto.ShardAssignment) Shard {
+var ErrUnknownShardBoundaries = errors.New("oxia: unknown shard boundaries")
+
+func toShard(assignment *proto.ShardAssignment) (Shard, error) {
+	hr, err := toHashRange(assignment)
+	if err != nil {
+		return Shard{}, err
+	}
+
 	return Shard{
 		Id:        assignment.Shard,
 		Leader:    assignment.Leader,
-		HashRange: toHashRange(assignment),
-	}
+		HashRange: hr,
+	}, nil
 }
 
-func toHashRange(assignment *proto.ShardAssignment) HashRange {
+func toHashRange(assignment *proto.ShardAssignment) (HashRange, error) {
 	switch boundaries := assignment.ShardBoundaries.(type) {
 	case *proto.ShardAssignment_Int32HashRange:
 		return HashRange{
 			MinInclusive: boundaries.Int32HashRange.MinHashInclusive,
 			MaxInclusive: boundaries.Int32HashRange.MaxHashInclusive,
-		}
+		}, nil
 	default:
-		panic("unknown shard boundary")
+		return HashRange{}, errors.Wrapf(ErrUnknownShardBoundaries, "shard %d has boundaries of type %T",
+			assignment.Shard, boundaries)
 	}
 }
 
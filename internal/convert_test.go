@@ -43,8 +43,14 @@ func TestToShard(t *testing.T) {
 				Leader:    "leader:1234",
 				HashRange: hashRange(1, 2),
 			}, nil},
+		{
+			&proto.ShardAssignment{
+				Shard:  2,
+				Leader: "leader:1234",
+			}, Shard{}, ErrUnknownShardBoundaries},
 	} {
-		result := toShard(item.assignment)
+		result, err := toShard(item.assignment)
+		assert.ErrorIs(t, err, item.err)
 		assert.Equal(t, item.shard, result)
 	}
 }
@@ -17,9 +17,15 @@ package internal
 import (
 	"context"
 	"fmt"
+	"io"
+	"log/slog"
 	"sync"
 
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 
 	"github.com/oxia-db/oxia/common/constant"
 	"github.com/oxia-db/oxia/common/rpc"
@@ -27,6 +33,10 @@ import (
 	"github.com/oxia-db/oxia/proto"
 )
 
+// The number of times an idempotent write is sent again, on a new stream, when
+// the stream it was sent on fails.
+const maxWriteStreamFailures = 3
+
 type Executor interface {
 	ExecuteWrite(ctx context.Context, request *proto.WriteRequest) (*proto.WriteResponse, error)
 	ExecuteRead(ctx context.Context, request *proto.ReadRequest) (proto.OxiaClient_ReadClient, error)
@@ -37,109 +47,300 @@ type Executor interface {
 type executorImpl struct {
 	sync.RWMutex
 
-	ClientPool     rpc.ClientPool
-	ShardManager   ShardManager
-	ServiceAddress string
+	ClientPool   rpc.ClientPool
+	ShardManager ShardManager
+	Bootstrap    *BootstrapEndpoints
 
-	writeStreams map[int64]*streamWrapper
+	// The write streams of each shard. A slot is nil until its stream is
+	// first needed.
+	writeStreams         map[int64][]*streamWrapper
+	writeStreamsPerShard int
 
 	ctx       context.Context
 	namespace string
 }
 
-func NewExecutor(ctx context.Context, namespace string, pool rpc.ClientPool, manager ShardManager, serviceAddress string) Executor {
+// NewExecutor creates an executor that sends the writes of each shard over up
+// to `writeStreamsPerShard` parallel streams.
+func NewExecutor(ctx context.Context, namespace string, pool rpc.ClientPool, manager ShardManager,
+	bootstrap *BootstrapEndpoints, writeStreamsPerShard int) Executor {
 	e := &executorImpl{
-		ctx:            ctx,
-		namespace:      namespace,
-		ClientPool:     pool,
-		ShardManager:   manager,
-		ServiceAddress: serviceAddress,
-		writeStreams:   make(map[int64]*streamWrapper),
+		ctx:                  ctx,
+		namespace:            namespace,
+		ClientPool:           pool,
+		ShardManager:         manager,
+		Bootstrap:            bootstrap,
+		writeStreams:         make(map[int64][]*streamWrapper),
+		writeStreamsPerShard: max(writeStreamsPerShard, 1),
 	}
 
 	return e
 }
 
 func (e *executorImpl) ExecuteWrite(ctx context.Context, request *proto.WriteRequest) (*proto.WriteResponse, error) {
-	sw, err := e.writeStream(request.Shard) //nolint:contextcheck
-	if err != nil {
-		return nil, err
-	}
+	idempotent := IsIdempotentWrite(request)
+	for failures := 0; ; failures++ {
+		sw, err := e.writeStream(request.Shard) //nolint:contextcheck
+		if err != nil {
+			return nil, err
+		}
 
-	return sw.Send(ctx, request)
+		response, err := sw.Send(ctx, request)
+		switch {
+		case err == nil:
+			return response, nil
+
+		case status.Code(err) == constant.CodeNodeIsNotLeader:
+			// All the streams of the shard are connected to the stale leader
+			e.closeWriteStreams(*request.Shard)
+			e.onNotLeader()
+			return nil, err
+
+		case isWriteStreamFailure(err) && idempotent && failures < maxWriteStreamFailures &&
+			ctx.Err() == nil && e.ctx.Err() == nil:
+			// The stream has failed, possibly before the request was processed
+			slog.Debug(
+				"Write stream failed, sending the request again on a new stream",
+				slog.String("namespace", e.namespace),
+				slog.Int64("shard", *request.Shard),
+				slog.Any("error", err),
+			)
+
+		default:
+			return response, err
+		}
+	}
 }
 
 func (e *executorImpl) ExecuteRead(ctx context.Context, request *proto.ReadRequest) (proto.OxiaClient_ReadClient, error) {
-	client, err := e.rpc(request.Shard)
+	client, target, err := e.rpc(request.Shard)
 	if err != nil {
 		return nil, err
 	}
 
-	return client.Read(ctx, request)
+	stream, err := client.Read(ctx, request)
+	return newLeaderAwareStream(e, request.Shard, target, stream, err)
 }
 
 func (e *executorImpl) ExecuteList(ctx context.Context, request *proto.ListRequest) (proto.OxiaClient_ListClient, error) {
-	client, err := e.rpc(request.Shard)
+	client, target, err := e.rpc(request.Shard)
 	if err != nil {
 		return nil, err
 	}
 
-	return client.List(ctx, request)
+	stream, err := client.List(ctx, request)
+	return newLeaderAwareStream(e, request.Shard, target, stream, err)
 }
 
 func (e *executorImpl) ExecuteRangeScan(ctx context.Context, request *proto.RangeScanRequest) (proto.OxiaClient_RangeScanClient, error) {
-	client, err := e.rpc(request.Shard)
+	client, target, err := e.rpc(request.Shard)
 	if err != nil {
 		return nil, err
 	}
 
-	return client.RangeScan(ctx, request)
+	stream, err := client.RangeScan(ctx, request)
+	return newLeaderAwareStream(e, request.Shard, target, stream, err)
 }
 
-func (e *executorImpl) rpc(shardId *int64) (proto.OxiaClientClient, error) {
-	var target string
+// Reacts to a request that was rejected by a node that is not the leader of
+// the shard anymore, by refreshing the assignments without waiting for the
+// assignments stream to catch up.
+func (e *executorImpl) onNotLeader() {
+	e.ShardManager.Refresh()
+}
+
+// Returns the client of the leader of the shard or, for the requests that are
+// not bound to a shard, of the current bootstrap endpoint, along with its
+// address.
+func (e *executorImpl) rpc(shardId *int64) (client proto.OxiaClientClient, target string, err error) {
 	if shardId != nil {
-		target = e.ShardManager.Leader(*shardId)
+		target, err = e.ShardManager.Leader(*shardId)
 	} else {
-		target = e.ServiceAddress
+		target, err = e.Bootstrap.Next(e.ctx)
+	}
+	if err != nil {
+		return nil, "", err
 	}
 
-	client, err := e.ClientPool.GetClientRpc(target)
+	client, err = e.ClientPool.GetClientRpc(target)
 	if err != nil {
-		return nil, err
+		e.onRpcFailure(shardId, target, err)
+		return nil, "", err
 	}
-	return client, nil
+	return client, target, nil
 }
 
+// Moves on to the next bootstrap endpoint when the current one could not be
+// reached. The failures of the shard leaders are handled by the assignments
+// stream instead.
+func (e *executorImpl) onRpcFailure(shardId *int64, target string, err error) {
+	if shardId != nil {
+		return
+	}
+
+	slog.Debug(
+		"Bootstrap endpoint failed",
+		slog.String("namespace", e.namespace),
+		slog.String("endpoint", target),
+		slog.Any("error", err),
+	)
+	e.Bootstrap.Failed(target)
+}
+
+// Returns the least loaded write stream of the shard. A new stream is opened
+// when all the streams are busy and there's a free slot, or to replace a
+// failed stream.
 func (e *executorImpl) writeStream(shardId *int64) (*streamWrapper, error) {
 	e.RLock()
+	sw, slot := e.selectWriteStream(*shardId)
+	e.RUnlock()
 
-	sw, ok := e.writeStreams[*shardId]
-	if ok && !sw.failed.Load() {
-		e.RUnlock()
+	if slot < 0 {
 		return sw, nil
 	}
 
-	e.RUnlock()
+	sw, err := e.newWriteStream(shardId)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Lock()
+	defer e.Unlock()
+
+	streams, ok := e.writeStreams[*shardId]
+	if !ok {
+		streams = make([]*streamWrapper, e.writeStreamsPerShard)
+		e.writeStreams[*shardId] = streams
+	}
+	if previous := streams[slot]; previous != nil && !previous.failed.Load() {
+		// Some other request has filled the slot in the meantime
+		sw.Close()
+		return previous, nil
+	}
+	streams[slot] = sw
+	return sw, nil
+}
+
+// Selects an idle stream, or the slot where a new stream should be opened, or
+// the least loaded stream. Must be called with the lock held.
+func (e *executorImpl) selectWriteStream(shardId int64) (selected *streamWrapper, freeSlot int) {
+	streams := e.writeStreams[shardId]
+	freeSlot = -1
+	minPending := 0
+	for slot := 0; slot < e.writeStreamsPerShard; slot++ {
+		var sw *streamWrapper
+		if slot < len(streams) {
+			sw = streams[slot]
+		}
+
+		if sw == nil || sw.failed.Load() {
+			if freeSlot < 0 {
+				freeSlot = slot
+			}
+			continue
+		}
 
-	client, err := e.rpc(shardId)
+		pending := sw.Pending()
+		if selected == nil || pending < minPending {
+			selected, minPending = sw, pending
+		}
+	}
+
+	if selected != nil && (minPending == 0 || freeSlot < 0) {
+		return selected, -1
+	}
+	return nil, freeSlot
+}
+
+func (e *executorImpl) newWriteStream(shardId *int64) (*streamWrapper, error) {
+	client, _, err := e.rpc(shardId)
 	if err != nil {
 		return nil, err
 	}
 
 	ctx := metadata.AppendToOutgoingContext(e.ctx, constant.MetadataNamespace, e.namespace)
 	ctx = metadata.AppendToOutgoingContext(ctx, constant.MetadataShardId, fmt.Sprintf("%d", *shardId))
+	ctx, cancel := context.WithCancel(ctx)
 
 	stream, err := client.WriteStream(ctx)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
-	sw = newStreamWrapper(*shardId, stream)
+	return newStreamWrapper(*shardId, stream, cancel), nil
+}
 
+// Tears down the write streams that are connected to a stale leader, so that
+// the next requests will open new ones. Their pending requests are failed.
+func (e *executorImpl) closeWriteStreams(shardId int64) {
 	e.Lock()
-	defer e.Unlock()
+	streams := e.writeStreams[shardId]
+	delete(e.writeStreams, shardId)
+	e.Unlock()
 
-	e.writeStreams[*shardId] = sw
-	return sw, nil
+	for _, sw := range streams {
+		if sw != nil {
+			sw.Close()
+		}
+	}
+}
+
+// The errors of the requests that were pending on a stream that was closed, or
+// that broke, rather than rejected by the server.
+func isWriteStreamFailure(err error) bool {
+	return errors.Is(err, io.EOF) || status.Code(err) == codes.Canceled
+}
+
+// IsIdempotentWrite returns whether applying the request a second time, after
+// its response was lost, would have the same outcome. That's not the case for
+// the puts with sequence keys and the conditional puts and deletes.
+func IsIdempotentWrite(request *proto.WriteRequest) bool {
+	for _, put := range request.Puts {
+		if put.ExpectedVersionId != nil || len(put.SequenceKeyDelta) > 0 {
+			return false
+		}
+	}
+	for _, _delete := range request.Deletes {
+		if _delete.ExpectedVersionId != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// Wraps the server streams, to detect that the target node is not the leader
+// of the shard anymore, or that the bootstrap endpoint has failed.
+type leaderAwareStream[Res any] struct {
+	grpc.ServerStreamingClient[Res]
+	executor *executorImpl
+	shardId  *int64
+	target   string
+}
+
+func newLeaderAwareStream[Res any](e *executorImpl, shardId *int64, target string,
+	stream grpc.ServerStreamingClient[Res], err error) (grpc.ServerStreamingClient[Res], error) {
+	if err != nil {
+		e.onRpcFailure(shardId, target, err)
+		return stream, err
+	}
+	return &leaderAwareStream[Res]{
+		ServerStreamingClient: stream,
+		executor:              e,
+		shardId:               shardId,
+		target:                target,
+	}, nil
+}
+
+func (s *leaderAwareStream[Res]) Recv() (*Res, error) {
+	res, err := s.ServerStreamingClient.Recv()
+	if err != nil {
+		switch {
+		case s.shardId != nil && status.Code(err) == constant.CodeNodeIsNotLeader:
+			s.executor.onNotLeader()
+		case status.Code(err) == codes.Unavailable:
+			s.executor.onRpcFailure(s.shardId, s.target, err)
+		}
+	}
+	return res, err
 }
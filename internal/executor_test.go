@@ -0,0 +1,261 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/metric/noop"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/oxia-db/oxia/common/concurrent"
+	"github.com/oxia-db/oxia/common/constant"
+
+	"github.com/oxia-db/oxia-client-golang/internal/metrics"
+	"github.com/oxia-db/oxia/proto"
+)
+
+// A write stream where the first request is rejected with the given error.
+type rejectingWriteStream struct {
+	grpc.ClientStream
+	ctx  context.Context
+	sent chan struct{}
+	err  error
+}
+
+func (s *rejectingWriteStream) Send(*proto.WriteRequest) error {
+	close(s.sent)
+	return nil
+}
+
+func (s *rejectingWriteStream) Recv() (*proto.WriteResponse, error) {
+	select {
+	case <-s.sent:
+		return nil, s.err
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func (s *rejectingWriteStream) Context() context.Context {
+	return s.ctx
+}
+
+// A write stream that acknowledges every request.
+type ackWriteStream struct {
+	grpc.ClientStream
+	ctx  context.Context
+	acks chan *proto.WriteResponse
+}
+
+func (s *ackWriteStream) Send(*proto.WriteRequest) error {
+	s.acks <- &proto.WriteResponse{}
+	return nil
+}
+
+func (s *ackWriteStream) Recv() (*proto.WriteResponse, error) {
+	select {
+	case ack := <-s.acks:
+		return ack, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func (s *ackWriteStream) Context() context.Context {
+	return s.ctx
+}
+
+// A write stream that acknowledges the requests once they're released.
+type heldWriteStream struct {
+	grpc.ClientStream
+	ctx      context.Context
+	requests chan *proto.WriteRequest
+	release  chan struct{}
+}
+
+func (s *heldWriteStream) Send(request *proto.WriteRequest) error {
+	s.requests <- request
+	return nil
+}
+
+func (s *heldWriteStream) Recv() (*proto.WriteResponse, error) {
+	select {
+	case <-s.release:
+		return &proto.WriteResponse{}, nil
+	case <-s.ctx.Done():
+		return nil, s.ctx.Err()
+	}
+}
+
+func (s *heldWriteStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestExecutor_WritesInFlightOnDifferentStreams(t *testing.T) {
+	e := NewExecutor(context.Background(), constant.DefaultNamespace, nil, nil, nil, 2).(*executorImpl)
+
+	var streams []*heldWriteStream
+	for i := 0; i < 2; i++ {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		stream := &heldWriteStream{
+			ctx:      ctx,
+			requests: make(chan *proto.WriteRequest, 2),
+			release:  make(chan struct{}),
+		}
+		streams = append(streams, stream)
+		e.writeStreams[0] = append(e.writeStreams[0], newStreamWrapper(0, stream, cancel))
+	}
+	shardId := int64(0)
+
+	results := make(chan error, 2)
+	for i, key := range []string{"a", "b"} {
+		go func(key string) {
+			_, err := e.ExecuteWrite(context.Background(), &proto.WriteRequest{
+				Shard: &shardId,
+				Puts:  []*proto.PutRequest{{Key: key}},
+			})
+			results <- err
+		}(key)
+
+		// The second batch is sent on the idle stream, while the first one is
+		// still in flight
+		request := <-streams[i].requests
+		assert.Equal(t, key, request.Puts[0].Key)
+	}
+
+	for _, stream := range streams {
+		stream.release <- struct{}{}
+	}
+	assert.NoError(t, <-results)
+	assert.NoError(t, <-results)
+}
+
+func TestExecutor_WriteStreamFailure(t *testing.T) {
+	e := NewExecutor(context.Background(), constant.DefaultNamespace, nil, nil, nil, 2).(*executorImpl)
+
+	failingCtx, cancelFailing := context.WithCancel(context.Background())
+	defer cancelFailing()
+	failing := newStreamWrapper(0, &rejectingWriteStream{
+		ctx:  failingCtx,
+		sent: make(chan struct{}),
+		err:  io.EOF,
+	}, cancelFailing)
+
+	ackCtx, cancelAck := context.WithCancel(context.Background())
+	defer cancelAck()
+	ack := newStreamWrapper(0, &ackWriteStream{
+		ctx:  ackCtx,
+		acks: make(chan *proto.WriteResponse, 10),
+	}, cancelAck)
+
+	e.writeStreams[0] = []*streamWrapper{failing, ack}
+	shardId := int64(0)
+
+	// The idempotent request is sent again on the healthy stream
+	response, err := e.ExecuteWrite(context.Background(), &proto.WriteRequest{
+		Shard: &shardId,
+		Puts:  []*proto.PutRequest{{Key: "a"}},
+	})
+	assert.NoError(t, err)
+	assert.NotNil(t, response)
+	assert.True(t, failing.failed.Load())
+
+	// The failed stream is not selected anymore
+	sw, err := e.writeStream(&shardId)
+	assert.NoError(t, err)
+	assert.Equal(t, ack, sw)
+}
+
+func TestIsIdempotentWrite(t *testing.T) {
+	version := int64(1)
+	assert.True(t, IsIdempotentWrite(&proto.WriteRequest{
+		Puts:    []*proto.PutRequest{{Key: "a"}},
+		Deletes: []*proto.DeleteRequest{{Key: "b"}},
+	}))
+	assert.False(t, IsIdempotentWrite(&proto.WriteRequest{
+		Puts: []*proto.PutRequest{{Key: "a", ExpectedVersionId: &version}},
+	}))
+	assert.False(t, IsIdempotentWrite(&proto.WriteRequest{
+		Puts: []*proto.PutRequest{{Key: "a", SequenceKeyDelta: []uint64{1}}},
+	}))
+	assert.False(t, IsIdempotentWrite(&proto.WriteRequest{
+		Deletes: []*proto.DeleteRequest{{Key: "b", ExpectedVersionId: &version}},
+	}))
+}
+
+func TestExecutor_BootstrapEndpointFailure(t *testing.T) {
+	bootstrap, err := NewBootstrapEndpoints("a:1,b:2")
+	assert.NoError(t, err)
+	e := NewExecutor(context.Background(), constant.DefaultNamespace, nil, nil, bootstrap, 1).(*executorImpl)
+
+	target, err := bootstrap.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "a:1", target)
+
+	// A failed request that is not bound to a shard moves on to the next endpoint
+	_, err = newLeaderAwareStream[proto.ListResponse](e, nil, target, nil,
+		status.Error(codes.Unavailable, "connection refused"))
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+
+	target, err = bootstrap.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "b:2", target)
+}
+
+func TestExecutor_NotLeader(t *testing.T) {
+	sm := &shardManagerImpl{
+		shardStrategy: &testShardStrategy{},
+		shards:        make(map[int64]Shard),
+		listeners:     make(map[int64]func(ShardAssignmentsUpdate)),
+		updatedWg:     concurrent.NewWaitGroup(1),
+		logger:        slog.Default(),
+		metrics:       metrics.NewShardAssignmentsMetrics(noop.NewMeterProvider()),
+		ctx:           context.Background(),
+	}
+	sm.update(nil, []Shard{{Id: 0, Leader: "l1", HashRange: hashRange(0, 9)}})
+	assignmentsCtx, refresh := context.WithCancel(context.Background())
+	sm.refreshStream, sm.streamStarted = refresh, time.Now().Add(-minRefreshInterval)
+
+	e := NewExecutor(context.Background(), constant.DefaultNamespace, nil, sm, nil, 1).(*executorImpl)
+
+	streamCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream := &rejectingWriteStream{
+		ctx:  streamCtx,
+		sent: make(chan struct{}),
+		err:  status.Error(constant.CodeNodeIsNotLeader, "node is not leader"),
+	}
+	sw := newStreamWrapper(0, stream, cancel)
+	e.writeStreams[0] = []*streamWrapper{sw}
+
+	shardId := int64(0)
+	_, err := e.ExecuteWrite(context.Background(), &proto.WriteRequest{Shard: &shardId})
+	assert.Equal(t, constant.CodeNodeIsNotLeader, status.Code(err))
+
+	// The stale stream is torn down and the assignments are refreshed
+	assert.NotContains(t, e.writeStreams, shardId)
+	assert.True(t, sw.failed.Load())
+	assert.ErrorIs(t, streamCtx.Err(), context.Canceled)
+	assert.ErrorIs(t, assignmentsCtx.Err(), context.Canceled)
+}
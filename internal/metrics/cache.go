@@ -0,0 +1,66 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// CacheMetrics tracks the effectiveness of a client-side cache.
+type CacheMetrics struct {
+	hits          metric.Int64Counter
+	misses        metric.Int64Counter
+	evictions     metric.Int64Counter
+	invalidations metric.Int64Counter
+	refreshes     metric.Int64Counter
+	attrs         metric.MeasurementOption
+}
+
+func NewCacheMetrics(provider metric.MeterProvider, cacheName string) *CacheMetrics {
+	meter := provider.Meter("oxia_client")
+	return &CacheMetrics{
+		hits:          newCounter(meter, "oxia_client_cache_hits", ""),
+		misses:        newCounter(meter, "oxia_client_cache_misses", ""),
+		evictions:     newCounter(meter, "oxia_client_cache_evictions", ""),
+		invalidations: newCounter(meter, "oxia_client_cache_invalidations", ""),
+		refreshes:     newCounter(meter, "oxia_client_cache_refreshes", ""),
+		attrs: metric.WithAttributes(
+			attribute.Key("cache").String(cacheName),
+		),
+	}
+}
+
+func (m *CacheMetrics) Hit() {
+	m.hits.Add(context.TODO(), 1, m.attrs)
+}
+
+func (m *CacheMetrics) Miss() {
+	m.misses.Add(context.TODO(), 1, m.attrs)
+}
+
+func (m *CacheMetrics) Evicted() {
+	m.evictions.Add(context.TODO(), 1, m.attrs)
+}
+
+func (m *CacheMetrics) Invalidated(count int) {
+	m.invalidations.Add(context.TODO(), int64(count), m.attrs)
+}
+
+func (m *CacheMetrics) Refreshed() {
+	m.refreshes.Add(context.TODO(), 1, m.attrs)
+}
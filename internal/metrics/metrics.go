@@ -21,11 +21,16 @@ import (
 	"go.opentelemetry.io/otel/metric"
 
 	ometric "github.com/oxia-db/oxia/common/metric"
-	"github.com/oxia-db/oxia/oxia/internal/model"
+
+	"github.com/oxia-db/oxia-client-golang/internal/model"
 	"github.com/oxia-db/oxia/proto"
 )
 
 type Metrics struct {
+	// The namespace attribute of the metrics, if they are shared by the
+	// clients of multiple namespaces
+	namespace string
+
 	timeFunc  func() time.Time
 	sinceFunc func(time.Time) time.Duration
 
@@ -58,6 +63,15 @@ func newMetrics(provider metric.MeterProvider, timeFunc func() time.Time, sinceF
 	}
 }
 
+// WithNamespace returns a copy of the metrics that are recorded with the given
+// namespace attribute, so that the clients of multiple namespaces can share the
+// same instruments.
+func (m *Metrics) WithNamespace(namespace string) *Metrics {
+	withNamespace := *m
+	withNamespace.namespace = namespace
+	return &withNamespace
+}
+
 func (m *Metrics) DecoratePut(put model.PutCall) model.PutCall {
 	callback := put.Callback
 	metricContext := m.metricContextFunc("put")
@@ -135,6 +149,6 @@ func (m *Metrics) ReadCallback() func(time.Time, *proto.ReadRequest, *proto.Read
 func (m *Metrics) metricContextFunc(requestType string) func(error) (context.Context, time.Time, metric.MeasurementOption) {
 	start := m.timeFunc()
 	return func(err error) (context.Context, time.Time, metric.MeasurementOption) {
-		return context.TODO(), start, attrs(requestType, err)
+		return context.TODO(), start, attrs(m.namespace, requestType, err)
 	}
 }
@@ -26,7 +26,7 @@ import (
 	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/metric/metricdata"
 
-	"github.com/oxia-db/oxia/oxia/internal/model"
+	"github.com/oxia-db/oxia-client-golang/internal/model"
 	"github.com/oxia-db/oxia/proto"
 )
 
@@ -138,6 +138,34 @@ func TestMetricsCallback(t *testing.T) {
 	}
 }
 
+func TestMetricsWithNamespace(t *testing.T) {
+	metrics, reader := setup(time.Since)
+	for _, namespace := range []string{"ns-1", "ns-2"} {
+		metrics.WithNamespace(namespace).WriteCallback()(time.Now(), &proto.WriteRequest{
+			Puts: []*proto.PutRequest{{Value: []byte{0, 1, 2, 3, 4}}},
+		}, &proto.WriteResponse{}, nil)
+	}
+
+	rm := metricdata.ResourceMetrics{}
+	err := reader.Collect(context.Background(), &rm)
+	assert.NoError(t, err)
+
+	// The shared instruments are recorded separately for each namespace
+	datapoints, err := histogram(rm, "oxia_client_batch_request")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(datapoints))
+	var namespaces []string
+	for _, datapoint := range datapoints {
+		assert.Equal(t, 3, datapoint.Attributes.Len())
+		assertAttribute(t, datapoint.Attributes, "type", "write")
+		assertAttribute(t, datapoint.Attributes, "result", "success")
+		namespace, ok := datapoint.Attributes.Value("namespace")
+		assert.True(t, ok)
+		namespaces = append(namespaces, namespace.AsString())
+	}
+	assert.ElementsMatch(t, []string{"ns-1", "ns-2"}, namespaces)
+}
+
 func setup(sinceFunc func(time.Time) time.Duration) (*Metrics, metric.Reader) {
 	reader := metric.NewManualReader()
 	provider := metric.NewMeterProvider(metric.WithReader(reader))
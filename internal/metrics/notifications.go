@@ -0,0 +1,87 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	ometric "github.com/oxia-db/oxia/common/metric"
+)
+
+// NotificationsMetrics tracks the state of a single notifications subscription.
+type NotificationsMetrics struct {
+	sinceFunc func(time.Time) time.Duration
+
+	lag          metric.Int64Histogram
+	dropped      metric.Int64Counter
+	spilled      metric.Int64Counter
+	registration metric.Registration
+}
+
+// NewNotificationsMetrics creates the metrics for a notifications subscription. The
+// `queueDepth` function is invoked on each collection to report the number of
+// notifications waiting to be consumed.
+func NewNotificationsMetrics(provider metric.MeterProvider, queueDepth func() int64) *NotificationsMetrics {
+	meter := provider.Meter("oxia_client")
+	m := &NotificationsMetrics{
+		sinceFunc: time.Since,
+		lag:       newHistogram(meter, "oxia_client_notifications_lag", ometric.Milliseconds),
+		dropped:   newCounter(meter, "oxia_client_notifications_dropped", ""),
+		spilled:   newCounter(meter, "oxia_client_notifications_spilled", ""),
+	}
+
+	depth, err := meter.Int64ObservableGauge("oxia_client_notifications_queue_depth")
+	fatalOnErr(err, "oxia_client_notifications_queue_depth")
+
+	m.registration, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(depth, queueDepth())
+		return nil
+	}, depth)
+	fatalOnErr(err, "oxia_client_notifications_queue_depth")
+	return m
+}
+
+// RecordLag records the delay between the time a notification batch was generated
+// on the server, as reported by its timestamp in milliseconds, and now.
+func (m *NotificationsMetrics) RecordLag(shard int64, timestamp uint64) {
+	if timestamp == 0 {
+		return
+	}
+
+	lag := m.sinceFunc(time.UnixMilli(int64(timestamp)))
+	m.lag.Record(context.TODO(), lag.Milliseconds(), shardAttrs(shard))
+}
+
+func (m *NotificationsMetrics) RecordDropped(count int) {
+	m.dropped.Add(context.TODO(), int64(count))
+}
+
+func (m *NotificationsMetrics) RecordSpilled() {
+	m.spilled.Add(context.TODO(), 1)
+}
+
+func (m *NotificationsMetrics) Close() error {
+	return m.registration.Unregister()
+}
+
+func shardAttrs(shard int64) metric.MeasurementOption {
+	return metric.WithAttributes(
+		attribute.Key("shard").Int64(shard),
+	)
+}
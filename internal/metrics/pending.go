@@ -0,0 +1,57 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/metric"
+
+	ometric "github.com/oxia-db/oxia/common/metric"
+)
+
+// PendingMetrics reports the requests that were submitted to the client and
+// are not completed yet.
+type PendingMetrics struct {
+	registration metric.Registration
+}
+
+// NewPendingMetrics creates the gauges of the pending requests. The `observe`
+// function is invoked on each collection, and it must report the pending load
+// of each shard.
+func NewPendingMetrics(provider metric.MeterProvider,
+	observe func(report func(shard int64, requests int64, bytes int64))) *PendingMetrics {
+	meter := provider.Meter("oxia_client")
+
+	requests, err := meter.Int64ObservableGauge("oxia_client_pending_requests")
+	fatalOnErr(err, "oxia_client_pending_requests")
+	bytes, err := meter.Int64ObservableGauge("oxia_client_pending_bytes", metric.WithUnit(string(ometric.Bytes)))
+	fatalOnErr(err, "oxia_client_pending_bytes")
+
+	m := &PendingMetrics{}
+	m.registration, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		observe(func(shard int64, pendingRequests int64, pendingBytes int64) {
+			o.ObserveInt64(requests, pendingRequests, shardAttrs(shard))
+			o.ObserveInt64(bytes, pendingBytes, shardAttrs(shard))
+		})
+		return nil
+	}, requests, bytes)
+	fatalOnErr(err, "oxia_client_pending")
+	return m
+}
+
+func (m *PendingMetrics) Close() error {
+	return m.registration.Unregister()
+}
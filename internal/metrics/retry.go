@@ -0,0 +1,56 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"google.golang.org/grpc/status"
+)
+
+// RetryMetrics tracks the retries of the failed operations.
+type RetryMetrics struct {
+	retries   metric.Int64Counter
+	exhausted metric.Int64Counter
+}
+
+func NewRetryMetrics(provider metric.MeterProvider) *RetryMetrics {
+	meter := provider.Meter("oxia_client")
+	return &RetryMetrics{
+		retries:   newCounter(meter, "oxia_client_retries", ""),
+		exhausted: newCounter(meter, "oxia_client_retries_exhausted", ""),
+	}
+}
+
+// RecordRetry records a new attempt of the operation, after it failed with the
+// given error.
+func (m *RetryMetrics) RecordRetry(operation string, err error) {
+	m.retries.Add(context.TODO(), 1, retryAttrs(operation, err))
+}
+
+// RecordExhausted records an operation that was given up on, with the error of
+// its last attempt.
+func (m *RetryMetrics) RecordExhausted(operation string, err error) {
+	m.exhausted.Add(context.TODO(), 1, retryAttrs(operation, err))
+}
+
+func retryAttrs(operation string, err error) metric.MeasurementOption {
+	return metric.WithAttributes(
+		attribute.Key("type").String(operation),
+		attribute.Key("code").String(status.Code(err).String()),
+	)
+}
@@ -0,0 +1,55 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ShardAssignmentsMetrics tracks the changes in the shard assignments.
+type ShardAssignmentsMetrics struct {
+	updates       metric.Int64Counter
+	shardsAdded   metric.Int64Counter
+	shardsRemoved metric.Int64Counter
+	leaderChanges metric.Int64Counter
+}
+
+func NewShardAssignmentsMetrics(provider metric.MeterProvider) *ShardAssignmentsMetrics {
+	meter := provider.Meter("oxia_client")
+	return &ShardAssignmentsMetrics{
+		updates:       newCounter(meter, "oxia_client_shard_assignments_updates", ""),
+		shardsAdded:   newCounter(meter, "oxia_client_shard_assignments_shards_added", ""),
+		shardsRemoved: newCounter(meter, "oxia_client_shard_assignments_shards_removed", ""),
+		leaderChanges: newCounter(meter, "oxia_client_shard_leader_changes", ""),
+	}
+}
+
+// RecordUpdate records the reception of new assignments, including the ones
+// that didn't change anything.
+func (m *ShardAssignmentsMetrics) RecordUpdate(added int, removed int) {
+	m.updates.Add(context.TODO(), 1)
+	if added > 0 {
+		m.shardsAdded.Add(context.TODO(), int64(added))
+	}
+	if removed > 0 {
+		m.shardsRemoved.Add(context.TODO(), int64(removed))
+	}
+}
+
+func (m *ShardAssignmentsMetrics) RecordLeaderChange(shard int64) {
+	m.leaderChanges.Add(context.TODO(), 1, shardAttrs(shard))
+}
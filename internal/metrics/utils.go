@@ -55,11 +55,15 @@ func fatalOnErr(err error, name string) {
 	}
 }
 
-func attrs(requestType string, err error) metric.MeasurementOption {
-	return metric.WithAttributes(
+func attrs(namespace string, requestType string, err error) metric.MeasurementOption {
+	attributes := []attribute.KeyValue{
 		attribute.Key("type").String(requestType),
 		attribute.Key("result").String(result(err)),
-	)
+	}
+	if namespace != "" {
+		attributes = append(attributes, attribute.Key("namespace").String(namespace))
+	}
+	return metric.WithAttributes(attributes...)
 }
 
 func result(err error) string {
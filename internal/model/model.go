@@ -15,6 +15,10 @@
 package model
 
 import (
+	"context"
+	"time"
+
+	"github.com/oxia-db/oxia-client-golang/pkg/batch"
 	"github.com/oxia-db/oxia/proto"
 )
 
@@ -27,18 +31,24 @@ type PutCall struct {
 	ClientIdentity     *string
 	PartitionKey       *string
 	SecondaryIndexes   []*proto.SecondaryIndex
+	Priority           batch.Priority
+	Context            context.Context
 	Callback           func(*proto.PutResponse, error)
 }
 
 type DeleteCall struct {
 	Key               string
 	ExpectedVersionId *int64
+	Priority          batch.Priority
+	Context           context.Context
 	Callback          func(*proto.DeleteResponse, error)
 }
 
 type DeleteRangeCall struct {
 	MinKeyInclusive string
 	MaxKeyExclusive string
+	Priority        batch.Priority
+	Context         context.Context
 	Callback        func(*proto.DeleteRangeResponse, error)
 }
 
@@ -47,9 +57,39 @@ type GetCall struct {
 	ComparisonType     proto.KeyComparisonType
 	IncludeValue       bool
 	SecondaryIndexName *string
+	Priority           batch.Priority
+	Context            context.Context
 	Callback           func(*proto.GetResponse, error)
 }
 
+func (r PutCall) CallPriority() batch.Priority {
+	return r.Priority
+}
+
+func (r DeleteCall) CallPriority() batch.Priority {
+	return r.Priority
+}
+
+func (r DeleteRangeCall) CallPriority() batch.Priority {
+	return r.Priority
+}
+
+func (r GetCall) CallPriority() batch.Priority {
+	return r.Priority
+}
+
+func (r PutCall) CallKey() (key string, all bool) {
+	return r.Key, false
+}
+
+func (r DeleteCall) CallKey() (key string, all bool) {
+	return r.Key, false
+}
+
+func (DeleteRangeCall) CallKey() (key string, all bool) {
+	return "", true
+}
+
 func (r PutCall) ToProto() *proto.PutRequest {
 	return &proto.PutRequest{
 		Key:               r.Key,
@@ -86,6 +126,30 @@ func (r GetCall) ToProto() *proto.GetRequest {
 	}
 }
 
+// ContextErr returns the error of the context of a call, if it's done. The
+// context is optional.
+func ContextErr(ctx context.Context) error {
+	if ctx == nil {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// EarliestDeadline returns the earliest deadline among the contexts, if any.
+func EarliestDeadline(contexts []context.Context) (time.Time, bool) {
+	var earliest time.Time
+	found := false
+	for _, ctx := range contexts {
+		if ctx == nil {
+			continue
+		}
+		if deadline, ok := ctx.Deadline(); ok && (!found || deadline.Before(earliest)) {
+			earliest, found = deadline, true
+		}
+	}
+	return earliest, found
+}
+
 func Convert[CALL any, PROTO any](calls []CALL, toProto func(CALL) PROTO) []PROTO {
 	protos := make([]PROTO, len(calls))
 	for i, call := range calls {
@@ -0,0 +1,247 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/metric"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/oxia-db/oxia/common/constant"
+
+	"github.com/oxia-db/oxia-client-golang/internal/metrics"
+)
+
+// RetryOperationType identifies the kind of operation that is retried.
+type RetryOperationType string
+
+const (
+	RetryOperationWrite            RetryOperationType = "write"
+	RetryOperationRead             RetryOperationType = "read"
+	RetryOperationSession          RetryOperationType = "session"
+	RetryOperationNotifications    RetryOperationType = "notifications"
+	RetryOperationSequenceUpdates  RetryOperationType = "sequence_updates"
+	RetryOperationShardAssignments RetryOperationType = "shard_assignments"
+)
+
+// RetryOperation describes an operation that failed and may be retried.
+type RetryOperation struct {
+	Type RetryOperationType
+
+	// Idempotent is false for the write batches that contain puts with sequence
+	// keys, or puts and deletes with an expected version id. If a previous
+	// attempt was applied, but its response was lost, retrying them would
+	// either apply them twice or fail them.
+	Idempotent bool
+}
+
+// RetryPolicy decides whether and when the failed operations are retried.
+type RetryPolicy interface {
+	// ShouldRetry returns whether the operation that failed with the given
+	// error can be attempted again.
+	ShouldRetry(operation RetryOperation, err error) bool
+
+	// NewBackOff returns the delays between the attempts of an operation. When
+	// the backoff returns backoff.Stop, the operation fails with the error of
+	// its last attempt.
+	NewBackOff(ctx context.Context, operation RetryOperation) backoff.BackOff
+}
+
+// RetryBudget limits the retries of an operation. A zero value means no limit.
+type RetryBudget struct {
+	MaxRetries     int
+	MaxElapsedTime time.Duration
+}
+
+// DefaultRetryPolicy retries with an exponential backoff.
+//
+// The reads and writes are only retried on the errors in RetriableCodes. The
+// streams (sessions, notifications, sequence updates and shard assignments)
+// are kept open for the lifetime of the client, so they're retried on any
+// error, except the ones that make them permanently unusable.
+type DefaultRetryPolicy struct {
+	RetriableCodes []codes.Code
+
+	InitialInterval time.Duration
+	// The initial interval for the notifications and sequence updates streams
+	SubscriptionInitialInterval time.Duration
+	MaxInterval                 time.Duration
+	Multiplier                  float64
+	// Jitter is the randomization factor of the intervals, between 0 and 1
+	Jitter float64
+
+	// Budgets of each type of operation. The reads and writes are also limited
+	// by the request timeout.
+	Budgets map[RetryOperationType]RetryBudget
+
+	// RetryNonIdempotentWrites enables the retries of the non-idempotent writes.
+	RetryNonIdempotentWrites bool
+}
+
+// NewDefaultRetryPolicy creates the policy used when none is set on the client.
+func NewDefaultRetryPolicy() *DefaultRetryPolicy {
+	return &DefaultRetryPolicy{
+		RetriableCodes: []codes.Code{
+			codes.Unavailable,            // Failure to connect is ok to re-attempt
+			constant.CodeInvalidStatus,   // Leader has fenced the shard, though we expect a new leader to be elected
+			constant.CodeAlreadyClosed,   // Leader is closing, though we expect a new leader to be elected
+			constant.CodeNodeIsNotLeader, // The request must be made to the new leader
+		},
+		InitialInterval:             100 * time.Millisecond,
+		SubscriptionInitialInterval: 1 * time.Second,
+		MaxInterval:                 backoff.DefaultMaxInterval,
+		Multiplier:                  backoff.DefaultMultiplier,
+		Jitter:                      backoff.DefaultRandomizationFactor,
+		Budgets:                     map[RetryOperationType]RetryBudget{},
+		RetryNonIdempotentWrites:    true,
+	}
+}
+
+func (p *DefaultRetryPolicy) ShouldRetry(operation RetryOperation, err error) bool {
+	switch operation.Type {
+	case RetryOperationWrite, RetryOperationRead:
+		if !operation.Idempotent && !p.RetryNonIdempotentWrites {
+			return false
+		}
+		return slices.Contains(p.RetriableCodes, status.Code(err))
+	default:
+		return true
+	}
+}
+
+func (p *DefaultRetryPolicy) NewBackOff(ctx context.Context, operation RetryOperation) backoff.BackOff {
+	initialInterval := p.InitialInterval
+	if operation.Type == RetryOperationNotifications || operation.Type == RetryOperationSequenceUpdates {
+		initialInterval = p.SubscriptionInitialInterval
+	}
+
+	budget := p.Budgets[operation.Type]
+	var b backoff.BackOff = &backoff.ExponentialBackOff{
+		InitialInterval:     initialInterval,
+		RandomizationFactor: p.Jitter,
+		Multiplier:          p.Multiplier,
+		MaxInterval:         p.MaxInterval,
+		MaxElapsedTime:      budget.MaxElapsedTime,
+		Stop:                backoff.Stop,
+		Clock:               backoff.SystemClock,
+	}
+	if budget.MaxRetries > 0 {
+		b = backoff.WithMaxRetries(b, uint64(budget.MaxRetries))
+	}
+	return backoff.WithContext(b, ctx)
+}
+
+// RequestError is the error of a read or write request that failed, after
+// being retried as long as the policy allowed it.
+type RequestError struct {
+	ShardId  int64
+	Attempts int
+	// Retriable is whether the policy considers the error retriable. When it's
+	// set, the request failed because its retries were exhausted.
+	Retriable bool
+	Err       error
+}
+
+func (e *RequestError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// Retrier runs the operations with the retries allowed by a RetryPolicy, and
+// records them in the metrics.
+type Retrier struct {
+	policy  RetryPolicy
+	metrics *metrics.RetryMetrics
+}
+
+func NewRetrier(policy RetryPolicy, meterProvider metric.MeterProvider) *Retrier {
+	return &Retrier{
+		policy:  policy,
+		metrics: metrics.NewRetryMetrics(meterProvider),
+	}
+}
+
+func (r *Retrier) ShouldRetry(operation RetryOperation, err error) bool {
+	return r.policy.ShouldRetry(operation, err)
+}
+
+func (r *Retrier) NewBackOff(ctx context.Context, operation RetryOperation) backoff.BackOff {
+	return r.policy.NewBackOff(ctx, operation)
+}
+
+// Retry calls fn until it succeeds, the policy rejects its error or the backoff
+// stops. Like with backoff.RetryNotify, fn can return a backoff.Permanent error
+// to stop retrying.
+func (r *Retrier) Retry(operation RetryOperation, backOff backoff.BackOff, fn func() error,
+	notify backoff.Notify) error {
+	permanent := false
+	err := backoff.RetryNotify(func() error {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		var permanentErr *backoff.PermanentError
+		if errors.As(err, &permanentErr) {
+			permanent = true
+			return err
+		}
+		if !r.policy.ShouldRetry(operation, err) {
+			permanent = true
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backOff, func(err error, duration time.Duration) {
+		r.metrics.RecordRetry(string(operation.Type), err)
+		if notify != nil {
+			notify(err, duration)
+		}
+	})
+
+	if err != nil && !permanent && !errors.Is(err, context.Canceled) {
+		r.metrics.RecordExhausted(string(operation.Type), err)
+	}
+	return err
+}
+
+// RetryRequest is like Retry, though the error of the request to the shard is
+// wrapped in a RequestError.
+func (r *Retrier) RetryRequest(operation RetryOperation, shardId int64, backOff backoff.BackOff, fn func() error,
+	notify backoff.Notify) error {
+	attempts := 0
+	err := r.Retry(operation, backOff, func() error {
+		attempts++
+		return fn()
+	}, notify)
+	if err == nil {
+		return nil
+	}
+
+	return &RequestError{
+		ShardId:   shardId,
+		Attempts:  attempts,
+		Retriable: r.policy.ShouldRetry(operation, err),
+		Err:       err,
+	}
+}
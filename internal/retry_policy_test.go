@@ -0,0 +1,130 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/metric/noop"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/oxia-db/oxia/common/constant"
+)
+
+func TestDefaultRetryPolicyShouldRetry(t *testing.T) {
+	policy := NewDefaultRetryPolicy()
+	write := RetryOperation{Type: RetryOperationWrite, Idempotent: true}
+	nonIdempotentWrite := RetryOperation{Type: RetryOperationWrite, Idempotent: false}
+	notifications := RetryOperation{Type: RetryOperationNotifications, Idempotent: true}
+
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	notLeader := status.Error(constant.CodeNodeIsNotLeader, "not leader")
+	internalErr := status.Error(codes.Internal, "internal")
+
+	assert.True(t, policy.ShouldRetry(write, unavailable))
+	assert.True(t, policy.ShouldRetry(write, notLeader))
+	assert.False(t, policy.ShouldRetry(write, internalErr))
+	assert.True(t, policy.ShouldRetry(nonIdempotentWrite, unavailable))
+	assert.True(t, policy.ShouldRetry(notifications, internalErr))
+
+	policy.RetryNonIdempotentWrites = false
+	assert.False(t, policy.ShouldRetry(nonIdempotentWrite, unavailable))
+	assert.True(t, policy.ShouldRetry(write, unavailable))
+}
+
+func TestRetrierBudget(t *testing.T) {
+	policy := NewDefaultRetryPolicy()
+	policy.InitialInterval = time.Millisecond
+	policy.Budgets[RetryOperationRead] = RetryBudget{MaxRetries: 2}
+	retrier := NewRetrier(policy, noop.NewMeterProvider())
+
+	operation := RetryOperation{Type: RetryOperationRead, Idempotent: true}
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+
+	attempts := 0
+	retries := 0
+	err := retrier.Retry(operation, retrier.NewBackOff(context.Background(), operation), func() error {
+		attempts++
+		return unavailable
+	}, func(error, time.Duration) {
+		retries++
+	})
+	assert.ErrorIs(t, err, unavailable)
+	assert.Equal(t, 3, attempts)
+	assert.Equal(t, 2, retries)
+}
+
+func TestRetrierPermanentErrors(t *testing.T) {
+	retrier := NewRetrier(NewDefaultRetryPolicy(), noop.NewMeterProvider())
+	operation := RetryOperation{Type: RetryOperationWrite, Idempotent: true}
+
+	// Rejected by the policy
+	attempts := 0
+	internalErr := status.Error(codes.Internal, "internal")
+	err := retrier.Retry(operation, retrier.NewBackOff(context.Background(), operation), func() error {
+		attempts++
+		return internalErr
+	}, nil)
+	assert.ErrorIs(t, err, internalErr)
+	assert.Equal(t, 1, attempts)
+
+	// Rejected by the operation itself
+	attempts = 0
+	errStop := errors.New("stop")
+	err = retrier.Retry(operation, retrier.NewBackOff(context.Background(), operation), func() error {
+		attempts++
+		return backoff.Permanent(errStop)
+	}, nil)
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, attempts)
+}
+
+func TestRetrierRetryRequest(t *testing.T) {
+	policy := NewDefaultRetryPolicy()
+	policy.InitialInterval = time.Millisecond
+	policy.Budgets[RetryOperationWrite] = RetryBudget{MaxRetries: 2}
+	retrier := NewRetrier(policy, noop.NewMeterProvider())
+	operation := RetryOperation{Type: RetryOperationWrite, Idempotent: true}
+
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	err := retrier.RetryRequest(operation, 5, retrier.NewBackOff(context.Background(), operation), func() error {
+		return unavailable
+	}, nil)
+	assert.ErrorIs(t, err, unavailable)
+
+	var requestErr *RequestError
+	assert.ErrorAs(t, err, &requestErr)
+	assert.EqualValues(t, 5, requestErr.ShardId)
+	assert.Equal(t, 3, requestErr.Attempts)
+	assert.True(t, requestErr.Retriable)
+
+	internalErr := status.Error(codes.Internal, "internal")
+	err = retrier.RetryRequest(operation, 5, retrier.NewBackOff(context.Background(), operation), func() error {
+		return internalErr
+	}, nil)
+	assert.ErrorAs(t, err, &requestErr)
+	assert.Equal(t, 1, requestErr.Attempts)
+	assert.False(t, requestErr.Retriable)
+
+	assert.NoError(t, retrier.RetryRequest(operation, 5, retrier.NewBackOff(context.Background(), operation), func() error {
+		return nil
+	}, nil))
+}
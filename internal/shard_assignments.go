@@ -0,0 +1,106 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"sort"
+)
+
+// HashShardStrategy is implemented by the strategies that route the keys by
+// their hash. The shard owning a key can then be found with a binary search
+// over the hash ranges.
+type HashShardStrategy interface {
+	ShardStrategy
+
+	// Hash returns the hash of the key, used to find the shard whose hash
+	// range contains it.
+	Hash(key string) uint32
+}
+
+// An immutable snapshot of the shard assignments. A new snapshot is created on
+// every update, so that it can be read without any locking.
+type shardAssignments struct {
+	strategy     ShardStrategy
+	hashStrategy HashShardStrategy
+
+	// Sorted by the start of the hash range
+	sorted []Shard
+	byId   map[int64]Shard
+	ids    []int64
+
+	// Closed when the snapshot is replaced by a newer one
+	replaced chan struct{}
+}
+
+func newShardAssignments(strategy ShardStrategy, shards map[int64]Shard) *shardAssignments {
+	sa := &shardAssignments{
+		strategy: strategy,
+		sorted:   make([]Shard, 0, len(shards)),
+		byId:     make(map[int64]Shard, len(shards)),
+		ids:      make([]int64, 0, len(shards)),
+		replaced: make(chan struct{}),
+	}
+	sa.hashStrategy, _ = strategy.(HashShardStrategy)
+
+	for shardId, shard := range shards {
+		sa.sorted = append(sa.sorted, shard)
+		sa.byId[shardId] = shard
+		sa.ids = append(sa.ids, shardId)
+	}
+
+	sort.Slice(sa.sorted, func(i, j int) bool {
+		return sa.sorted[i].HashRange.MinInclusive < sa.sorted[j].HashRange.MinInclusive
+	})
+	return sa
+}
+
+func (sa *shardAssignments) get(key string) (int64, bool) {
+	if sa.hashStrategy == nil {
+		// Custom strategies can only be evaluated against each shard
+		predicate := sa.strategy.Get(key)
+		for _, shard := range sa.sorted {
+			if predicate(shard) {
+				return shard.Id, true
+			}
+		}
+		return 0, false
+	}
+
+	code := sa.hashStrategy.Hash(key)
+	idx := sort.Search(len(sa.sorted), func(i int) bool {
+		return sa.sorted[i].HashRange.MaxInclusive >= code
+	})
+	if idx < len(sa.sorted) && sa.sorted[idx].HashRange.MinInclusive <= code {
+		return sa.sorted[idx].Id, true
+	}
+	return 0, false
+}
+
+func (sa *shardAssignments) leader(shardId int64) (string, bool) {
+	shard, ok := sa.byId[shardId]
+	return shard.Leader, ok
+}
+
+func (sa *shardAssignments) getShards() []Shard {
+	res := make([]Shard, len(sa.sorted))
+	copy(res, sa.sorted)
+	return res
+}
+
+func (sa *shardAssignments) getAll() []int64 {
+	res := make([]int64, len(sa.ids))
+	copy(res, sa.ids)
+	return res
+}
@@ -0,0 +1,155 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Splits the whole hash space in `count` contiguous ranges.
+func generateShards(count int) map[int64]Shard {
+	shards := make(map[int64]Shard, count)
+	bucket := uint64(math.MaxUint32+1) / uint64(count)
+	for i := 0; i < count; i++ {
+		minInclusive := uint64(i) * bucket
+		maxInclusive := minInclusive + bucket - 1
+		if i == count-1 {
+			maxInclusive = math.MaxUint32
+		}
+		shards[int64(i)] = Shard{
+			Id:        int64(i),
+			Leader:    fmt.Sprintf("leader-%d", i%3),
+			HashRange: hashRange(uint32(minInclusive), uint32(maxInclusive)),
+		}
+	}
+	return shards
+}
+
+// Only exposes the predicate, to force the linear scan.
+type predicateOnlyStrategy struct {
+	ShardStrategy
+}
+
+func TestShardAssignments(t *testing.T) {
+	shards := generateShards(16)
+	binary := newShardAssignments(NewShardStrategy(), shards)
+	linear := newShardAssignments(&predicateOnlyStrategy{NewShardStrategy()}, shards)
+	assert.NotNil(t, binary.hashStrategy)
+	assert.Nil(t, linear.hashStrategy)
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		expected, ok := linear.get(key)
+		assert.True(t, ok)
+		actual, ok := binary.get(key)
+		assert.True(t, ok)
+		assert.Equal(t, expected, actual)
+	}
+
+	leader, ok := binary.leader(4)
+	assert.True(t, ok)
+	assert.Equal(t, "leader-1", leader)
+	_, ok = binary.leader(100)
+	assert.False(t, ok)
+
+	assert.ElementsMatch(t, []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, binary.getAll())
+}
+
+func TestShardAssignments_Gaps(t *testing.T) {
+	sa := newShardAssignments(&shardStrategyImpl{
+		hashFunc: func(key string) uint32 {
+			var code uint32
+			_, _ = fmt.Sscanf(key, "%d", &code)
+			return code
+		},
+	}, map[int64]Shard{
+		1: {Id: 1, HashRange: hashRange(10, 19)},
+		2: {Id: 2, HashRange: hashRange(30, 39)},
+	})
+
+	for _, item := range []struct {
+		key   string
+		shard int64
+		found bool
+	}{
+		{"5", 0, false},
+		{"10", 1, true},
+		{"19", 1, true},
+		{"25", 0, false},
+		{"30", 2, true},
+		{"40", 0, false},
+	} {
+		shard, found := sa.get(item.key)
+		assert.Equal(t, item.found, found, item.key)
+		assert.Equal(t, item.shard, shard, item.key)
+	}
+}
+
+// Reproduces the previous lookup, which walked the map of shards while
+// holding a read lock.
+type mapScanLookup struct {
+	sync.RWMutex
+	strategy ShardStrategy
+	shards   map[int64]Shard
+}
+
+func (l *mapScanLookup) get(key string) int64 {
+	l.RLock()
+	defer l.RUnlock()
+
+	predicate := l.strategy.Get(key)
+	for _, shard := range l.shards {
+		if predicate(shard) {
+			return shard.Id
+		}
+	}
+	panic("shard not found")
+}
+
+func BenchmarkShardLookup(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("/my-key/%d", i)
+	}
+
+	for _, count := range []int{1, 16, 256, 1024} {
+		shards := generateShards(count)
+
+		b.Run(fmt.Sprintf("map-scan/shards-%d", count), func(b *testing.B) {
+			l := &mapScanLookup{strategy: NewShardStrategy(), shards: shards}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				l.get(keys[i%len(keys)])
+			}
+		})
+
+		b.Run(fmt.Sprintf("binary-search/shards-%d", count), func(b *testing.B) {
+			sm := &shardManagerImpl{ctx: context.Background()}
+			sm.assignments.Store(newShardAssignments(NewShardStrategy(), shards))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				sm.Get(keys[i%len(keys)])
+			}
+		})
+	}
+}
@@ -19,10 +19,12 @@ import (
 	"io"
 	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/metric"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 
@@ -30,42 +32,161 @@ import (
 	"github.com/oxia-db/oxia/common/constant"
 	"github.com/oxia-db/oxia/common/process"
 	"github.com/oxia-db/oxia/common/rpc"
-	time2 "github.com/oxia-db/oxia/common/time"
 
+	"github.com/oxia-db/oxia-client-golang/internal/metrics"
 	"github.com/oxia-db/oxia/proto"
 )
 
+// The minimum age of the assignments stream before it can be re-established
+// to refresh the assignments.
+const minRefreshInterval = 100 * time.Millisecond
+
+var ErrShardNotAvailable = errors.New("oxia: shard not available")
+
 type ShardManager interface {
 	io.Closer
-	Get(key string) int64
+
+	// Get returns the shard that owns the key, or ErrShardNotAvailable if
+	// there's no shard assigned for it.
+	Get(key string) (int64, error)
+
+	// Lookup returns the shard that owns the key in the current assignments,
+	// without waiting for them to be updated.
+	Lookup(key string) (int64, bool)
+
 	GetAll() []int64
-	Leader(shardId int64) string
+
+	// GetShards returns a snapshot of the current shards, sorted by hash range.
+	GetShards() []Shard
+
+	// Leader returns the leader of the shard, or ErrShardNotAvailable if the
+	// shard is not known.
+	Leader(shardId int64) (string, error)
+
+	// LookupLeader returns the leader of the shard in the current assignments,
+	// without waiting for them to be updated.
+	LookupLeader(shardId int64) (string, bool)
+
+	// Refresh forces the retrieval of the latest shard assignments.
+	Refresh()
+
+	// AddListener registers a function that is invoked after each update of
+	// the shard assignments that adds or removes shards, or moves their leaders.
+	// The returned function unregisters the listener.
+	AddListener(listener func(ShardAssignmentsUpdate)) func()
+}
+
+// ShardAssignmentsUpdate describes how the set of shards has changed after
+// receiving new assignments.
+type ShardAssignmentsUpdate struct {
+	Added         []Shard
+	Removed       []Shard
+	LeaderChanges []LeaderChange
+}
+
+// LeaderChange describes a shard whose leader has moved to a different node.
+type LeaderChange struct {
+	Shard          Shard
+	PreviousLeader string
+}
+
+func (u ShardAssignmentsUpdate) IsEmpty() bool {
+	return len(u.Added) == 0 && len(u.Removed) == 0 && len(u.LeaderChanges) == 0
+}
+
+// Merge returns a single update with the changes of u followed by the ones of
+// next. The changes that cancel each other out are left out, eg: a shard that
+// was added and then removed.
+func (u ShardAssignmentsUpdate) Merge(next ShardAssignmentsUpdate) ShardAssignmentsUpdate {
+	// The shards before and after the updates, among the ones they change
+	previous := make(map[int64]Shard)
+	current := make(map[int64]Shard)
+	seen := make(map[int64]bool)
+
+	for _, update := range []ShardAssignmentsUpdate{u, next} {
+		for _, shard := range update.Removed {
+			if !seen[shard.Id] {
+				previous[shard.Id] = shard
+				seen[shard.Id] = true
+			}
+			delete(current, shard.Id)
+		}
+		for _, shard := range update.Added {
+			seen[shard.Id] = true
+			current[shard.Id] = shard
+		}
+		for _, change := range update.LeaderChanges {
+			if !seen[change.Shard.Id] {
+				shard := change.Shard
+				shard.Leader = change.PreviousLeader
+				previous[shard.Id] = shard
+				seen[shard.Id] = true
+			}
+			current[change.Shard.Id] = change.Shard
+		}
+	}
+	return diffShards(previous, current)
 }
 
 type shardManagerImpl struct {
+	// Serializes the updates. The readers only access the current snapshot
+	// of the assignments, without locking.
 	sync.RWMutex
-	updatedWg concurrent.WaitGroup
+	updatedWg   concurrent.WaitGroup
+	assignments atomic.Pointer[shardAssignments]
+
+	listenersMutex sync.Mutex
+	listeners      map[int64]func(ShardAssignmentsUpdate)
+	nextListenerId int64
 
 	shardStrategy  ShardStrategy
 	clientPool     rpc.ClientPool
-	serviceAddress string
+	bootstrap      *BootstrapEndpoints
 	namespace      string
 	shards         map[int64]Shard
 	ctx            context.Context
 	cancel         context.CancelFunc
 	logger         *slog.Logger
 	requestTimeout time.Duration
+	metrics        *metrics.ShardAssignmentsMetrics
+	retrier        *Retrier
+
+	// Whether the lookups should wait for new assignments, up to the request
+	// timeout, when the shard is not available
+	waitForAssignments bool
+
+	// When no custom strategy is set, the strategy follows the router
+	// announced by the servers
+	followRouter bool
+	router       proto.ShardKeyRouter
+
+	// Cancels the current assignments stream, to force a refresh
+	refreshMutex  sync.Mutex
+	refreshStream context.CancelFunc
+	streamStarted time.Time
 }
 
+// NewShardManager creates a shard manager that keeps track of the shard assignments.
+// If `shardStrategy` is nil, the keys are routed based on the shard key router
+// announced by the servers.
+// If `waitForAssignments` is set, the lookups of shards that are not available
+// wait up to `requestTimeout` for new assignments, before failing.
 func NewShardManager(shardStrategy ShardStrategy, clientPool rpc.ClientPool,
-	serviceAddress string, namespace string, requestTimeout time.Duration) (ShardManager, error) {
+	bootstrap *BootstrapEndpoints, namespace string, requestTimeout time.Duration, waitForAssignments bool,
+	retrier *Retrier, meterProvider metric.MeterProvider) (ShardManager, error) {
 	sm := &shardManagerImpl{
-		namespace:      namespace,
-		shardStrategy:  shardStrategy,
-		clientPool:     clientPool,
-		serviceAddress: serviceAddress,
-		shards:         make(map[int64]Shard),
-		requestTimeout: requestTimeout,
+		namespace:          namespace,
+		shardStrategy:      shardStrategy,
+		followRouter:       shardStrategy == nil,
+		router:             -1,
+		clientPool:         clientPool,
+		bootstrap:          bootstrap,
+		shards:             make(map[int64]Shard),
+		listeners:          make(map[int64]func(ShardAssignmentsUpdate)),
+		requestTimeout:     requestTimeout,
+		waitForAssignments: waitForAssignments,
+		retrier:            retrier,
+		metrics:            metrics.NewShardAssignmentsMetrics(meterProvider),
 		logger: slog.With(
 			slog.String("component", "shardManager"),
 		),
@@ -104,39 +225,131 @@ func (s *shardManagerImpl) start() error {
 	return s.updatedWg.Wait(ctx)
 }
 
-func (s *shardManagerImpl) Get(key string) int64 {
-	s.RLock()
-	defer s.RUnlock()
+func (s *shardManagerImpl) Get(key string) (int64, error) {
+	shardId, ok := lookup(s, func(sa *shardAssignments) (int64, bool) {
+		return sa.get(key)
+	})
+	if !ok {
+		return 0, errors.Wrapf(ErrShardNotAvailable, "no shard is assigned for key %q", key)
+	}
+	return shardId, nil
+}
+
+func (s *shardManagerImpl) Lookup(key string) (int64, bool) {
+	if sa := s.assignments.Load(); sa != nil {
+		return sa.get(key)
+	}
+	return 0, false
+}
+
+func (s *shardManagerImpl) GetAll() []int64 {
+	if sa := s.assignments.Load(); sa != nil {
+		return sa.getAll()
+	}
+	return []int64{}
+}
+
+func (s *shardManagerImpl) GetShards() []Shard {
+	if sa := s.assignments.Load(); sa != nil {
+		return sa.getShards()
+	}
+	return []Shard{}
+}
 
-	predicate := s.shardStrategy.Get(key)
+func (s *shardManagerImpl) Leader(shardId int64) (string, error) {
+	leader, ok := lookup(s, func(sa *shardAssignments) (string, bool) {
+		return sa.leader(shardId)
+	})
+	if !ok {
+		return "", errors.Wrapf(ErrShardNotAvailable, "shard %d is not assigned", shardId)
+	}
+	return leader, nil
+}
+
+func (s *shardManagerImpl) LookupLeader(shardId int64) (string, bool) {
+	if sa := s.assignments.Load(); sa != nil {
+		return sa.leader(shardId)
+	}
+	return "", false
+}
 
-	for _, shard := range s.shards {
-		if predicate(shard) {
-			return shard.Id
+// Applies the lookup function to the current assignments. If nothing is found,
+// and waiting is enabled, the lookup is retried on every new snapshot of the
+// assignments, until the request timeout expires.
+func lookup[T any](s *shardManagerImpl, f func(*shardAssignments) (T, bool)) (T, bool) {
+	var timeout <-chan time.Time
+	for {
+		sa := s.assignments.Load()
+		if sa == nil {
+			var empty T
+			return empty, false
+		}
+		if res, ok := f(sa); ok || !s.waitForAssignments {
+			return res, ok
+		}
+
+		if timeout == nil {
+			timer := time.NewTimer(s.requestTimeout)
+			defer timer.Stop()
+			timeout = timer.C
+		}
+
+		select {
+		case <-sa.replaced:
+		case <-timeout:
+			var empty T
+			return empty, false
+		case <-s.ctx.Done():
+			var empty T
+			return empty, false
 		}
 	}
-	panic("shard not found")
 }
 
-func (s *shardManagerImpl) GetAll() []int64 {
-	s.RLock()
-	defer s.RUnlock()
+func (s *shardManagerImpl) Refresh() {
+	s.refreshMutex.Lock()
+	defer s.refreshMutex.Unlock()
 
-	shardIDs := make([]int64, 0, len(s.shards))
-	for shardId := range s.shards {
-		shardIDs = append(shardIDs, shardId)
+	// A stream that was just established already carries the latest assignments
+	if s.refreshStream == nil || time.Since(s.streamStarted) < minRefreshInterval {
+		return
 	}
-	return shardIDs
+
+	s.logger.Info("Refreshing the shard assignments")
+	s.refreshStream()
+	s.refreshStream = nil
 }
 
-func (s *shardManagerImpl) Leader(shardId int64) string {
-	s.RLock()
-	defer s.RUnlock()
+func (s *shardManagerImpl) AddListener(listener func(ShardAssignmentsUpdate)) func() {
+	s.listenersMutex.Lock()
+	defer s.listenersMutex.Unlock()
+
+	id := s.nextListenerId
+	s.nextListenerId++
+	s.listeners[id] = listener
+
+	return func() {
+		s.listenersMutex.Lock()
+		defer s.listenersMutex.Unlock()
+		delete(s.listeners, id)
+	}
+}
+
+func (s *shardManagerImpl) notifyListeners(update ShardAssignmentsUpdate) {
+	if update.IsEmpty() {
+		return
+	}
 
-	if shard, ok := s.shards[shardId]; ok {
-		return shard.Leader
+	s.listenersMutex.Lock()
+	listeners := make([]func(ShardAssignmentsUpdate), 0, len(s.listeners))
+	for _, listener := range s.listeners {
+		listeners = append(listeners, listener)
+	}
+	s.listenersMutex.Unlock()
+
+	for _, listener := range listeners {
+		listener(update)
 	}
-	panic("shard not found")
 }
 
 func (s *shardManagerImpl) isClosed() bool {
@@ -144,8 +357,9 @@ func (s *shardManagerImpl) isClosed() bool {
 }
 
 func (s *shardManagerImpl) receiveWithRecovery() {
-	backOff := time2.NewBackOff(s.ctx)
-	err := backoff.RetryNotify(
+	operation := RetryOperation{Type: RetryOperationShardAssignments, Idempotent: true}
+	backOff := s.retrier.NewBackOff(s.ctx, operation)
+	err := s.retrier.Retry(operation, backOff,
 		func() error {
 			err := s.receive(backOff)
 			if s.isClosed() {
@@ -182,14 +396,49 @@ func (s *shardManagerImpl) receiveWithRecovery() {
 }
 
 func (s *shardManagerImpl) receive(backOff backoff.BackOff) error {
-	client, err := s.clientPool.GetClientRpc(s.serviceAddress)
+	address, err := s.bootstrap.Next(s.ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = s.receiveFrom(address, backOff); err != nil && !s.isClosed() {
+		// Fail over to a different endpoint on the next attempt
+		s.logger.Info(
+			"Failed receiving shard assignments from bootstrap endpoint",
+			slog.String("address", address),
+			slog.Any("error", err),
+		)
+		s.bootstrap.Failed(address)
+	}
+	return err
+}
+
+func (s *shardManagerImpl) receiveFrom(address string, backOff backoff.BackOff) error {
+	client, err := s.clientPool.GetClientRpc(address)
 	if err != nil {
 		return err
 	}
 
+	for {
+		ctx, cancel := context.WithCancel(s.ctx)
+		s.refreshMutex.Lock()
+		s.refreshStream, s.streamStarted = cancel, time.Now()
+		s.refreshMutex.Unlock()
+
+		err = s.receiveStream(ctx, client, address, backOff)
+		refreshed := ctx.Err() != nil
+		cancel()
+		if !refreshed || s.isClosed() {
+			return err
+		}
+	}
+}
+
+func (s *shardManagerImpl) receiveStream(ctx context.Context, client proto.OxiaClientClient, address string,
+	backOff backoff.BackOff) error {
 	request := proto.ShardAssignmentsRequest{Namespace: s.namespace}
 
-	stream, err := client.GetShardAssignments(s.ctx, &request)
+	stream, err := client.GetShardAssignments(ctx, &request)
 	if err != nil {
 		return err
 	}
@@ -199,25 +448,76 @@ func (s *shardManagerImpl) receive(backOff backoff.BackOff) error {
 		if err != nil {
 			return err
 		}
+		s.bootstrap.Healthy(address)
 
 		assignments, ok := response.Namespaces[s.namespace]
 		if !ok {
 			return errors.New("namespace not found in shards assignments")
 		}
 
+		rs, err := s.strategyForRouter(assignments.ShardKeyRouter)
+		if err != nil {
+			return err
+		}
+
 		shards := make([]Shard, len(assignments.Assignments))
 		for i, assignment := range assignments.Assignments {
-			shards[i] = toShard(assignment)
+			if shards[i], err = toShard(assignment); err != nil {
+				return err
+			}
 		}
-		s.update(shards)
+		s.update(rs, shards)
 		backOff.Reset()
 	}
 }
 
-func (s *shardManagerImpl) update(updates []Shard) {
+type routerStrategy struct {
+	router   proto.ShardKeyRouter
+	strategy ShardStrategy
+}
+
+// Returns the strategy to use for the router announced by the servers, or
+// nil if the current strategy doesn't need to change.
+func (s *shardManagerImpl) strategyForRouter(router proto.ShardKeyRouter) (*routerStrategy, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	if !s.followRouter || router == s.router {
+		return nil, nil
+	}
+
+	strategy, err := NewShardStrategyForRouter(router)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info(
+		"Using shard key router",
+		slog.Any("router", router),
+	)
+	return &routerStrategy{router, strategy}, nil
+}
+
+func (s *shardManagerImpl) update(rs *routerStrategy, updates []Shard) {
+	// Listeners are invoked after releasing the lock, so that they are
+	// free to query the shard manager
+	s.notifyListeners(s.applyUpdate(rs, updates))
+}
+
+func (s *shardManagerImpl) applyUpdate(rs *routerStrategy, updates []Shard) ShardAssignmentsUpdate {
 	s.Lock()
 	defer s.Unlock()
 
+	if rs != nil {
+		s.router = rs.router
+		s.shardStrategy = rs.strategy
+	}
+
+	previous := make(map[int64]Shard, len(s.shards))
+	for shardId, shard := range s.shards {
+		previous[shardId] = shard
+	}
+
 	for _, update := range updates {
 		if _, ok := s.shards[update.Id]; !ok {
 			// delete overlaps
@@ -235,7 +535,76 @@ func (s *shardManagerImpl) update(updates []Shard) {
 		s.shards[update.Id] = update
 	}
 
+	s.publishAssignments()
 	s.updatedWg.Done()
+
+	update := diffShards(previous, s.shards)
+	s.recordUpdate(update)
+	return update
+}
+
+// Makes a new snapshot of the assignments visible to the readers. Must be
+// called with the lock held.
+func (s *shardManagerImpl) publishAssignments() {
+	previousAssignments := s.assignments.Swap(newShardAssignments(s.shardStrategy, s.shards))
+	if previousAssignments != nil {
+		close(previousAssignments.replaced)
+	}
+}
+
+func (s *shardManagerImpl) recordUpdate(update ShardAssignmentsUpdate) {
+	s.metrics.RecordUpdate(len(update.Added), len(update.Removed))
+
+	for _, shard := range update.Added {
+		s.logger.Info(
+			"Shard added",
+			slog.Int64("shard", shard.Id),
+			slog.String("leader", shard.Leader),
+			slog.Any("hash-range", shard.HashRange),
+		)
+	}
+	for _, shard := range update.Removed {
+		s.logger.Info(
+			"Shard removed",
+			slog.Int64("shard", shard.Id),
+			slog.Any("hash-range", shard.HashRange),
+		)
+	}
+	s.recordLeaderChanges(update.LeaderChanges)
+}
+
+func (s *shardManagerImpl) recordLeaderChanges(changes []LeaderChange) {
+	for _, change := range changes {
+		s.metrics.RecordLeaderChange(change.Shard.Id)
+		s.logger.Info(
+			"Shard leader changed",
+			slog.Int64("shard", change.Shard.Id),
+			slog.String("leader", change.Shard.Leader),
+			slog.String("previous-leader", change.PreviousLeader),
+		)
+	}
+}
+
+func diffShards(previous map[int64]Shard, current map[int64]Shard) ShardAssignmentsUpdate {
+	update := ShardAssignmentsUpdate{}
+	for shardId, shard := range current {
+		prev, ok := previous[shardId]
+		switch {
+		case !ok:
+			update.Added = append(update.Added, shard)
+		case prev.Leader != shard.Leader:
+			update.LeaderChanges = append(update.LeaderChanges, LeaderChange{
+				Shard:          shard,
+				PreviousLeader: prev.Leader,
+			})
+		}
+	}
+	for shardId, shard := range previous {
+		if _, ok := current[shardId]; !ok {
+			update.Removed = append(update.Removed, shard)
+		}
+	}
+	return update
 }
 
 func overlap(a HashRange, b HashRange) bool {
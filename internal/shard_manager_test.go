@@ -15,14 +15,21 @@
 package internal
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/metric/noop"
 
+	"github.com/oxia-db/oxia/common/concurrent"
 	"github.com/oxia-db/oxia/common/constant"
 	"github.com/oxia-db/oxia/common/rpc"
 
+	"github.com/oxia-db/oxia-client-golang/internal/metrics"
 	"github.com/oxia-db/oxia/node"
 )
 
@@ -40,20 +47,54 @@ func TestWithStandalone(t *testing.T) {
 	assert.NoError(t, err)
 	defer standaloneServer.Close()
 
+	bootstrap, err := NewBootstrapEndpoints(standaloneServer.ServiceAddr())
+	assert.NoError(t, err)
+
 	clientPool := rpc.NewClientPool(nil, nil)
-	shardManager, err := NewShardManager(&testShardStrategy{}, clientPool, standaloneServer.ServiceAddr(),
-		constant.DefaultNamespace, 30*time.Second)
+	shardManager, err := NewShardManager(&testShardStrategy{}, clientPool, bootstrap,
+		constant.DefaultNamespace, 30*time.Second, false, NewRetrier(NewDefaultRetryPolicy(), noop.NewMeterProvider()),
+		noop.NewMeterProvider())
 	assert.NoError(t, err)
 
 	defer func() {
 		assert.NoError(t, shardManager.Close())
 	}()
 
-	shardId := shardManager.Get("foo")
-
+	shardId, err := shardManager.Get("foo")
+	assert.NoError(t, err)
 	assert.EqualValues(t, 0, shardId)
 }
 
+func TestBootstrapFailover(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+	defer standaloneServer.Close()
+
+	// An endpoint that is not reachable anymore
+	listener, err := net.Listen("tcp", "localhost:0")
+	assert.NoError(t, err)
+	deadAddress := listener.Addr().String()
+	assert.NoError(t, listener.Close())
+
+	bootstrap, err := NewBootstrapEndpoints(deadAddress + "," + standaloneServer.ServiceAddr())
+	assert.NoError(t, err)
+
+	clientPool := rpc.NewClientPool(nil, nil)
+	shardManager, err := NewShardManager(&testShardStrategy{}, clientPool, bootstrap,
+		constant.DefaultNamespace, 30*time.Second, false, NewRetrier(NewDefaultRetryPolicy(), noop.NewMeterProvider()),
+		noop.NewMeterProvider())
+	assert.NoError(t, err)
+
+	defer func() {
+		assert.NoError(t, shardManager.Close())
+	}()
+
+	// The healthy endpoint is remembered
+	address, err := bootstrap.Next(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, standaloneServer.ServiceAddr(), address)
+}
+
 func TestOverlap(t *testing.T) {
 	for _, item := range []struct {
 		a         HashRange
@@ -69,3 +110,183 @@ func TestOverlap(t *testing.T) {
 		assert.Equal(t, overlap(item.a, item.b), item.isOverlap)
 	}
 }
+
+func TestDiffShards(t *testing.T) {
+	previous := map[int64]Shard{
+		0: {Id: 0, Leader: "l0", HashRange: hashRange(0, 9)},
+		1: {Id: 1, Leader: "l1", HashRange: hashRange(10, 19)},
+	}
+	current := map[int64]Shard{
+		0: {Id: 0, Leader: "l0", HashRange: hashRange(0, 9)},
+		2: {Id: 2, Leader: "l1", HashRange: hashRange(10, 14)},
+		3: {Id: 3, Leader: "l1", HashRange: hashRange(15, 19)},
+	}
+
+	update := diffShards(previous, current)
+	assert.False(t, update.IsEmpty())
+	assert.ElementsMatch(t, []Shard{current[2], current[3]}, update.Added)
+	assert.Equal(t, []Shard{previous[1]}, update.Removed)
+
+	assert.True(t, diffShards(current, current).IsEmpty())
+
+	moved := map[int64]Shard{
+		0: {Id: 0, Leader: "l2", HashRange: hashRange(0, 9)},
+		2: current[2],
+		3: current[3],
+	}
+	update = diffShards(current, moved)
+	assert.False(t, update.IsEmpty())
+	assert.Empty(t, update.Added)
+	assert.Empty(t, update.Removed)
+	assert.Equal(t, []LeaderChange{{Shard: moved[0], PreviousLeader: "l0"}}, update.LeaderChanges)
+}
+
+func TestMergeShardAssignmentsUpdates(t *testing.T) {
+	s0 := Shard{Id: 0, Leader: "l0", HashRange: hashRange(0, 9)}
+	s1 := Shard{Id: 1, Leader: "l1", HashRange: hashRange(10, 19)}
+	s2 := Shard{Id: 2, Leader: "l1", HashRange: hashRange(10, 14)}
+	s3 := Shard{Id: 3, Leader: "l1", HashRange: hashRange(15, 19)}
+	moved := func(s Shard, leader string) Shard {
+		s.Leader = leader
+		return s
+	}
+
+	split := ShardAssignmentsUpdate{Added: []Shard{s2, s3}, Removed: []Shard{s1}}
+	leaderChanges := ShardAssignmentsUpdate{LeaderChanges: []LeaderChange{
+		{Shard: moved(s0, "l2"), PreviousLeader: "l0"},
+		{Shard: moved(s2, "l2"), PreviousLeader: "l1"},
+	}}
+	merged := split.Merge(leaderChanges)
+	assert.ElementsMatch(t, []Shard{moved(s2, "l2"), s3}, merged.Added)
+	assert.Equal(t, []Shard{s1}, merged.Removed)
+	assert.Equal(t, []LeaderChange{{Shard: moved(s0, "l2"), PreviousLeader: "l0"}}, merged.LeaderChanges)
+
+	// The leader moves back, and the shards added by the split are removed
+	merged = merged.Merge(ShardAssignmentsUpdate{
+		Added:         []Shard{s1},
+		Removed:       []Shard{moved(s2, "l2"), s3},
+		LeaderChanges: []LeaderChange{{Shard: s0, PreviousLeader: "l2"}},
+	})
+	assert.True(t, merged.IsEmpty())
+}
+
+func TestShardManagerListeners(t *testing.T) {
+	sm := &shardManagerImpl{
+		shards:    make(map[int64]Shard),
+		listeners: make(map[int64]func(ShardAssignmentsUpdate)),
+		updatedWg: concurrent.NewWaitGroup(1),
+		logger:    slog.Default(),
+		metrics:   metrics.NewShardAssignmentsMetrics(noop.NewMeterProvider()),
+	}
+
+	var updates []ShardAssignmentsUpdate
+	remove := sm.AddListener(func(update ShardAssignmentsUpdate) {
+		updates = append(updates, update)
+	})
+
+	sm.update(nil, []Shard{{Id: 0, HashRange: hashRange(0, 9)}})
+	assert.Len(t, updates, 1)
+	assert.Len(t, updates[0].Added, 1)
+
+	// No changes in the set of shards
+	sm.update(nil, []Shard{{Id: 0, HashRange: hashRange(0, 9)}})
+	assert.Len(t, updates, 1)
+
+	// Split
+	sm.update(nil, []Shard{{Id: 1, HashRange: hashRange(0, 4)}, {Id: 2, HashRange: hashRange(5, 9)}})
+	assert.Len(t, updates, 2)
+	assert.Len(t, updates[1].Added, 2)
+	assert.Equal(t, []Shard{{Id: 0, HashRange: hashRange(0, 9)}}, updates[1].Removed)
+
+	// Leader change
+	sm.update(nil, []Shard{{Id: 1, Leader: "l1", HashRange: hashRange(0, 4)}, {Id: 2, HashRange: hashRange(5, 9)}})
+	assert.Len(t, updates, 3)
+	assert.Empty(t, updates[2].Added)
+	assert.Empty(t, updates[2].Removed)
+	assert.Equal(t, []LeaderChange{{Shard: Shard{Id: 1, Leader: "l1", HashRange: hashRange(0, 4)}}}, updates[2].LeaderChanges)
+
+	remove()
+	sm.update(nil, []Shard{{Id: 3, HashRange: hashRange(10, 19)}})
+	assert.Len(t, updates, 3)
+}
+
+func TestShardManagerShardNotAvailable(t *testing.T) {
+	for _, wait := range []bool{false, true} {
+		t.Run(fmt.Sprintf("wait-%v", wait), func(t *testing.T) {
+			sm := &shardManagerImpl{
+				shardStrategy:      &testShardStrategy{},
+				shards:             make(map[int64]Shard),
+				listeners:          make(map[int64]func(ShardAssignmentsUpdate)),
+				updatedWg:          concurrent.NewWaitGroup(1),
+				logger:             slog.Default(),
+				metrics:            metrics.NewShardAssignmentsMetrics(noop.NewMeterProvider()),
+				ctx:                context.Background(),
+				requestTimeout:     100 * time.Millisecond,
+				waitForAssignments: wait,
+			}
+			sm.update(nil, []Shard{{Id: 1, Leader: "l1", HashRange: hashRange(0, 9)}})
+
+			_, err := sm.Get("foo")
+			assert.ErrorIs(t, err, ErrShardNotAvailable)
+
+			_, err = sm.Leader(5)
+			assert.ErrorIs(t, err, ErrShardNotAvailable)
+
+			leader, err := sm.Leader(1)
+			assert.NoError(t, err)
+			assert.Equal(t, "l1", leader)
+		})
+	}
+}
+
+func TestShardManagerWaitForAssignments(t *testing.T) {
+	sm := &shardManagerImpl{
+		shardStrategy:      &testShardStrategy{},
+		shards:             make(map[int64]Shard),
+		listeners:          make(map[int64]func(ShardAssignmentsUpdate)),
+		updatedWg:          concurrent.NewWaitGroup(1),
+		logger:             slog.Default(),
+		metrics:            metrics.NewShardAssignmentsMetrics(noop.NewMeterProvider()),
+		ctx:                context.Background(),
+		requestTimeout:     10 * time.Second,
+		waitForAssignments: true,
+	}
+	sm.update(nil, []Shard{{Id: 1, Leader: "l1", HashRange: hashRange(0, 9)}})
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		sm.update(nil, []Shard{{Id: 2, Leader: "l2", HashRange: hashRange(10, 19)}})
+	}()
+
+	shardId, err := sm.Get("foo")
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, shardId)
+
+	// The lookup of the leader doesn't wait for the assignments
+	leader, ok := sm.LookupLeader(2)
+	assert.True(t, ok)
+	assert.Equal(t, "l2", leader)
+	_, ok = sm.LookupLeader(3)
+	assert.False(t, ok)
+}
+
+func TestShardManagerRefresh(t *testing.T) {
+	sm := &shardManagerImpl{
+		logger: slog.Default(),
+	}
+
+	// No stream
+	sm.Refresh()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sm.refreshStream, sm.streamStarted = cancel, time.Now()
+
+	// The stream was just established
+	sm.Refresh()
+	assert.NoError(t, ctx.Err())
+
+	sm.streamStarted = time.Now().Add(-minRefreshInterval)
+	sm.Refresh()
+	assert.ErrorIs(t, ctx.Err(), context.Canceled)
+	assert.Nil(t, sm.refreshStream)
+}
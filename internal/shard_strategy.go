@@ -14,7 +14,9 @@
 
 package internal
 
+// ShardStrategy decides which shard a key belongs to.
 type ShardStrategy interface {
+	// Get returns a predicate that matches the shard owning the key.
 	Get(key string) func(Shard) bool
 }
 
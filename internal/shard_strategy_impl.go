@@ -15,9 +15,14 @@
 package internal
 
 import (
+	"github.com/pkg/errors"
+
 	"github.com/oxia-db/oxia/common/hash"
+	"github.com/oxia-db/oxia/proto"
 )
 
+var ErrUnknownShardKeyRouter = errors.New("oxia: unknown shard key router")
+
 type shardStrategyImpl struct {
 	hashFunc func(string) uint32
 }
@@ -28,6 +33,22 @@ func NewShardStrategy() ShardStrategy {
 	}
 }
 
+// NewShardStrategyForRouter returns the strategy that implements the shard key
+// router announced by the servers.
+func NewShardStrategyForRouter(router proto.ShardKeyRouter) (ShardStrategy, error) {
+	switch router {
+	case proto.ShardKeyRouter_UNKNOWN, proto.ShardKeyRouter_XXHASH3:
+		// Servers that don't announce the router are using xxhash3
+		return NewShardStrategy(), nil
+	default:
+		return nil, errors.Wrapf(ErrUnknownShardKeyRouter, "router %v", router)
+	}
+}
+
+func (s *shardStrategyImpl) Hash(key string) uint32 {
+	return s.hashFunc(key)
+}
+
 func (s *shardStrategyImpl) Get(key string) func(Shard) bool {
 	code := s.hashFunc(key)
 	return func(shard Shard) bool {
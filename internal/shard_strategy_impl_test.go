@@ -18,6 +18,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/oxia-db/oxia/proto"
 )
 
 func TestShardStrategy(t *testing.T) {
@@ -48,3 +50,15 @@ func TestShardStrategy(t *testing.T) {
 		assert.Equal(t, item.match, predicate(shard))
 	}
 }
+
+func TestNewShardStrategyForRouter(t *testing.T) {
+	for _, router := range []proto.ShardKeyRouter{proto.ShardKeyRouter_UNKNOWN, proto.ShardKeyRouter_XXHASH3} {
+		strategy, err := NewShardStrategyForRouter(router)
+		assert.NoError(t, err)
+		assert.NotNil(t, strategy)
+	}
+
+	strategy, err := NewShardStrategyForRouter(proto.ShardKeyRouter(100))
+	assert.ErrorIs(t, err, ErrUnknownShardKeyRouter)
+	assert.Nil(t, strategy)
+}
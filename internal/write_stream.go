@@ -31,13 +31,15 @@ type streamWrapper struct {
 	sync.Mutex
 
 	stream          proto.OxiaClient_WriteStreamClient
+	cancel          context.CancelFunc
 	pendingRequests []concurrent.Future[*proto.WriteResponse]
 	failed          atomic.Bool
 }
 
-func newStreamWrapper(shard int64, stream proto.OxiaClient_WriteStreamClient) *streamWrapper {
+func newStreamWrapper(shard int64, stream proto.OxiaClient_WriteStreamClient, cancel context.CancelFunc) *streamWrapper {
 	sw := &streamWrapper{
 		stream:          stream,
+		cancel:          cancel,
 		pendingRequests: nil,
 	}
 
@@ -68,6 +70,19 @@ func (sw *streamWrapper) Send(ctx context.Context, req *proto.WriteRequest) (*pr
 	return f.Wait(ctx)
 }
 
+// Pending returns the number of requests that are waiting for a response.
+func (sw *streamWrapper) Pending() int {
+	sw.Lock()
+	defer sw.Unlock()
+	return len(sw.pendingRequests)
+}
+
+// Close terminates the stream. The pending requests are failed.
+func (sw *streamWrapper) Close() {
+	sw.failed.Store(true)
+	sw.cancel()
+}
+
 func (sw *streamWrapper) handleStreamClosed() {
 	<-sw.stream.Context().Done()
 
@@ -88,6 +103,12 @@ func (sw *streamWrapper) handleResponses() {
 		sw.Lock()
 
 		if err != nil {
+			// Report the error from the server to the pending requests, so
+			// that they can decide whether to retry
+			for _, f := range sw.pendingRequests {
+				f.Fail(err)
+			}
+			sw.pendingRequests = nil
 			sw.failed.Store(true)
 			sw.Unlock()
 			return
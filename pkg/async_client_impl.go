@@ -19,20 +19,25 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"sync"
+	"time"
 
+	"github.com/cenkalti/backoff/v4"
 	"github.com/pkg/errors"
 	"go.uber.org/multierr"
 
 	"github.com/oxia-db/oxia/common/concurrent"
+	"github.com/oxia-db/oxia/common/process"
 	"github.com/oxia-db/oxia/common/rpc"
-	commonbatch "github.com/oxia-db/oxia/oxia/batch"
+	time2 "github.com/oxia-db/oxia/common/time"
 
+	"github.com/oxia-db/oxia-client-golang/internal"
+	"github.com/oxia-db/oxia-client-golang/internal/batch"
+	"github.com/oxia-db/oxia-client-golang/internal/metrics"
+	"github.com/oxia-db/oxia-client-golang/internal/model"
+	commonbatch "github.com/oxia-db/oxia-client-golang/pkg/batch"
 	"github.com/oxia-db/oxia/common/compare"
-	"github.com/oxia-db/oxia/oxia/internal"
-	"github.com/oxia-db/oxia/oxia/internal/batch"
-	"github.com/oxia-db/oxia/oxia/internal/metrics"
-	"github.com/oxia-db/oxia/oxia/internal/model"
 	"github.com/oxia-db/oxia/proto"
 )
 
@@ -42,13 +47,45 @@ type clientImpl struct {
 	shardManager      internal.ShardManager
 	writeBatchManager *batch.Manager
 	readBatchManager  *batch.Manager
+	pendingLimiter    *batch.PendingLimiter
+	retrier           *internal.Retrier
 	executor          internal.Executor
 	sessions          *sessions
 	notifications     []*notifications
+	operations        *pendingOperations
 
+	// Only set when the re-registration of the ephemeral records is enabled
+	ephemerals *ephemeralRegistry
+	leases     map[*lease]struct{}
+
+	clientPool rpc.ClientPool
+	// The pool is owned by a [MultiNamespaceClient], if shared
+	sharedClientPool bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// The resources that can be shared by the clients of multiple namespaces.
+type clientResources struct {
+	bootstrap  *internal.BootstrapEndpoints
 	clientPool rpc.ClientPool
-	ctx        context.Context
-	cancel     context.CancelFunc
+	metrics    *metrics.Metrics
+	retrier    *internal.Retrier
+}
+
+func newClientResources(options clientOptions) (*clientResources, error) {
+	bootstrap, err := internal.NewBootstrapEndpoints(options.serviceAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	return &clientResources{
+		bootstrap:  bootstrap,
+		clientPool: rpc.NewClientPool(options.tls, options.authentication),
+		metrics:    metrics.NewMetrics(options.meterProvider),
+		retrier:    internal.NewRetrier(options.retryPolicy, options.meterProvider),
+	}, nil
 }
 
 // NewAsyncClient creates a new Oxia client with the async interface
@@ -56,6 +93,10 @@ type clientImpl struct {
 // ServiceAddress is the target host:port of any Oxia server to bootstrap the client. It is used for establishing the
 // shard assignments. Ideally this should be a load-balanced endpoint.
 //
+// Multiple bootstrap targets can be passed as a comma-separated list. Besides host:port addresses, the targets can be
+// `dns:///host:port`, resolved to all the addresses of the host, or `srv:///name`, resolved through DNS SRV records.
+// If the current endpoint fails, the client fails over to the next one.
+//
 // A list of ClientOption arguments can be passed to configure the Oxia client.
 // Example:
 //
@@ -66,46 +107,178 @@ func NewAsyncClient(serviceAddress string, opts ...ClientOption) (AsyncClient, e
 		return nil, err
 	}
 
-	clientPool := rpc.NewClientPool(options.tls, options.authentication)
+	resources, err := newClientResources(options)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := newAsyncClient(options, resources, false)
+	if err != nil {
+		return nil, multierr.Append(err, resources.clientPool.Close())
+	}
+	return c, nil
+}
 
-	shardManager, err := internal.NewShardManager(internal.NewShardStrategy(), clientPool, serviceAddress,
-		options.namespace, options.requestTimeout)
+func newAsyncClient(options clientOptions, resources *clientResources, sharedClientPool bool) (*clientImpl, error) {
+	shardManager, err := internal.NewShardManager(options.shardStrategy, resources.clientPool, resources.bootstrap,
+		options.namespace, options.requestTimeout, options.waitForShardAssignments, resources.retrier, options.meterProvider)
 	if err != nil {
 		return nil, err
 	}
 
+	clientMetrics := resources.metrics
+	if sharedClientPool {
+		// Tell apart the operations of the namespaces that share the metrics
+		clientMetrics = clientMetrics.WithNamespace(options.namespace)
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
-	executor := internal.NewExecutor(ctx, options.namespace, clientPool, shardManager, options.serviceAddress)
+	executor := internal.NewExecutor(ctx, options.namespace, resources.clientPool, shardManager, resources.bootstrap,
+		options.writeStreamsPerShard)
 	batcherFactory := batch.NewBatcherFactory(
 		executor,
 		options.namespace,
 		options.batchLinger,
+		options.adaptiveBatchLinger,
 		options.maxRequestsPerBatch,
-		metrics.NewMetrics(options.meterProvider),
+		clientMetrics,
+		resources.retrier,
 		options.requestTimeout)
+
+	var limiter *batch.PendingLimiter
+	if options.maxPendingBytes > 0 || options.maxPendingRequests > 0 {
+		limiter = batch.NewPendingLimiter(options.maxPendingBytes, options.maxPendingRequests,
+			options.backpressurePolicy == BackpressureFailFast, options.requestTimeout, options.meterProvider)
+	}
+
 	c := &clientImpl{
-		options:      options,
-		clientPool:   clientPool,
-		shardManager: shardManager,
+		options:          options,
+		clientPool:       resources.clientPool,
+		sharedClientPool: sharedClientPool,
+		shardManager:     shardManager,
 		writeBatchManager: batch.NewManager(ctx, func(ctx context.Context, shard *int64) commonbatch.Batcher {
-			return batcherFactory.NewWriteBatcher(ctx, shard, options.maxBatchSize)
-		}),
-		readBatchManager: batch.NewManager(ctx, batcherFactory.NewReadBatcher),
-		executor:         executor,
+			return batcherFactory.NewWriteBatcher(ctx, shard, options.maxBatchSize, options.coalesceWrites,
+				options.writeStreamsPerShard)
+		}, limiter),
+		readBatchManager: batch.NewManager(ctx, func(ctx context.Context, shard *int64) commonbatch.Batcher {
+			return batcherFactory.NewReadBatcher(ctx, shard, options.maxReadBatchSize, options.streamReads)
+		}, limiter),
+		pendingLimiter: limiter,
+		retrier:        resources.retrier,
+		executor:       executor,
+		operations:     newPendingOperations(),
+		leases:         map[*lease]struct{}{},
+	}
+
+	if options.reRegisterEphemerals {
+		c.ephemerals = newEphemeralRegistry()
 	}
 
 	c.ctx, c.cancel = ctx, cancel
-	c.sessions = newSessions(c.ctx, c.shardManager, c.clientPool, c.options)
+	c.sessions = newSessions(c.ctx, c.shardManager, c.clientPool, c.retrier, c.options, c.onSessionEvent)
 	return c, nil
 }
 
+func (c *clientImpl) onSessionEvent(event SessionEvent) {
+	if event.Type == SessionExpired && c.ephemerals != nil {
+		records := c.ephemerals.take(event.Shard)
+		if len(records) > 0 {
+			go process.DoWithLabels(
+				c.ctx,
+				map[string]string{
+					"oxia":  "ephemerals-re-register",
+					"shard": fmt.Sprintf("%d", event.Shard),
+				},
+				func() { c.reRegisterEphemerals(records) },
+			)
+		}
+	}
+
+	if c.options.sessionEventListener != nil {
+		c.options.sessionEventListener(event)
+	}
+}
+
+// Re-creates the ephemeral records that were lost with an expired session. The
+// new records will be tied to a new session.
+func (c *clientImpl) reRegisterEphemerals(records []*ephemeralRecord) {
+	for _, r := range records {
+		err := backoff.RetryNotify(func() error {
+			res := <-c.Put(r.key, r.value, r.options...)
+			if errors.Is(res.Err, ErrUnexpectedVersionId) {
+				return backoff.Permanent(res.Err)
+			}
+			return res.Err
+		}, time2.NewBackOff(c.ctx), func(err error, duration time.Duration) {
+			slog.Warn(
+				"Failed to re-create ephemeral record, retrying later",
+				slog.String("key", r.key),
+				slog.Any("error", err),
+				slog.Duration("retry-after", duration),
+			)
+		})
+
+		switch {
+		case errors.Is(err, ErrUnexpectedVersionId):
+			slog.Warn(
+				"Ephemeral record was not re-created, since the key already exists",
+				slog.String("key", r.key),
+			)
+		case err != nil:
+			if c.ctx.Err() != nil {
+				return
+			}
+			slog.Error(
+				"Failed to re-create ephemeral record",
+				slog.String("key", r.key),
+				slog.Any("error", err),
+			)
+		default:
+			slog.Info(
+				"Re-created ephemeral record",
+				slog.String("key", r.key),
+			)
+		}
+	}
+}
+
+func (c *clientImpl) Flush(ctx context.Context) error {
+	// The operations that are still waiting for their shard, their session or
+	// for room among the pending requests reach the batchers after they are
+	// flushed, so they're waited for separately
+	wait := c.operations.flush()
+	if err := multierr.Combine(
+		c.writeBatchManager.Flush(ctx),
+		c.readBatchManager.Flush(ctx),
+	); err != nil {
+		return err
+	}
+	return wait(ctx)
+}
+
+func (c *clientImpl) CloseWithContext(ctx context.Context) error {
+	// The writes must be acknowledged before the sessions are closed, since
+	// that deletes the ephemeral records
+	err := c.Flush(ctx)
+	return multierr.Append(err, c.Close())
+}
+
 func (c *clientImpl) Close() error {
+	// The batchers are closed first, so that no more writes are sent once the
+	// sessions are closed
 	err := multierr.Combine(
-		c.sessions.Close(),
 		c.writeBatchManager.Close(),
 		c.readBatchManager.Close(),
-		c.clientPool.Close(),
+		c.revokeLeases(),
+		c.sessions.Close(),
+		c.shardManager.Close(),
 	)
+	if c.pendingLimiter != nil {
+		err = multierr.Append(err, c.pendingLimiter.Close())
+	}
+	if !c.sharedClientPool {
+		err = multierr.Append(err, c.clientPool.Close())
+	}
 	c.cancel()
 
 	err = multierr.Append(err, c.closeNotifications())
@@ -114,14 +287,23 @@ func (c *clientImpl) Close() error {
 
 func (c *clientImpl) Put(key string, value []byte, options ...PutOption) <-chan PutResult {
 	ch := make(chan PutResult, 1)
+	done := c.operations.start()
 
+	var opts *putOptions
+	shardId := unknownShard
 	callback := func(response *proto.PutResponse, err error) {
 		if err != nil {
-			ch <- PutResult{Err: err}
+			ch <- PutResult{Err: c.newError(operationPut, key, shardId, err)}
 		} else {
-			ch <- toPutResult(key, response)
+			res := toPutResult(key, response)
+			if res.Err == nil {
+				c.trackEphemeral(shardId, key, value, opts)
+			}
+			res.Err = c.newError(operationPut, key, shardId, res.Err)
+			ch <- res
 		}
 		close(ch)
+		done()
 	}
 
 	opts, err := newPutOptions(options)
@@ -130,7 +312,19 @@ func (c *clientImpl) Put(key string, value []byte, options ...PutOption) <-chan
 		return ch
 	}
 
-	shardId := c.getShardForKey(key, opts)
+	c.withShardForKey(key, opts, func(id int64, err error) {
+		if err != nil {
+			callback(nil, err)
+			return
+		}
+		shardId = id
+		c.doPut(shardId, key, value, opts, callback)
+	})
+	return ch
+}
+
+func (c *clientImpl) doPut(shardId int64, key string, value []byte, opts *putOptions,
+	callback func(*proto.PutResponse, error)) {
 	putCall := model.PutCall{
 		Key:                key,
 		Value:              value,
@@ -139,10 +333,22 @@ func (c *clientImpl) Put(key string, value []byte, options ...PutOption) <-chan
 		PartitionKey:       opts.partitionKey,
 		Callback:           callback,
 		SecondaryIndexes:   toSecondaryIndexes(opts.secondaryIndexes),
+		Priority:           opts.priority,
+		Context:            opts.ctx,
 	}
 	if opts.ephemeral {
+		executeWithSessionId := c.sessions.executeWithSessionId
+		if opts.lease != nil {
+			l, ok := opts.lease.(*lease)
+			if !ok || l.client != c {
+				callback(nil, errors.Wrap(ErrInvalidOptions, "the lease was not granted by this client"))
+				return
+			}
+			executeWithSessionId = l.executeWithSessionId
+		}
+
 		putCall.ClientIdentity = &c.options.identity
-		c.sessions.executeWithSessionId(shardId, func(sessionId int64, err error) {
+		executeWithSessionId(shardId, func(sessionId int64, err error) {
 			if err != nil {
 				callback(nil, err)
 				return
@@ -153,35 +359,109 @@ func (c *clientImpl) Put(key string, value []byte, options ...PutOption) <-chan
 	} else {
 		c.writeBatchManager.Get(shardId).Add(putCall)
 	}
-	return ch
+}
+
+// Keeps track of the ephemeral records that were successfully written, in
+// order to re-create them if their session expires.
+func (c *clientImpl) trackEphemeral(shardId int64, key string, value []byte, opts *putOptions) {
+	if c.ephemerals == nil {
+		return
+	}
+
+	if opts.ephemeral && opts.lease == nil {
+		c.ephemerals.add(shardId, key, value, opts)
+	} else {
+		c.ephemerals.remove(key)
+	}
+}
+
+func (c *clientImpl) GrantLease(ctx context.Context, ttl time.Duration) (Lease, error) {
+	if ttl <= 0 {
+		return nil, errors.Wrap(ErrInvalidOptions, "lease TTL must be greater than zero")
+	}
+
+	l := newLease(c, ttl)
+	if err := l.start(ctx); err != nil {
+		l.revoked.Store(true)
+		return nil, multierr.Append(errors.Wrap(err, "failed to grant lease"), l.sessions.Close())
+	}
+
+	c.Lock()
+	defer c.Unlock()
+	c.leases[l] = struct{}{}
+	return l, nil
+}
+
+func (c *clientImpl) removeLease(l *lease) {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.leases, l)
+}
+
+func (c *clientImpl) revokeLeases() error {
+	c.Lock()
+	leases := make([]*lease, 0, len(c.leases))
+	for l := range c.leases {
+		leases = append(leases, l)
+	}
+	c.Unlock()
+
+	var err error
+	for _, l := range leases {
+		err = multierr.Append(err, l.Revoke())
+	}
+	return err
 }
 
 func (c *clientImpl) Delete(key string, options ...DeleteOption) <-chan error {
 	ch := make(chan error, 1)
+	done := c.operations.start()
+	shardId := unknownShard
 	callback := func(response *proto.DeleteResponse, err error) {
-		if err != nil {
-			ch <- err
-		} else {
-			ch <- toDeleteResult(response)
+		if err == nil {
+			err = toDeleteResult(response)
+		}
+		// The record is only forgotten once it's gone, otherwise it still
+		// has to be re-created if its session expires
+		if c.ephemerals != nil && (err == nil || errors.Is(err, ErrKeyNotFound)) {
+			c.ephemerals.remove(key)
 		}
+		ch <- c.newError(operationDelete, key, shardId, err)
 		close(ch)
+		done()
 	}
 	opts := newDeleteOptions(options)
-	shardId := c.getShardForKey(key, opts)
-	c.writeBatchManager.Get(shardId).Add(model.DeleteCall{
-		Key:               key,
-		ExpectedVersionId: opts.expectedVersion,
-		Callback:          callback,
+	c.withShardForKey(key, opts, func(id int64, err error) {
+		if err != nil {
+			callback(nil, err)
+			return
+		}
+		shardId = id
+		c.writeBatchManager.Get(shardId).Add(model.DeleteCall{
+			Key:               key,
+			ExpectedVersionId: opts.expectedVersion,
+			Priority:          opts.priority,
+			Context:           opts.ctx,
+			Callback:          callback,
+		})
 	})
 	return ch
 }
 
 func (c *clientImpl) DeleteRange(minKeyInclusive string, maxKeyExclusive string, options ...DeleteRangeOption) <-chan error {
 	ch := make(chan error, 1)
+	done := c.operations.start()
 	opts := newDeleteRangeOptions(options)
 	if opts.partitionKey != nil {
-		shardId := c.getShardForKey("", opts)
-		c.doSingleShardDeleteRange(shardId, minKeyInclusive, maxKeyExclusive, ch)
+		c.withShardForKey("", opts, func(shardId int64, err error) {
+			if err != nil {
+				ch <- c.newError(operationDeleteRange, "", unknownShard, err)
+				close(ch)
+				done()
+				return
+			}
+			c.doSingleShardDeleteRange(shardId, minKeyInclusive, maxKeyExclusive, opts, ch, done)
+		})
 		return ch
 	}
 
@@ -190,13 +470,16 @@ func (c *clientImpl) DeleteRange(minKeyInclusive string, maxKeyExclusive string,
 	wg := concurrent.NewWaitGroup(len(shardIDs))
 
 	for _, shardId := range shardIDs {
+		shardId := shardId
 		// chInner := make(chan error, 1)
 		c.writeBatchManager.Get(shardId).Add(model.DeleteRangeCall{
 			MinKeyInclusive: minKeyInclusive,
 			MaxKeyExclusive: maxKeyExclusive,
+			Priority:        opts.priority,
+			Context:         opts.ctx,
 			Callback: func(response *proto.DeleteRangeResponse, err error) {
 				if err != nil {
-					wg.Fail(err)
+					wg.Fail(c.newError(operationDeleteRange, "", shardId, err))
 					return
 				}
 
@@ -204,60 +487,91 @@ func (c *clientImpl) DeleteRange(minKeyInclusive string, maxKeyExclusive string,
 				case proto.Status_OK:
 					wg.Done()
 				default:
-					wg.Fail(toError(response.Status))
+					wg.Fail(c.newError(operationDeleteRange, "", shardId, toError(response.Status)))
 				}
 			},
 		})
 	}
 	go func() {
-		ch <- wg.Wait(c.ctx)
+		err := wg.Wait(c.ctx)
+		if err == nil {
+			c.removeEphemeralRange(minKeyInclusive, maxKeyExclusive)
+		}
+		ch <- err
 		close(ch)
+		done()
 	}()
 	return ch
 }
 
-func (c *clientImpl) doSingleShardDeleteRange(shardId int64, minKeyInclusive string, maxKeyExclusive string, ch chan error) {
+func (c *clientImpl) doSingleShardDeleteRange(shardId int64, minKeyInclusive string, maxKeyExclusive string,
+	opts *deleteRangeOptions, ch chan error, done func()) {
 	c.writeBatchManager.Get(shardId).Add(model.DeleteRangeCall{
 		MinKeyInclusive: minKeyInclusive,
 		MaxKeyExclusive: maxKeyExclusive,
+		Priority:        opts.priority,
+		Context:         opts.ctx,
 		Callback: func(response *proto.DeleteRangeResponse, err error) {
-			if err != nil {
-				ch <- err
-			} else {
-				ch <- toDeleteRangeResult(response)
+			if err == nil {
+				err = toDeleteRangeResult(response)
 			}
-
+			if err == nil {
+				c.removeEphemeralRange(minKeyInclusive, maxKeyExclusive)
+			}
+			ch <- c.newError(operationDeleteRange, "", shardId, err)
 			close(ch)
+			done()
 		},
 	})
 }
 
+// The records are only forgotten once they're gone, otherwise they still have
+// to be re-created if their session expires.
+func (c *clientImpl) removeEphemeralRange(minKeyInclusive string, maxKeyExclusive string) {
+	if c.ephemerals != nil {
+		c.ephemerals.removeRange(minKeyInclusive, maxKeyExclusive)
+	}
+}
+
 func (c *clientImpl) Get(key string, options ...GetOption) <-chan GetResult {
-	ch := make(chan GetResult)
+	ch := make(chan GetResult, 1)
+	done := c.operations.start()
 
 	opts := newGetOptions(options)
 	if opts.partitionKey == nil && //
 		(opts.comparisonType != proto.KeyComparisonType_EQUAL ||
 			opts.secondaryIndexName != nil) {
-		c.doMultiShardGet(key, opts, ch)
+		c.doMultiShardGet(key, opts, ch, done)
 	} else {
-		c.doSingleShardGet(key, opts, ch)
+		c.doSingleShardGet(key, opts, ch, done)
 	}
 
 	return ch
 }
 
-func (c *clientImpl) doSingleShardGet(key string, opts *getOptions, ch chan GetResult) {
-	shardId := c.getShardForKey(key, opts)
-	c.readBatchManager.Get(shardId).Add(model.GetCall{
-		Key:                key,
-		ComparisonType:     opts.comparisonType,
-		IncludeValue:       opts.includeValue,
-		SecondaryIndexName: opts.secondaryIndexName,
-		Callback: func(response *proto.GetResponse, err error) {
-			ch <- toGetResult(response, key, err)
+func (c *clientImpl) doSingleShardGet(key string, opts *getOptions, ch chan GetResult, done func()) {
+	c.withShardForKey(key, opts, func(shardId int64, err error) {
+		if err != nil {
+			ch <- toGetResult(nil, key, c.newError(operationGet, key, unknownShard, err))
 			close(ch)
-		},
+			done()
+			return
+		}
+		c.readBatchManager.Get(shardId).Add(model.GetCall{
+			Key:                key,
+			ComparisonType:     opts.comparisonType,
+			IncludeValue:       opts.includeValue,
+			SecondaryIndexName: opts.secondaryIndexName,
+			Priority:           opts.priority,
+			Context:            opts.ctx,
+			Callback: func(response *proto.GetResponse, err error) {
+				res := toGetResult(response, key, err)
+				res.Err = c.newError(operationGet, key, shardId, res.Err)
+				ch <- res
+				close(ch)
+				done()
+			},
+		})
 	})
 }
 
@@ -313,10 +627,11 @@ func selectResponse(kc proto.KeyComparisonType, selected *proto.GetResponse, res
 }
 
 // The keys might get hashed to multiple shards, so we have to check on all shards and then compare the results.
-func (c *clientImpl) doMultiShardGet(key string, options *getOptions, ch chan GetResult) {
+func (c *clientImpl) doMultiShardGet(key string, options *getOptions, ch chan GetResult, done func()) {
 	if err := validateComparisonType(options.comparisonType); err != nil {
-		ch <- toGetResult(nil, key, err)
+		ch <- toGetResult(nil, key, c.newError(operationGet, key, unknownShard, err))
 		close(ch)
+		done()
 		return
 	}
 
@@ -326,11 +641,14 @@ func (c *clientImpl) doMultiShardGet(key string, options *getOptions, ch chan Ge
 	selected := keyNotFound
 
 	for _, shardId := range shards {
+		shardId := shardId
 		c.readBatchManager.Get(shardId).Add(model.GetCall{
 			Key:                key,
 			ComparisonType:     options.comparisonType,
 			IncludeValue:       options.includeValue,
 			SecondaryIndexName: options.secondaryIndexName,
+			Priority:           options.priority,
+			Context:            options.ctx,
 			Callback: func(response *proto.GetResponse, err error) {
 				m.Lock()
 				defer m.Unlock()
@@ -341,8 +659,9 @@ func (c *clientImpl) doMultiShardGet(key string, options *getOptions, ch chan Ge
 				}
 
 				if err != nil {
-					ch <- toGetResult(nil, key, err)
+					ch <- toGetResult(nil, key, c.newError(operationGet, key, shardId, err))
 					close(ch)
+					done()
 					counter = 0
 				}
 
@@ -352,6 +671,7 @@ func (c *clientImpl) doMultiShardGet(key string, options *getOptions, ch chan Ge
 				if counter == 0 {
 					ch <- toGetResult(selected, key, nil)
 					close(ch)
+					done()
 				}
 			},
 		})
@@ -369,7 +689,7 @@ func (c *clientImpl) listFromShard(ctx context.Context, minKeyInclusive string,
 
 	client, err := c.executor.ExecuteList(ctx, request)
 	if err != nil {
-		ch <- ListResult{Err: err}
+		ch <- ListResult{Err: c.newError(operationList, "", shardId, err)}
 		return
 	}
 
@@ -380,7 +700,7 @@ func (c *clientImpl) listFromShard(ctx context.Context, minKeyInclusive string,
 				return
 			}
 
-			ch <- ListResult{Err: err}
+			ch <- ListResult{Err: c.newError(operationList, "", shardId, err)}
 			return
 		}
 
@@ -394,9 +714,12 @@ func (c *clientImpl) List(ctx context.Context, minKeyInclusive string, maxKeyExc
 	opts := newListOptions(options)
 	if opts.partitionKey != nil {
 		// If the partition key is specified, we only need to make the request to one shard
-		shardId := c.getShardForKey("", opts)
 		go func() {
-			c.listFromShard(ctx, minKeyInclusive, maxKeyExclusive, shardId, opts.secondaryIndexName, ch)
+			if shardId, err := c.getShardForKey("", opts); err != nil {
+				ch <- ListResult{Err: c.newError(operationList, "", unknownShard, err)}
+			} else {
+				c.listFromShard(ctx, minKeyInclusive, maxKeyExclusive, shardId, opts.secondaryIndexName, ch)
+			}
 			close(ch)
 		}()
 	} else {
@@ -433,7 +756,7 @@ func (c *clientImpl) rangeScanFromShard(ctx context.Context, minKeyInclusive str
 
 	client, err := c.executor.ExecuteRangeScan(ctx, request)
 	if err != nil {
-		ch <- GetResult{Err: err}
+		ch <- GetResult{Err: c.newError(operationRangeScan, "", shardId, err)}
 		return
 	}
 
@@ -446,7 +769,7 @@ func (c *clientImpl) rangeScanFromShard(ctx context.Context, minKeyInclusive str
 				return
 			}
 
-			ch <- GetResult{Err: err}
+			ch <- GetResult{Err: c.newError(operationRangeScan, "", shardId, err)}
 			return
 		}
 
@@ -462,8 +785,13 @@ func (c *clientImpl) RangeScan(ctx context.Context, minKeyInclusive string, maxK
 	opts := newRangeScanOptions(options)
 	if opts.partitionKey != nil {
 		// If the partition key is specified, we only need to make the request to one shard
-		shardId := c.getShardForKey("", opts)
 		go func() {
+			shardId, err := c.getShardForKey("", opts)
+			if err != nil {
+				outCh <- GetResult{Err: c.newError(operationRangeScan, "", unknownShard, err)}
+				close(outCh)
+				return
+			}
 			c.rangeScanFromShard(ctx, minKeyInclusive, maxKeyExclusive, shardId, opts.secondaryIndexName, outCh)
 		}()
 	} else {
@@ -492,7 +820,7 @@ func (c *clientImpl) GetSequenceUpdates(ctx context.Context, prefixKey string, o
 		return nil, errors.Wrap(ErrInvalidOptions, "partitionKey is required")
 	}
 
-	return newSequenceUpdates(ctx, prefixKey, *opts.partitionKey, c.clientPool, c.shardManager), nil
+	return newSequenceUpdates(ctx, prefixKey, *opts.partitionKey, c.clientPool, c.shardManager, c.retrier), nil
 }
 
 // We do range scan on all the shards, and we need to always pick the lowest key
@@ -545,7 +873,7 @@ func (c *clientImpl) closeNotifications() error {
 	return err
 }
 
-func (c *clientImpl) getShardForKey(key string, options baseOptionsIf) int64 {
+func (c *clientImpl) getShardForKey(key string, options baseOptionsIf) (int64, error) {
 	if options.PartitionKey() != nil {
 		return c.shardManager.Get(*options.PartitionKey())
 	}
@@ -553,8 +881,42 @@ func (c *clientImpl) getShardForKey(key string, options baseOptionsIf) int64 {
 	return c.shardManager.Get(key)
 }
 
-func (c *clientImpl) GetNotifications() (Notifications, error) {
-	nm, err := newNotifications(c.ctx, c.options, c.clientPool, c.shardManager)
+// Resolves the shard for the key and passes it to `f`. If the shard is not known
+// yet and the client waits for the shard assignments, the wait happens in the
+// background, so that the asynchronous operations never block the caller.
+func (c *clientImpl) withShardForKey(key string, options baseOptionsIf, f func(shardId int64, err error)) {
+	if options.PartitionKey() != nil {
+		key = *options.PartitionKey()
+	}
+
+	if shardId, ok := c.shardManager.Lookup(key); ok {
+		f(shardId, nil)
+		return
+	}
+
+	if !c.options.waitForShardAssignments {
+		f(c.shardManager.Get(key))
+		return
+	}
+
+	go process.DoWithLabels(
+		c.ctx,
+		map[string]string{
+			"oxia": "wait-for-shard-assignments",
+		},
+		func() {
+			f(c.shardManager.Get(key))
+		},
+	)
+}
+
+func (c *clientImpl) GetNotifications(options ...NotificationsOption) (Notifications, error) {
+	opts, err := newNotificationsOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	nm, err := newNotifications(c.ctx, c.options, opts, c.clientPool, c.shardManager, c.retrier)
 	if err != nil {
 		return nil, errors.Wrap(err, "Failed to create notification stream")
 	}
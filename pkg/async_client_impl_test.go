@@ -24,7 +24,9 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc/codes"
 
+	"github.com/oxia-db/oxia-client-golang/internal"
 	"github.com/oxia-db/oxia/common/logging"
 	"github.com/oxia-db/oxia/node"
 )
@@ -955,3 +957,133 @@ func TestGetWithoutValue(t *testing.T) {
 	assert.Nil(t, result.Value)
 	assert.Equal(t, result.Key, keys[0])
 }
+
+type countingShardStrategy struct {
+	calls atomic.Int64
+}
+
+func (s *countingShardStrategy) Get(_ string) func(Shard) bool {
+	s.calls.Add(1)
+	return func(shard Shard) bool {
+		return shard.Id == 0
+	}
+}
+
+func TestAsyncClientImpl_ShardStrategy(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+	defer standaloneServer.Close()
+
+	_, err = NewSyncClient(standaloneServer.ServiceAddr(), WithShardStrategy(nil))
+	assert.ErrorIs(t, err, ErrInvalidOptionShardStrategy)
+
+	strategy := &countingShardStrategy{}
+	client, err := NewSyncClient(standaloneServer.ServiceAddr(), WithShardStrategy(strategy))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	_, _, err = client.Put(ctx, "/a", []byte("0"))
+	assert.NoError(t, err)
+	_, value, _, err := client.Get(ctx, "/a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("0"), value)
+	assert.Positive(t, strategy.calls.Load())
+
+	assert.NoError(t, client.Close())
+}
+
+func TestAsyncClientImpl_FlushAndCloseWithContext(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+
+	// The linger is long enough that the writes are still queued when the
+	// flush starts
+	client, err := NewAsyncClient(standaloneServer.ServiceAddr(), WithBatchLinger(10*time.Second))
+	assert.NoError(t, err)
+
+	putA := client.Put("/a", []byte{0})
+	assert.NoError(t, client.Flush(context.Background()))
+	select {
+	case r := <-putA:
+		assert.NoError(t, r.Err)
+	default:
+		assert.Fail(t, "put not completed after the flush")
+	}
+
+	putB := client.Put("/b", []byte{1})
+	assert.NoError(t, client.CloseWithContext(context.Background()))
+	assert.NoError(t, (<-putB).Err)
+
+	client, err = NewAsyncClient(standaloneServer.ServiceAddr())
+	assert.NoError(t, err)
+	getB := <-client.Get("/b")
+	assert.NoError(t, getB.Err)
+	assert.Equal(t, []byte{1}, getB.Value)
+
+	assert.NoError(t, client.Close())
+	assert.NoError(t, standaloneServer.Close())
+}
+
+func TestAsyncClientImpl_Errors(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+
+	client, err := NewAsyncClient(standaloneServer.ServiceAddr())
+	assert.NoError(t, err)
+
+	// The expected outcomes are not wrapped
+	getResult := <-client.Get("/missing")
+	assert.Equal(t, ErrKeyNotFound, getResult.Err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	putResult := <-client.Put("/a", []byte{0}, WithContext(ctx))
+	assert.ErrorIs(t, putResult.Err, context.Canceled)
+
+	var oxiaErr *Error
+	assert.ErrorAs(t, putResult.Err, &oxiaErr)
+	assert.Equal(t, operationPut, oxiaErr.Operation)
+	assert.Equal(t, "/a", oxiaErr.Key)
+	assert.EqualValues(t, 0, oxiaErr.ShardId)
+	assert.NotEmpty(t, oxiaErr.Leader)
+	assert.Equal(t, codes.Canceled, oxiaErr.Code)
+	// The call was dropped before its batch was sent
+	assert.Equal(t, 0, oxiaErr.Attempts)
+	assert.False(t, oxiaErr.Retriable)
+
+	assert.NoError(t, client.Close())
+	assert.NoError(t, standaloneServer.Close())
+}
+
+type waitingShardManager struct {
+	internal.ShardManager
+	assigned chan struct{}
+}
+
+func (*waitingShardManager) Lookup(string) (int64, bool) {
+	return 0, false
+}
+
+func (s *waitingShardManager) Get(string) (int64, error) {
+	<-s.assigned
+	return 5, nil
+}
+
+func TestAsyncClientImpl_WaitForShardInBackground(t *testing.T) {
+	c := &clientImpl{
+		shardManager: &waitingShardManager{assigned: make(chan struct{})},
+		options:      clientOptions{waitForShardAssignments: true},
+		ctx:          context.Background(),
+	}
+
+	resolved := make(chan int64, 1)
+	// Returns right away, while the shard is not known yet
+	c.withShardForKey("/a", &baseOptions{}, func(shardId int64, err error) {
+		assert.NoError(t, err)
+		resolved <- shardId
+	})
+	assert.Empty(t, resolved)
+
+	close(c.shardManager.(*waitingShardManager).assigned)
+	assert.EqualValues(t, 5, <-resolved)
+}
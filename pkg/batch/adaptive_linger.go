@@ -0,0 +1,68 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch
+
+import (
+	"sync"
+	"time"
+)
+
+// The smallest increment of an adaptive linger. Shorter windows are not
+// worth setting up a timer for.
+const adaptiveLingerMinStep = 50 * time.Microsecond
+
+// Adapts the time a batch waits for more calls to the observed load: the
+// window doubles while the calls keep queuing up behind the batches in flight,
+// and it shrinks back to zero when the load goes away. The window never exceeds
+// the configured maximum, nor the recent execution time of the batches.
+type adaptiveLinger struct {
+	// The batches are completed concurrently when they're pipelined
+	sync.Mutex
+	max     time.Duration
+	current time.Duration
+	avgExec time.Duration
+}
+
+func newAdaptiveLinger(maxLinger time.Duration) *adaptiveLinger {
+	return &adaptiveLinger{max: maxLinger}
+}
+
+func (l *adaptiveLinger) window() time.Duration {
+	l.Lock()
+	defer l.Unlock()
+	return l.current
+}
+
+// Updates the window after a batch was executed. `queued` tells whether more
+// calls arrived while the batch was in flight.
+func (l *adaptiveLinger) update(execTime time.Duration, queued bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.avgExec == 0 {
+		l.avgExec = execTime
+	} else {
+		l.avgExec = (7*l.avgExec + execTime) / 8
+	}
+
+	if queued {
+		l.current = min(max(2*l.current, adaptiveLingerMinStep), l.max, l.avgExec)
+	} else {
+		l.current /= 2
+	}
+	if l.current < adaptiveLingerMinStep {
+		l.current = 0
+	}
+}
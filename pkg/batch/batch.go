@@ -21,3 +21,22 @@ type Batch interface {
 	Complete()
 	Fail(error)
 }
+
+// KeyedBatch is implemented by the batches that can be in flight along with
+// other batches, as long as they don't share any key with them. The other
+// batches are always sent one at a time.
+type KeyedBatch interface {
+	Batch
+	// Keys returns the keys of the calls in the batch. `all` is set when the
+	// calls can affect any key, like a range of keys does.
+	Keys() (keys []string, all bool)
+}
+
+// KeyedCall is implemented by the calls that write some keys. A high priority
+// call doesn't overtake the normal calls on the same keys that are not
+// completed yet.
+type KeyedCall interface {
+	// CallKey returns the key of the call. `all` is set when the call can
+	// affect any key, like a range of keys does.
+	CallKey() (key string, all bool)
+}
@@ -15,27 +15,68 @@
 package batch
 
 import (
+	"context"
 	"errors"
 	"io"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
 var ErrShuttingDown = errors.New("shutting down")
 
+// Priority of a call in the batcher. The high priority calls are sent in
+// batches of their own, ahead of the normal ones.
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+)
+
+// PrioritizedCall is implemented by the calls that carry a priority. The other
+// calls have the normal priority.
+type PrioritizedCall interface {
+	CallPriority() Priority
+}
+
+// The number of high priority batches that can be sent in a row, before the
+// normal calls get a chance to be sent.
+const maxHighPriorityBatchesInARow = 8
+
 type Batcher interface {
 	io.Closer
 	Add(request any)
+	// Flush waits until all the calls added so far are completed.
+	Flush(ctx context.Context) error
 	Run()
 }
 
+// A barrier in the queue of calls. It's released once all the calls ahead of
+// it are completed.
+type flushCall struct {
+	done chan struct{}
+}
+
 type batcherImpl struct {
 	batchFactory        func() Batch
 	callC               chan any
+	highPriorityC       chan any
 	closeC              chan bool
 	closed              atomic.Bool
 	linger              time.Duration
 	maxRequestsPerBatch int
+
+	// Held for reading while a call is being queued, so that the queues are
+	// only drained on close once no more calls can be sent to them
+	addMutex sync.RWMutex
+	// The keys of the calls in the normal lane
+	pendingKeys pendingKeys
+
+	// Only set when the linger adapts to the load
+	adaptiveLinger *adaptiveLinger
+	// Only set when more than one batch can be in flight at once
+	pipeline *pipeline
 }
 
 func (b *batcherImpl) Close() error {
@@ -45,26 +86,147 @@ func (b *batcherImpl) Close() error {
 }
 
 func (b *batcherImpl) Add(call any) {
+	b.addMutex.RLock()
+	defer b.addMutex.RUnlock()
+
 	if b.closed.Load() {
 		b.failCall(call, ErrShuttingDown)
-	} else {
-		b.callC <- call
+		return
+	}
+
+	// A high priority call doesn't overtake the normal calls on its keys
+	if isHighPriority(call) && !b.pendingKeys.conflicts(call) {
+		select {
+		case b.highPriorityC <- call:
+		case <-b.closeC:
+			b.failCall(call, ErrShuttingDown)
+		}
+		return
+	}
+
+	b.pendingKeys.add(call)
+	select {
+	case b.callC <- call:
+	case <-b.closeC:
+		b.pendingKeys.remove(call)
+		b.failCall(call, ErrShuttingDown)
+	}
+}
+
+func isHighPriority(call any) bool {
+	c, ok := call.(PrioritizedCall)
+	return ok && c.CallPriority() >= PriorityHigh
+}
+
+func (b *batcherImpl) Flush(ctx context.Context) error {
+	flushes, err := b.addFlushes(ctx)
+	if err != nil {
+		return err
 	}
+
+	for _, flush := range flushes {
+		select {
+		case <-flush.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Adds a barrier to each lane.
+func (b *batcherImpl) addFlushes(ctx context.Context) ([]flushCall, error) {
+	b.addMutex.RLock()
+	defer b.addMutex.RUnlock()
+
+	if b.closed.Load() {
+		return nil, ErrShuttingDown
+	}
+
+	flushes := []flushCall{{done: make(chan struct{})}, {done: make(chan struct{})}}
+	for i, lane := range []chan any{b.callC, b.highPriorityC} {
+		select {
+		case lane <- flushes[i]:
+		case <-b.closeC:
+			// The barriers already queued are released once the queues
+			// are drained
+			return nil, ErrShuttingDown
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return flushes, nil
 }
 
 func (b *batcherImpl) failCall(call any, err error) {
+	if flush, ok := call.(flushCall); ok {
+		// The calls ahead of the barrier have all been failed
+		close(flush.done)
+		return
+	}
+
 	batch := b.batchFactory()
 	batch.Add(call)
 	batch.Fail(err)
 }
 
+// Sends the batch. Unless the batches are pipelined, it waits for the batch to
+// be completed.
+func (b *batcherImpl) complete(batch Batch) {
+	if b.pipeline == nil {
+		batch.Complete()
+		return
+	}
+	b.pipeline.send(batch)
+}
+
+func (b *batcherImpl) newNormalBatch() *normalBatch {
+	return &normalBatch{Batch: b.batchFactory(), pending: &b.pendingKeys}
+}
+
+// Sends a batch of the normal lane. Unless the batches are pipelined, it waits
+// for the batch to be completed, while the high priority calls keep being sent.
+func (b *batcherImpl) completeNormal(batch Batch) {
+	if b.pipeline != nil {
+		b.pipeline.send(batch)
+		return
+	}
+
+	completed := make(chan struct{})
+	go func() {
+		batch.Complete()
+		close(completed)
+	}()
+	for {
+		select {
+		case <-completed:
+			return
+		case call := <-b.highPriorityC:
+			b.sendHighPriority(call)
+		}
+	}
+}
+
+// Releases the barrier, once all the batches in flight are completed.
+func (b *batcherImpl) releaseFlush(flush flushCall) {
+	if b.pipeline != nil {
+		b.pipeline.wait()
+	}
+	close(flush.done)
+}
+
 func (b *batcherImpl) Run() { //nolint:revive
+	if b.adaptiveLinger != nil {
+		b.runAdaptive()
+		return
+	}
+
 	var batch Batch
 	var timer *time.Timer
 	var timeout <-chan time.Time
 
 	newBatch := func() {
-		batch = b.batchFactory()
+		batch = b.newNormalBatch()
 		if b.linger > 0 {
 			timer = time.NewTimer(b.linger)
 			timeout = timer.C
@@ -74,13 +236,27 @@ func (b *batcherImpl) Run() { //nolint:revive
 		if b.linger > 0 {
 			timer.Stop()
 		}
-		batch.Complete()
+		b.completeNormal(batch)
 		batch = nil
 	}
 
 	for {
+		b.sendQueuedHighPriority()
+
 		select {
+		case call := <-b.highPriorityC:
+			b.sendHighPriority(call)
+
 		case call := <-b.callC:
+			if flush, ok := call.(flushCall); ok {
+				// The calls ahead of the barrier are all completed after
+				// this batch and the ones in flight
+				if batch != nil {
+					completeBatch()
+				}
+				b.releaseFlush(flush)
+				continue
+			}
 			if batch == nil {
 				newBatch()
 			}
@@ -97,7 +273,7 @@ func (b *batcherImpl) Run() { //nolint:revive
 		case <-timeout:
 			if batch != nil {
 				timer.Stop()
-				batch.Complete()
+				b.completeNormal(batch)
 				batch = nil
 			}
 		case <-b.closeC:
@@ -106,14 +282,166 @@ func (b *batcherImpl) Run() { //nolint:revive
 				batch.Fail(ErrShuttingDown)
 				batch = nil
 			}
-			for {
-				select {
-				case call := <-b.callC:
-					b.failCall(call, ErrShuttingDown)
-				default:
-					return
-				}
+			b.failQueuedCalls()
+			return
+		}
+	}
+}
+
+func (b *batcherImpl) failQueuedCalls() {
+	// Waits for the calls that are being queued, which give up once the
+	// batcher is closed
+	b.addMutex.Lock()
+	defer b.addMutex.Unlock()
+
+	for {
+		select {
+		case call := <-b.highPriorityC:
+			b.failCall(call, ErrShuttingDown)
+		case call := <-b.callC:
+			b.pendingKeys.remove(call)
+			b.failCall(call, ErrShuttingDown)
+		default:
+			return
+		}
+	}
+}
+
+// Sends the high priority calls that are queued, ahead of the normal ones. The
+// number of batches sent in a row is bounded, so that a steady flow of high
+// priority calls can't starve the normal ones.
+func (b *batcherImpl) sendQueuedHighPriority() {
+	for i := 0; i < maxHighPriorityBatchesInARow; i++ {
+		select {
+		case call := <-b.highPriorityC:
+			b.sendHighPriority(call)
+		default:
+			return
+		}
+	}
+}
+
+// Sends a batch of high priority calls, starting from the given one, with the
+// other ones that are already queued. These batches don't linger.
+func (b *batcherImpl) sendHighPriority(call any) {
+	if flush, ok := call.(flushCall); ok {
+		b.releaseFlush(flush)
+		return
+	}
+
+	batch := b.batchFactory()
+	batch.Add(call)
+
+	for batch.Size() < b.maxRequestsPerBatch {
+		var next any
+		select {
+		case next = <-b.highPriorityC:
+		default:
+			b.complete(batch)
+			return
+		}
+
+		if flush, ok := next.(flushCall); ok {
+			b.complete(batch)
+			b.releaseFlush(flush)
+			return
+		}
+
+		if !batch.CanAdd(next) {
+			b.complete(batch)
+			batch = b.batchFactory()
+		}
+		batch.Add(next)
+	}
+
+	b.complete(batch)
+}
+
+// Runs the batcher with a linger that adapts to the load. When the batcher
+// is idle, the calls are sent right away. Calls that arrive while a batch is
+// in flight are sent together in the next batch, and the time a batch waits
+// for more calls grows for as long as the batches keep finding queued calls.
+func (b *batcherImpl) runAdaptive() {
+	for {
+		b.sendQueuedHighPriority()
+
+		select {
+		case call := <-b.highPriorityC:
+			b.sendHighPriority(call)
+		case call := <-b.callC:
+			if flush, ok := call.(flushCall); ok {
+				b.releaseFlush(flush)
+				continue
 			}
+			if !b.collectAndComplete(call) {
+				b.failQueuedCalls()
+				return
+			}
+		case <-b.closeC:
+			b.failQueuedCalls()
+			return
 		}
 	}
 }
+
+// Collects the calls of a new batch, starting from the given one, and then
+// executes it. Returns false if the batcher was closed in the meantime.
+func (b *batcherImpl) collectAndComplete(call any) bool {
+	batch := b.newNormalBatch()
+	batch.Add(call)
+
+	var timeout <-chan time.Time
+	if window := b.adaptiveLinger.window(); window > 0 {
+		timer := time.NewTimer(window)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+collect:
+	for batch.Size() < b.maxRequestsPerBatch {
+		var next any
+		select {
+		case next = <-b.callC:
+		default:
+			if timeout == nil {
+				break collect
+			}
+			select {
+			case next = <-b.callC:
+			case call := <-b.highPriorityC:
+				// Not held back by the normal batch that is being collected
+				b.sendHighPriority(call)
+				continue
+			case <-timeout:
+				break collect
+			case <-b.closeC:
+				batch.Fail(ErrShuttingDown)
+				return false
+			}
+		}
+
+		if flush, ok := next.(flushCall); ok {
+			b.completeAdaptive(batch)
+			b.releaseFlush(flush)
+			return true
+		}
+
+		if !batch.CanAdd(next) {
+			b.completeAdaptive(batch)
+			batch = b.newNormalBatch()
+		}
+		batch.Add(next)
+	}
+
+	b.completeAdaptive(batch)
+	return true
+}
+
+// The linger is updated once the response of the batch arrives, which is after
+// this returns when the batches are pipelined.
+func (b *batcherImpl) completeAdaptive(batch *normalBatch) {
+	batch.completed = func(execTime time.Duration) {
+		b.adaptiveLinger.update(execTime, len(b.callC) > 0)
+	}
+	b.completeNormal(batch)
+}
@@ -28,16 +28,37 @@ var batcherChannelBufferSize = runtime.GOMAXPROCS(-1)
 type BatcherFactory struct {
 	Linger              time.Duration
 	MaxRequestsPerBatch int
+	// When set, the linger adapts to the load, and Linger is its maximum
+	AdaptiveLinger bool
 }
 
 func (b *BatcherFactory) NewBatcher(ctx context.Context, shard int64, batcherType string, batchFactory func() Batch) Batcher {
+	return b.NewPipelinedBatcher(ctx, shard, batcherType, 1, batchFactory)
+}
+
+// NewPipelinedBatcher creates a batcher that keeps up to `maxInFlight` batches
+// in flight at once. The batches that don't implement [KeyedBatch], or that
+// share a key with a batch in flight, wait for the batches in flight to be
+// completed.
+func (b *BatcherFactory) NewPipelinedBatcher(ctx context.Context, shard int64, batcherType string, maxInFlight int,
+	batchFactory func() Batch) Batcher {
 	batcher := &batcherImpl{
 		batchFactory:        batchFactory,
 		callC:               make(chan any, batcherChannelBufferSize),
+		highPriorityC:       make(chan any, batcherChannelBufferSize),
 		closeC:              make(chan bool),
 		linger:              b.Linger,
 		maxRequestsPerBatch: b.MaxRequestsPerBatch,
 	}
+	if b.AdaptiveLinger {
+		batcher.adaptiveLinger = newAdaptiveLinger(b.Linger)
+	}
+	if maxInFlight > 1 {
+		batcher.pipeline = newPipeline(ctx, map[string]string{
+			"oxia":  fmt.Sprintf("batch-%s", batcherType),
+			"shard": fmt.Sprintf("%d", shard),
+		}, maxInFlight)
+	}
 
 	go process.DoWithLabels(ctx, map[string]string{
 		"oxia":  fmt.Sprintf("batcher-%s", batcherType),
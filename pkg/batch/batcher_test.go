@@ -16,6 +16,8 @@ package batch
 
 import (
 	"context"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -96,3 +98,463 @@ func TestBatcher(t *testing.T) {
 		})
 	}
 }
+
+// A batch that records its calls, and whose completion can be held back.
+type blockingBatch struct {
+	calls   []any
+	release chan struct{}
+	done    chan []any
+}
+
+func (b *blockingBatch) CanAdd(any) bool { return true }
+
+func (b *blockingBatch) Add(call any) { b.calls = append(b.calls, call) }
+
+func (b *blockingBatch) Size() int { return len(b.calls) }
+
+func (b *blockingBatch) Complete() {
+	<-b.release
+	b.done <- b.calls
+}
+
+func (b *blockingBatch) Fail(error) {}
+
+func TestBatcher_AdaptiveLinger(t *testing.T) {
+	release := make(chan struct{})
+	done := make(chan []any, 10)
+	batcher := &batcherImpl{
+		batchFactory: func() Batch {
+			return &blockingBatch{release: release, done: done}
+		},
+		callC:               make(chan any, 10),
+		highPriorityC:       make(chan any, 10),
+		closeC:              make(chan bool),
+		linger:              1 * time.Second,
+		maxRequestsPerBatch: 10,
+		adaptiveLinger:      newAdaptiveLinger(1 * time.Second),
+	}
+	go batcher.Run()
+
+	// Nothing in flight, the call is sent right away
+	batcher.Add(1)
+
+	// The calls that arrive while the batch is in flight are sent together
+	time.Sleep(50 * time.Millisecond)
+	batcher.Add(2)
+	batcher.Add(3)
+	batcher.Add(4)
+
+	release <- struct{}{}
+	assert.Equal(t, []any{1}, <-done)
+	release <- struct{}{}
+	assert.Equal(t, []any{2, 3, 4}, <-done)
+
+	assert.NoError(t, batcher.Close())
+}
+
+func TestBatcher_AdaptiveLingerPipelined(t *testing.T) {
+	started := make(chan any, 1)
+	release := map[any]chan struct{}{normalWrite("a/1"): make(chan struct{})}
+	linger := newAdaptiveLinger(1 * time.Second)
+	batcher := &batcherImpl{
+		batchFactory: func() Batch {
+			return &releasedBatch{started: started, release: release}
+		},
+		callC:               make(chan any, 10),
+		highPriorityC:       make(chan any, 10),
+		closeC:              make(chan bool),
+		maxRequestsPerBatch: 10,
+		adaptiveLinger:      linger,
+		pipeline:            newPipeline(context.Background(), nil, 2),
+	}
+	go batcher.Run()
+
+	// The execution time goes from the send of the batch to its response,
+	// even though the batcher doesn't wait for it
+	batcher.Add(normalWrite("a/1"))
+	<-started
+	time.Sleep(50 * time.Millisecond)
+	close(release[normalWrite("a/1")])
+
+	assert.NoError(t, batcher.Flush(context.Background()))
+	linger.Lock()
+	assert.GreaterOrEqual(t, linger.avgExec, 50*time.Millisecond)
+	linger.Unlock()
+
+	assert.NoError(t, batcher.Close())
+}
+
+func TestBatcher_Flush(t *testing.T) {
+	for _, adaptive := range []bool{false, true} {
+		release := make(chan struct{})
+		done := make(chan []any, 10)
+		batcher := &batcherImpl{
+			batchFactory: func() Batch {
+				return &blockingBatch{release: release, done: done}
+			},
+			callC:               make(chan any, 10),
+			highPriorityC:       make(chan any, 10),
+			closeC:              make(chan bool),
+			linger:              1 * time.Second,
+			maxRequestsPerBatch: 10,
+		}
+		if adaptive {
+			batcher.adaptiveLinger = newAdaptiveLinger(1 * time.Second)
+		}
+		go batcher.Run()
+
+		batcher.Add(1)
+		batcher.Add(2)
+
+		// The batch is lingering, or in flight, so the flush can't complete
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		assert.ErrorIs(t, batcher.Flush(ctx), context.DeadlineExceeded)
+		cancel()
+
+		flushed := make(chan error)
+		go func() {
+			flushed <- batcher.Flush(context.Background())
+		}()
+
+		// The batches are sent without waiting for the linger
+	releaseBatches:
+		for {
+			select {
+			case release <- struct{}{}:
+			case err := <-flushed:
+				assert.NoError(t, err)
+				break releaseBatches
+			}
+		}
+
+		// All the calls ahead of the flush were completed
+		var completed []any
+		for len(done) > 0 {
+			completed = append(completed, <-done...)
+		}
+		assert.Equal(t, []any{1, 2}, completed)
+
+		assert.NoError(t, batcher.Close())
+		assert.ErrorIs(t, batcher.Flush(context.Background()), ErrShuttingDown)
+	}
+}
+
+// A batch that counts the calls that were completed or failed.
+type countingBatch struct {
+	calls int
+	done  *atomic.Int64
+}
+
+func (*countingBatch) CanAdd(any) bool { return true }
+
+func (b *countingBatch) Add(any) { b.calls++ }
+
+func (b *countingBatch) Size() int { return b.calls }
+
+func (b *countingBatch) Complete() { b.done.Add(int64(b.calls)) }
+
+func (b *countingBatch) Fail(error) { b.done.Add(int64(b.calls)) }
+
+func TestBatcher_AddWhileClosing(t *testing.T) {
+	done := &atomic.Int64{}
+	batcher := &batcherImpl{
+		batchFactory: func() Batch {
+			return &countingBatch{done: done}
+		},
+		callC:               make(chan any, 1),
+		highPriorityC:       make(chan any, 1),
+		closeC:              make(chan bool),
+		linger:              1 * time.Hour,
+		maxRequestsPerBatch: 100,
+	}
+
+	// The queue is full, so the second call is blocked until the batcher
+	// is closed
+	batcher.Add(1)
+	added := make(chan struct{})
+	go func() {
+		batcher.Add(2)
+		close(added)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	assert.NoError(t, batcher.Close())
+	go batcher.Run()
+
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "the call added while closing is blocked")
+	}
+
+	// No call is left behind in the queue
+	assert.Eventually(t, func() bool {
+		return done.Load() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Never(t, func() bool {
+		return len(batcher.callC) > 0
+	}, 50*time.Millisecond, 10*time.Millisecond)
+}
+
+type highPriorityCall int
+
+func (highPriorityCall) CallPriority() Priority { return PriorityHigh }
+
+func TestBatcher_Priority(t *testing.T) {
+	release := make(chan struct{})
+	done := make(chan []any, 10)
+	batcher := &batcherImpl{
+		batchFactory: func() Batch {
+			return &blockingBatch{release: release, done: done}
+		},
+		callC:               make(chan any, 10),
+		highPriorityC:       make(chan any, 10),
+		closeC:              make(chan bool),
+		linger:              1 * time.Second,
+		maxRequestsPerBatch: 10,
+	}
+	go batcher.Run()
+
+	// The normal call lingers, while the high priority one is sent right away,
+	// in a batch of its own
+	batcher.Add(1)
+	batcher.Add(highPriorityCall(2))
+
+	release <- struct{}{}
+	assert.Equal(t, []any{highPriorityCall(2)}, <-done)
+
+	go func() {
+		assert.NoError(t, batcher.Flush(context.Background()))
+	}()
+	release <- struct{}{}
+	assert.Equal(t, []any{1}, <-done)
+
+	assert.NoError(t, batcher.Close())
+}
+
+// A write on the key before the "/".
+type normalWrite string
+
+func (w normalWrite) CallKey() (key string, all bool) {
+	key, _, _ = strings.Cut(string(w), "/")
+	return key, false
+}
+
+type highPriorityWrite string
+
+func (highPriorityWrite) CallPriority() Priority { return PriorityHigh }
+
+func (w highPriorityWrite) CallKey() (key string, all bool) {
+	return normalWrite(w).CallKey()
+}
+
+// A batch of a single call, which is completed once the call is released.
+type releasedBatch struct {
+	call    any
+	started chan any
+	release map[any]chan struct{}
+}
+
+func (*releasedBatch) CanAdd(any) bool { return true }
+
+func (b *releasedBatch) Add(call any) { b.call = call }
+
+func (*releasedBatch) Size() int { return 1 }
+
+func (b *releasedBatch) Complete() {
+	b.started <- b.call
+	<-b.release[b.call]
+}
+
+func (*releasedBatch) Fail(error) {}
+
+func TestBatcher_PriorityOrdering(t *testing.T) {
+	for _, adaptive := range []bool{false, true} {
+		calls := []any{normalWrite("a/1"), highPriorityWrite("a/2"), highPriorityWrite("b/1")}
+		started := make(chan any, len(calls))
+		release := make(map[any]chan struct{})
+		for _, call := range calls {
+			release[call] = make(chan struct{})
+		}
+
+		batcher := &batcherImpl{
+			batchFactory: func() Batch {
+				return &releasedBatch{started: started, release: release}
+			},
+			callC:               make(chan any, 10),
+			highPriorityC:       make(chan any, 10),
+			closeC:              make(chan bool),
+			maxRequestsPerBatch: 1,
+		}
+		if adaptive {
+			batcher.adaptiveLinger = newAdaptiveLinger(10 * time.Millisecond)
+		}
+		go batcher.Run()
+
+		batcher.Add(normalWrite("a/1"))
+		assert.Equal(t, normalWrite("a/1"), <-started)
+
+		// While the normal write is in flight, the high priority write on
+		// another key is sent, and the one on the same key waits for it
+		batcher.Add(highPriorityWrite("a/2"))
+		batcher.Add(highPriorityWrite("b/1"))
+		assert.Equal(t, highPriorityWrite("b/1"), <-started)
+		assert.Never(t, func() bool {
+			return len(started) > 0
+		}, 50*time.Millisecond, 10*time.Millisecond)
+
+		close(release[highPriorityWrite("b/1")])
+		close(release[normalWrite("a/1")])
+		assert.Equal(t, highPriorityWrite("a/2"), <-started)
+		close(release[highPriorityWrite("a/2")])
+
+		assert.NoError(t, batcher.Flush(context.Background()))
+		assert.NoError(t, batcher.Close())
+	}
+}
+
+// A batch that is completed once its call is released. Its key is the part of
+// the call before the "/", and the "*" key stands for all the keys.
+type pipelinedBatch struct {
+	call    string
+	started chan string
+	release map[string]chan struct{}
+}
+
+func (b *pipelinedBatch) CanAdd(any) bool { return true }
+
+func (b *pipelinedBatch) Add(call any) { b.call = call.(string) }
+
+func (b *pipelinedBatch) Size() int { return 1 }
+
+func (b *pipelinedBatch) Keys() (keys []string, all bool) {
+	key, _, _ := strings.Cut(b.call, "/")
+	if key == "*" {
+		return nil, true
+	}
+	return []string{key}, false
+}
+
+func (b *pipelinedBatch) Complete() {
+	b.started <- b.call
+	<-b.release[b.call]
+}
+
+func (b *pipelinedBatch) Fail(error) {}
+
+func TestBatcher_Pipeline(t *testing.T) {
+	calls := []string{"a/1", "b/1", "a/2", "*/1", "c/1", "d/1", "e/1", "f/1", "g/1"}
+	started := make(chan string, len(calls))
+	release := make(map[string]chan struct{})
+	for _, call := range calls {
+		release[call] = make(chan struct{})
+	}
+
+	batcher := &batcherImpl{
+		batchFactory: func() Batch {
+			return &pipelinedBatch{started: started, release: release}
+		},
+		callC:               make(chan any, 10),
+		highPriorityC:       make(chan any, 10),
+		closeC:              make(chan bool),
+		maxRequestsPerBatch: 1,
+		pipeline:            newPipeline(context.Background(), nil, 3),
+	}
+	go batcher.Run()
+
+	assertStarted := func(expected ...string) {
+		t.Helper()
+		var actual []string
+		for range expected {
+			select {
+			case call := <-started:
+				actual = append(actual, call)
+			case <-time.After(1 * time.Second):
+				assert.Fail(t, "batch not started")
+				return
+			}
+		}
+		assert.ElementsMatch(t, expected, actual)
+		select {
+		case call := <-started:
+			assert.Fail(t, "unexpected batch started", call)
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
+
+	// The batches of different keys are in flight at once
+	batcher.Add("a/1")
+	batcher.Add("b/1")
+	assertStarted("a/1", "b/1")
+
+	// The batch of a key in flight waits for it
+	batcher.Add("a/2")
+	assertStarted()
+	close(release["b/1"])
+	assertStarted()
+	close(release["a/1"])
+	assertStarted("a/2")
+
+	// The batches of all the keys wait for all the batches in flight, and
+	// they hold back the following ones
+	batcher.Add("*/1")
+	batcher.Add("c/1")
+	assertStarted()
+	close(release["a/2"])
+	assertStarted("*/1")
+
+	// The flush waits for the batches in flight
+	flushed := make(chan error)
+	go func() {
+		flushed <- batcher.Flush(context.Background())
+	}()
+	close(release["*/1"])
+	assertStarted("c/1")
+	close(release["c/1"])
+	assert.NoError(t, <-flushed)
+
+	// No more than the maximum number of batches are in flight
+	batcher.Add("d/1")
+	batcher.Add("e/1")
+	batcher.Add("f/1")
+	batcher.Add("g/1")
+	assertStarted("d/1", "e/1", "f/1")
+	close(release["d/1"])
+	assertStarted("g/1")
+
+	close(release["e/1"])
+	close(release["f/1"])
+	close(release["g/1"])
+	assert.NoError(t, batcher.Close())
+}
+
+func TestAdaptiveLinger(t *testing.T) {
+	l := newAdaptiveLinger(1 * time.Millisecond)
+	assert.Zero(t, l.window())
+
+	// Idle
+	l.update(10*time.Millisecond, false)
+	assert.Zero(t, l.window())
+
+	// The window grows under load, up to the max
+	l.update(10*time.Millisecond, true)
+	assert.Equal(t, adaptiveLingerMinStep, l.window())
+	l.update(10*time.Millisecond, true)
+	assert.Equal(t, 2*adaptiveLingerMinStep, l.window())
+	for i := 0; i < 10; i++ {
+		l.update(10*time.Millisecond, true)
+	}
+	assert.Equal(t, 1*time.Millisecond, l.window())
+
+	// It never exceeds the execution time of the batches
+	for i := 0; i < 50; i++ {
+		l.update(100*time.Microsecond, true)
+	}
+	assert.Less(t, l.window(), 200*time.Microsecond)
+
+	// And it shrinks back once the load goes away
+	for i := 0; i < 10; i++ {
+		l.update(100*time.Microsecond, false)
+	}
+	assert.Zero(t, l.window())
+}
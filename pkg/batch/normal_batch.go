@@ -0,0 +1,122 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch
+
+import (
+	"sync"
+	"time"
+)
+
+// Counts the keys of the calls in the normal lane that are not completed yet.
+// The high priority calls on those keys take the normal lane too, so that
+// they don't overtake them.
+type pendingKeys struct {
+	sync.Mutex
+	keys map[string]int
+	// The number of calls that can affect any key
+	all int
+}
+
+func (p *pendingKeys) add(call any) {
+	keyed, ok := call.(KeyedCall)
+	if !ok {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if key, all := keyed.CallKey(); all {
+		p.all++
+	} else {
+		if p.keys == nil {
+			p.keys = make(map[string]int)
+		}
+		p.keys[key]++
+	}
+}
+
+func (p *pendingKeys) remove(call any) {
+	keyed, ok := call.(KeyedCall)
+	if !ok {
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if key, all := keyed.CallKey(); all {
+		p.all--
+	} else if p.keys[key]--; p.keys[key] == 0 {
+		delete(p.keys, key)
+	}
+}
+
+// conflicts returns whether the call affects any of the pending keys.
+func (p *pendingKeys) conflicts(call any) bool {
+	keyed, ok := call.(KeyedCall)
+	if !ok {
+		return false
+	}
+
+	p.Lock()
+	defer p.Unlock()
+	if p.all > 0 {
+		return true
+	}
+	key, all := keyed.CallKey()
+	if all {
+		return len(p.keys) > 0
+	}
+	return p.keys[key] > 0
+}
+
+// A batch of the calls in the normal lane, which stop holding back the high
+// priority calls on their keys once it's completed or failed.
+type normalBatch struct {
+	Batch
+	pending *pendingKeys
+	calls   []any
+	// Called with the time from the send of the batch to its response, if set
+	completed func(execTime time.Duration)
+}
+
+func (b *normalBatch) Add(call any) {
+	b.Batch.Add(call)
+	b.calls = append(b.calls, call)
+}
+
+func (b *normalBatch) Complete() {
+	start := time.Now()
+	b.Batch.Complete()
+	b.release()
+	if b.completed != nil {
+		b.completed(time.Since(start))
+	}
+}
+
+func (b *normalBatch) Fail(err error) {
+	b.Batch.Fail(err)
+	b.release()
+}
+
+func (b *normalBatch) Keys() (keys []string, all bool) {
+	return batchKeys(b.Batch)
+}
+
+func (b *normalBatch) release() {
+	for _, call := range b.calls {
+		b.pending.remove(call)
+	}
+	b.calls = nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package batch
+
+import (
+	"context"
+	"sync"
+
+	"github.com/oxia-db/oxia/common/process"
+)
+
+// Sends up to a number of batches at once, instead of waiting for each batch
+// to be completed before sending the next one. A batch that shares a key with
+// a batch in flight waits for it, so that the calls of the same key are still
+// completed in order.
+type pipeline struct {
+	sync.Mutex
+	cond *sync.Cond
+
+	ctx         context.Context
+	labels      map[string]string
+	maxInFlight int
+
+	inFlight int
+	// The number of batches in flight for each key
+	keys map[string]int
+	// Whether a batch that affects all the keys is in flight
+	exclusive bool
+	wg        sync.WaitGroup
+}
+
+func newPipeline(ctx context.Context, labels map[string]string, maxInFlight int) *pipeline {
+	p := &pipeline{
+		ctx:         ctx,
+		labels:      labels,
+		maxInFlight: maxInFlight,
+		keys:        make(map[string]int),
+	}
+	p.cond = sync.NewCond(p)
+	return p
+}
+
+// Sends the batch as soon as it doesn't conflict with the batches in flight,
+// and without waiting for it to be completed.
+func (p *pipeline) send(batch Batch) {
+	keys, all := batchKeys(batch)
+
+	p.Lock()
+	for !p.canSend(keys, all) {
+		p.cond.Wait()
+	}
+	p.inFlight++
+	p.exclusive = all
+	for _, key := range keys {
+		p.keys[key]++
+	}
+	p.Unlock()
+
+	p.wg.Add(1)
+	go process.DoWithLabels(p.ctx, p.labels, func() {
+		defer p.wg.Done()
+
+		batch.Complete()
+		p.completed(keys)
+	})
+}
+
+func (p *pipeline) canSend(keys []string, all bool) bool {
+	if p.inFlight >= p.maxInFlight || p.exclusive {
+		return false
+	}
+	if all {
+		return p.inFlight == 0
+	}
+	for _, key := range keys {
+		if p.keys[key] > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *pipeline) completed(keys []string) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.inFlight--
+	p.exclusive = false
+	for _, key := range keys {
+		if p.keys[key]--; p.keys[key] == 0 {
+			delete(p.keys, key)
+		}
+	}
+	p.cond.Broadcast()
+}
+
+// Waits until all the batches in flight are completed.
+func (p *pipeline) wait() {
+	p.wg.Wait()
+}
+
+// The batches that don't report their keys conflict with all the others.
+func batchKeys(batch Batch) (keys []string, all bool) {
+	keyed, ok := batch.(KeyedBatch)
+	if !ok {
+		return nil, true
+	}
+	return keyed.Keys()
+}
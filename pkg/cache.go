@@ -16,6 +16,7 @@ package oxia
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log/slog"
 	"sync"
@@ -26,13 +27,17 @@ import (
 	"github.com/pkg/errors"
 	"go.uber.org/multierr"
 
+	"github.com/oxia-db/oxia/common/compare"
 	"github.com/oxia-db/oxia/common/process"
+
+	"github.com/oxia-db/oxia-client-golang/internal/metrics"
 )
 
 // Cache provides a view of the data stored in Oxia that is locally cached.
 //
 // The cached values are automatically updated when there are updates or
-// deletions.
+// deletions, including the deletion of ranges of keys. When notifications
+// might have been missed, all the cached values are discarded.
 // The cache is storing de-serialized object.
 type Cache[Value any] interface {
 	io.Closer
@@ -67,7 +72,10 @@ type Cache[Value any] interface {
 	// In addition to the value, a version object is also returned, with information
 	// about the record state.
 	// Returns ErrorKeyNotFound if the record does not exist
-	Get(ctx context.Context, key string) (Value, Version, error)
+	//
+	// The [Consistency] option can be used to verify the cached version against the
+	// server.
+	Get(ctx context.Context, key string, options ...CacheGetOption) (Value, Version, error)
 }
 
 // ModifyFunc is the transformation function to apply on ReadModifyUpdate.
@@ -81,44 +89,62 @@ type DeserializeFunc func(data []byte, value any) error
 
 // NewCache creates a new cache object for a specific type
 // Uses the `serializeFunc` and `deserializeFunc` for SerDe.
-func NewCache[T any](client SyncClient, serializeFunc SerializeFunc, deserializeFunc DeserializeFunc) (Cache[T], error) {
+//
+// The sizing and expiration of the cached values can be tuned with the
+// [CacheOption] arguments.
+func NewCache[T any](client SyncClient, serializeFunc SerializeFunc, deserializeFunc DeserializeFunc,
+	options ...CacheOption) (Cache[T], error) {
 	c, ok := client.(*syncClientImpl)
 	if !ok {
 		return nil, errors.New("Invalid client implementation")
 	}
 
+	opts, err := newCacheOptions(options)
+	if err != nil {
+		return nil, err
+	}
+
 	cm, err := c.getCacheManager()
 	if err != nil {
 		return nil, err
 	}
 
-	return newCache[T](cm, serializeFunc, deserializeFunc)
+	return newCache[T](cm, serializeFunc, deserializeFunc, opts)
 }
 
-const (
-	defaultCacheTTL = 5 * time.Minute
-)
-
 type cacheManager struct {
 	sync.Mutex
 
 	client        SyncClient
+	options       clientOptions
 	notifications Notifications
 	caches        []internalCache
 
+	// Shared by all the caches, when a memory budget is configured
+	sharedValueCache *ristretto.Cache
+	nextCacheId      int64
+
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
-func newCacheManager(client SyncClient) (*cacheManager, error) {
+func newCacheManager(client SyncClient, options clientOptions) (*cacheManager, error) {
 	cm := &cacheManager{
-		client: client,
+		client:  client,
+		options: options,
+	}
+
+	if options.cacheMemoryBudget > 0 {
+		var err error
+		if cm.sharedValueCache, err = newValueCache(options.cacheMemoryBudget); err != nil {
+			return nil, err
+		}
 	}
 
 	cm.ctx, cm.cancel = context.WithCancel(context.Background())
 
 	var err error
-	if cm.notifications, err = client.GetNotifications(); err != nil {
+	if cm.notifications, err = client.GetNotifications(NotificationsTopologyEvents(), NotificationsStreamRestartEvents()); err != nil {
 		return nil, errors.Wrap(err, "failed to create notifications client")
 	}
 
@@ -138,6 +164,10 @@ func (cm *cacheManager) run() {
 		select {
 		case n := <-cm.notifications.Ch():
 			if n == nil {
+				if cm.ctx.Err() == nil {
+					slog.Warn("Cache notifications stream was closed, discarding the cached values")
+					cm.invalidateAll()
+				}
 				return
 			}
 			cm.handleNotification(n)
@@ -165,14 +195,31 @@ func (cm *cacheManager) handleNotification(n *Notification) {
 	}
 }
 
-func newCache[T any](cm *cacheManager, serializeFunc SerializeFunc, deserializeFunc DeserializeFunc) (Cache[T], error) {
+func (cm *cacheManager) invalidateAll() {
+	cm.Lock()
+	defer cm.Unlock()
+
+	for _, c := range cm.caches {
+		c.invalidateAll()
+	}
+}
+
+func newCache[T any](cm *cacheManager, serializeFunc SerializeFunc, deserializeFunc DeserializeFunc,
+	options *cacheOptions) (Cache[T], error) {
 	cm.Lock()
 	defer cm.Unlock()
 
-	cache, err := newCacheImpl[T](cm.client, serializeFunc, deserializeFunc)
+	var sharedValueCache *ristretto.Cache
+	if options.maxCost == 0 {
+		sharedValueCache = cm.sharedValueCache
+	}
+
+	cache, err := newCacheImpl[T](cm.client, serializeFunc, deserializeFunc, options, cm.options.requestTimeout,
+		metrics.NewCacheMetrics(cm.options.meterProvider, options.name), sharedValueCache, cm.nextCacheId)
 	if err != nil {
 		return nil, err
 	}
+	cm.nextCacheId++
 	cm.caches = append(cm.caches, cache)
 	return cache, nil
 }
@@ -189,12 +236,40 @@ func (cm *cacheManager) Close() error {
 		err = multierr.Append(err, c.Close())
 	}
 
+	if cm.sharedValueCache != nil {
+		cm.sharedValueCache.Close()
+	}
+
 	return err
 }
 
+func newValueCache(maxCost int64) (*ristretto.Cache, error) {
+	return ristretto.NewCache(&ristretto.Config{
+		// Recommended to be ~10x the number of items in the cache
+		NumCounters: max(maxCost/64, 1000),
+		MaxCost:     maxCost,
+		BufferItems: 64,
+		OnEvict: func(item *ristretto.Item) {
+			if e, ok := item.Value.(evictionListener); ok {
+				e.onEvicted(true)
+			}
+		},
+		OnReject: func(item *ristretto.Item) {
+			if e, ok := item.Value.(evictionListener); ok {
+				e.onEvicted(false)
+			}
+		},
+	})
+}
+
+type evictionListener interface {
+	onEvicted(evicted bool)
+}
+
 type internalCache interface {
 	io.Closer
 	handleNotification(n *Notification)
+	invalidateAll()
 }
 
 type cacheImpl[Value any] struct {
@@ -203,33 +278,150 @@ type cacheImpl[Value any] struct {
 	client          SyncClient
 	serializeFunc   SerializeFunc
 	deserializeFunc DeserializeFunc
+	options         *cacheOptions
+	requestTimeout  time.Duration
+	metrics         *metrics.CacheMetrics
 	valueCache      *ristretto.Cache
+
+	// When the value cache is shared, the keys are prefixed with the id of the cache
+	shared    bool
+	keyPrefix string
+
+	// The value cache cannot be iterated, so we keep track of the cached keys in
+	// order to be able to invalidate ranges of keys
+	keysMutex sync.Mutex
+	keys      map[string]*cacheEntry[Value]
+
+	// The loads from the server that are in progress, by key. When a key is
+	// invalidated, its load in progress is discarded: its result is not cached,
+	// since it might already be stale.
+	loadsMutex sync.Mutex
+	loads      map[string]*loadCall[Value]
+
+	// Bounds the loads, which are not tied to any of their callers
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-func newCacheImpl[Value any](client SyncClient, serializeFunc SerializeFunc, deserializeFunc DeserializeFunc) (*cacheImpl[Value], error) {
+func newCacheImpl[Value any](client SyncClient, serializeFunc SerializeFunc, deserializeFunc DeserializeFunc,
+	options *cacheOptions, requestTimeout time.Duration, cacheMetrics *metrics.CacheMetrics,
+	sharedValueCache *ristretto.Cache, id int64) (*cacheImpl[Value], error) {
 	c := &cacheImpl[Value]{
 		client:          client,
 		serializeFunc:   serializeFunc,
 		deserializeFunc: deserializeFunc,
+		options:         options,
+		requestTimeout:  requestTimeout,
+		metrics:         cacheMetrics,
+		keys:            make(map[string]*cacheEntry[Value]),
+		loads:           make(map[string]*loadCall[Value]),
+	}
+	c.ctx, c.cancel = context.WithCancel(clientContext(client))
+
+	if sharedValueCache != nil {
+		c.valueCache = sharedValueCache
+		c.shared = true
+		c.keyPrefix = fmt.Sprintf("%d:", id)
+		return c, nil
+	}
+
+	maxCost := options.maxCost
+	if maxCost == 0 {
+		maxCost = DefaultCacheMaxCost
 	}
 
 	var err error
-	c.valueCache, err = ristretto.NewCache(&ristretto.Config{
-		NumCounters: 1_000_000,
-		MaxCost:     64 * 1024 * 1024,
-		BufferItems: 64,
-	})
+	c.valueCache, err = newValueCache(maxCost)
 	if err != nil {
 		return nil, err
 	}
 	return c, nil
 }
 
+func (c *cacheImpl[Value]) cacheKey(key string) string {
+	return c.keyPrefix + key
+}
+
+func (c *cacheImpl[Value]) invalidate(key string) {
+	c.loadsMutex.Lock()
+	defer c.loadsMutex.Unlock()
+
+	c.discardLoad(key)
+
+	c.keysMutex.Lock()
+	delete(c.keys, key)
+	c.keysMutex.Unlock()
+
+	c.valueCache.Del(c.cacheKey(key))
+	c.metrics.Invalidated(1)
+}
+
+// Must be called while holding the loadsMutex.
+func (c *cacheImpl[Value]) discardLoad(key string) {
+	if call, found := c.loads[key]; found {
+		call.discarded = true
+		delete(c.loads, key)
+	}
+}
+
+// Invalidates all the cached keys in the range `[minKeyInclusive, maxKeyExclusive)`.
+func (c *cacheImpl[Value]) invalidateRange(minKeyInclusive string, maxKeyExclusive string) {
+	c.invalidateMatching(func(key string) bool {
+		return compare.CompareWithSlash([]byte(key), []byte(minKeyInclusive)) >= 0 &&
+			compare.CompareWithSlash([]byte(key), []byte(maxKeyExclusive)) < 0
+	})
+}
+
+func (c *cacheImpl[Value]) invalidateAll() {
+	c.RLock()
+	defer c.RUnlock()
+
+	c.invalidateMatching(func(string) bool { return true })
+}
+
+func (c *cacheImpl[Value]) invalidateMatching(matches func(key string) bool) {
+	c.loadsMutex.Lock()
+	defer c.loadsMutex.Unlock()
+
+	for key := range c.loads {
+		if matches(key) {
+			c.discardLoad(key)
+		}
+	}
+
+	c.keysMutex.Lock()
+	var keys []string
+	for key := range c.keys {
+		if matches(key) {
+			keys = append(keys, key)
+			delete(c.keys, key)
+		}
+	}
+	c.keysMutex.Unlock()
+
+	for _, key := range keys {
+		c.valueCache.Del(c.cacheKey(key))
+	}
+	c.metrics.Invalidated(len(keys))
+}
+
 func (c *cacheImpl[Value]) handleNotification(n *Notification) {
 	c.RLock()
 	defer c.RUnlock()
 
-	c.valueCache.Del(n.Key)
+	switch n.Type {
+	case KeyRangeRangeDeleted:
+		c.invalidateRange(n.Key, n.KeyRangeEnd)
+	case NotificationsDropped, ShardTopologyChanged:
+		// Some updates might have been missed
+		c.invalidateMatching(func(string) bool { return true })
+	case NotificationsStreamRestarted:
+		if n.OffsetLost {
+			c.invalidateMatching(func(string) bool { return true })
+		}
+	default:
+		c.invalidate(n.Key)
+	}
 }
 
 func (c *cacheImpl[Value]) Put(ctx context.Context, key string, value Value, options ...PutOption) (string, Version, error) {
@@ -240,7 +432,7 @@ func (c *cacheImpl[Value]) Put(ctx context.Context, key string, value Value, opt
 
 	insertedKey, version, err := c.client.Put(ctx, key, data, options...)
 	if !errors.Is(err, ErrUnexpectedVersionId) {
-		c.valueCache.Del(key)
+		c.invalidate(key)
 	}
 
 	return insertedKey, version, err
@@ -248,27 +440,145 @@ func (c *cacheImpl[Value]) Put(ctx context.Context, key string, value Value, opt
 
 func (c *cacheImpl[Value]) Delete(ctx context.Context, key string, options ...DeleteOption) error {
 	err := c.client.Delete(ctx, key, options...)
-	c.valueCache.Del(key)
+	c.invalidate(key)
 	return err
 }
 
-func (c *cacheImpl[Value]) Get(ctx context.Context, key string) (value Value, version Version, err error) {
-	if cachedValue, cached := c.valueCache.Get(key); cached {
-		if cv, present := cachedValue.(cachedResult[Value]).Get(); present {
+func (c *cacheImpl[Value]) Get(ctx context.Context, key string, options ...CacheGetOption) (value Value, version Version, err error) {
+	opts := newCacheGetOptions(c.options, options)
+
+	if e, cached := c.getEntry(key); cached {
+		cv, present := e.result.Get()
+		if opts.consistency == ConsistencyVerified {
+			if valid, err := c.verify(ctx, key, cv, present); err != nil {
+				return value, version, err
+			} else if !valid {
+				c.metrics.Miss()
+				return c.load(ctx, key)
+			}
+		}
+
+		if c.needsRefresh(e) {
+			// Serve the current value while it gets reloaded in the background
+			if _, started := c.startLoad(key); started {
+				c.metrics.Refreshed()
+			}
+		}
+
+		c.metrics.Hit()
+		if present {
 			return cv.value, cv.version, nil
 		}
 
 		return value, version, ErrKeyNotFound
 	}
 
+	c.metrics.Miss()
 	return c.load(ctx, key)
 }
 
+// Returns the cached entry for the key, unless it has expired.
+func (c *cacheImpl[Value]) getEntry(key string) (*cacheEntry[Value], bool) {
+	cachedValue, cached := c.valueCache.Get(c.cacheKey(key))
+	if !cached {
+		return nil, false
+	}
+
+	e := cachedValue.(*cacheEntry[Value])
+	if time.Since(e.loadedAt) >= e.ttl+c.options.staleWhileRevalidate {
+		return nil, false
+	}
+	return e, true
+}
+
+// An entry needs to be refreshed when it's stale, or when it's getting close
+// to the expiration and refresh-ahead is enabled.
+func (c *cacheImpl[Value]) needsRefresh(e *cacheEntry[Value]) bool {
+	age := time.Since(e.loadedAt)
+	if age >= e.ttl {
+		return true
+	}
+	return c.options.refreshAhead > 0 && age >= time.Duration(float64(e.ttl)*c.options.refreshAhead)
+}
+
+// Checks whether the cached result still matches the record stored on the server.
+func (c *cacheImpl[Value]) verify(ctx context.Context, key string, cv valueVersion[Value], present bool) (bool, error) {
+	_, _, version, err := c.client.Get(ctx, key, IncludeValue(false))
+	exists := true
+	if errors.Is(err, ErrKeyNotFound) {
+		exists = false
+	} else if err != nil {
+		return false, err
+	}
+
+	if exists == present && (!exists || version.VersionId == cv.version.VersionId) {
+		return true, nil
+	}
+
+	c.invalidate(key)
+	return false, nil
+}
+
+// Loads the value from the server. Concurrent loads of the same key are
+// collapsed into a single read.
 func (c *cacheImpl[Value]) load(ctx context.Context, key string) (value Value, version Version, err error) {
+	call, _ := c.startLoad(key)
+
+	select {
+	case <-call.done:
+		return call.value, call.version, call.err
+	case <-ctx.Done():
+		return value, version, ctx.Err()
+	}
+}
+
+// Starts loading the key, or joins the load that is already in progress. A load
+// that was discarded by an invalidation of the key is not joined, since its
+// result might be stale.
+func (c *cacheImpl[Value]) startLoad(key string) (call *loadCall[Value], started bool) {
+	c.loadsMutex.Lock()
+	defer c.loadsMutex.Unlock()
+
+	if existing, found := c.loads[key]; found {
+		return existing, false
+	}
+
+	call = &loadCall[Value]{
+		done: make(chan struct{}),
+	}
+	c.loads[key] = call
+
+	go process.DoWithLabels(
+		c.ctx,
+		map[string]string{
+			"oxia": "cache-load",
+		},
+		func() {
+			// The load is shared, so it must not be canceled if the first
+			// caller gives up
+			ctx, cancel := context.WithTimeout(c.ctx, c.requestTimeout)
+			defer cancel()
+
+			call.value, call.version, call.err = c.fetch(ctx, call, key)
+			close(call.done)
+
+			c.loadsMutex.Lock()
+			if c.loads[key] == call {
+				delete(c.loads, key)
+			}
+			c.loadsMutex.Unlock()
+		},
+	)
+
+	return call, true
+}
+
+func (c *cacheImpl[Value]) fetch(ctx context.Context, call *loadCall[Value], key string) (value Value, version Version, err error) {
 	_, data, existingVersion, err := c.client.Get(ctx, key)
 	if errors.Is(err, ErrKeyNotFound) {
-		cr := empty[cachedResult[Value]]()
-		c.valueCache.Set(key, cr, 0)
+		if c.options.negativeTTL > 0 {
+			c.set(call, key, empty[valueVersion[Value]](), int64(len(key)), c.options.negativeTTL)
+		}
 		return value, version, err
 	}
 
@@ -285,10 +595,48 @@ func (c *cacheImpl[Value]) load(ctx context.Context, key string) (value Value, v
 		version: existingVersion,
 	})
 
-	c.valueCache.SetWithTTL(key, cr, int64(len(data)), defaultCacheTTL)
+	c.set(call, key, cr, int64(len(data)), c.options.ttl)
 	return value, existingVersion, nil
 }
 
+// Stores the result of a load in the value cache, unless the load was discarded
+// by an invalidation of the key.
+func (c *cacheImpl[Value]) set(call *loadCall[Value], key string, result Optional[valueVersion[Value]], cost int64, ttl time.Duration) {
+	e := &cacheEntry[Value]{
+		key:      key,
+		result:   cachedResult[Value](result),
+		loadedAt: time.Now(),
+		ttl:      ttl,
+		cache:    c,
+	}
+
+	c.loadsMutex.Lock()
+	defer c.loadsMutex.Unlock()
+
+	if call.discarded {
+		return
+	}
+
+	c.keysMutex.Lock()
+	c.keys[key] = e
+	c.keysMutex.Unlock()
+	// Stale entries are retained for a while longer, to be served while they
+	// get reloaded
+	c.valueCache.SetWithTTL(c.cacheKey(key), e, cost, ttl+c.options.staleWhileRevalidate)
+}
+
+func (c *cacheImpl[Value]) onEvicted(e *cacheEntry[Value], evicted bool) {
+	c.keysMutex.Lock()
+	if c.keys[e.key] == e {
+		delete(c.keys, e.key)
+	}
+	c.keysMutex.Unlock()
+
+	if evicted {
+		c.metrics.Evicted()
+	}
+}
+
 func (c *cacheImpl[Value]) ReadModifyUpdate(ctx context.Context, key string, modifyFunc ModifyFunc[Value]) error {
 	return backoff.Retry(func() error {
 		var optValue Optional[Value]
@@ -326,15 +674,45 @@ func (c *cacheImpl[Value]) ReadModifyUpdate(ctx context.Context, key string, mod
 }
 
 func (c *cacheImpl[Value]) Close() error {
+	// Stop the loads in progress
+	c.cancel()
+
 	c.Lock()
 	defer c.Unlock()
 
-	c.valueCache.Close()
+	// The shared value cache is closed by the cache manager, we only need to
+	// release our entries
+	if c.shared {
+		c.invalidateMatching(func(string) bool { return true })
+	} else {
+		c.valueCache.Close()
+	}
 	return nil
 }
 
 type cachedResult[Value any] Optional[valueVersion[Value]]
 
+type cacheEntry[Value any] struct {
+	key      string
+	result   cachedResult[Value]
+	loadedAt time.Time
+	ttl      time.Duration
+	cache    *cacheImpl[Value]
+}
+
+type loadCall[Value any] struct {
+	// Set when the key is invalidated while loading. Guarded by the loadsMutex.
+	discarded bool
+	done      chan struct{}
+	value     Value
+	version   Version
+	err       error
+}
+
+func (e *cacheEntry[Value]) onEvicted(evicted bool) {
+	e.cache.onEvicted(e, evicted)
+}
+
 type valueVersion[Value any] struct {
 	value   Value
 	version Version
@@ -17,15 +17,20 @@ package oxia
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/metric/noop"
 
 	"github.com/oxia-db/oxia/common/concurrent"
 
+	"github.com/oxia-db/oxia-client-golang/internal/metrics"
 	"github.com/oxia-db/oxia/node"
 )
 
@@ -258,3 +263,322 @@ func TestCache_ConcurrentUpdate(t *testing.T) {
 	assert.NoError(t, cache2.Close())
 	assert.NoError(t, client2.Close())
 }
+
+func TestCache_Options(t *testing.T) {
+	opts, err := newCacheOptions(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultCacheName, opts.name)
+	assert.EqualValues(t, 0, opts.maxCost)
+	assert.Equal(t, DefaultCacheTTL, opts.ttl)
+	assert.Equal(t, DefaultCacheNegativeTTL, opts.negativeTTL)
+
+	opts, err = newCacheOptions([]CacheOption{CacheName("my-cache"), CacheMaxCost(1024),
+		CacheTTL(time.Minute), CacheNegativeTTL(0)})
+	assert.NoError(t, err)
+	assert.Equal(t, "my-cache", opts.name)
+	assert.EqualValues(t, 1024, opts.maxCost)
+	assert.Equal(t, time.Minute, opts.ttl)
+	assert.EqualValues(t, 0, opts.negativeTTL)
+
+	_, err = newCacheOptions([]CacheOption{CacheMaxCost(-1)})
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+	_, err = newCacheOptions([]CacheOption{CacheTTL(0)})
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+	_, err = newCacheOptions([]CacheOption{CacheNegativeTTL(-time.Second)})
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+}
+
+func TestCache_SharedMemoryBudget(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+	defer standaloneServer.Close()
+
+	client, err := NewSyncClient(standaloneServer.ServiceAddr(), WithCacheMemoryBudget(1024*1024))
+	assert.NoError(t, err)
+
+	cache1, err := NewCache[testStruct](client, json.Marshal, json.Unmarshal, CacheName("cache-1"))
+	assert.NoError(t, err)
+	cache2, err := NewCache[string](client, json.Marshal, json.Unmarshal, CacheName("cache-2"))
+	assert.NoError(t, err)
+
+	k := newKey()
+	_, _, err = cache1.Put(context.Background(), k, testStruct{"hello", 1})
+	assert.NoError(t, err)
+
+	// The same key in the 2 caches must not collide in the shared value cache
+	value1, _, err := cache1.Get(context.Background(), k)
+	assert.NoError(t, err)
+	assert.Equal(t, testStruct{"hello", 1}, value1)
+
+	_, _, err = cache2.Get(context.Background(), k)
+	assert.Error(t, err)
+
+	// Closing one cache must not affect the others sharing the budget
+	assert.NoError(t, cache2.Close())
+
+	value1, _, err = cache1.Get(context.Background(), k)
+	assert.NoError(t, err)
+	assert.Equal(t, testStruct{"hello", 1}, value1)
+
+	assert.NoError(t, cache1.Close())
+	assert.NoError(t, client.Close())
+}
+
+func TestCache_RangeDeletion(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+	defer standaloneServer.Close()
+
+	client, err := NewSyncClient(standaloneServer.ServiceAddr())
+	assert.NoError(t, err)
+
+	cache, err := NewCache[testStruct](client, json.Marshal, json.Unmarshal)
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	for _, k := range []string{"/range/a", "/range/b", "/other/a"} {
+		_, _, err = cache.Put(ctx, k, testStruct{k, 1})
+		assert.NoError(t, err)
+		_, _, err = cache.Get(ctx, k)
+		assert.NoError(t, err)
+	}
+
+	// Delete the range outside the cache
+	assert.NoError(t, client.DeleteRange(ctx, "/range/", "/range//"))
+
+	assert.Eventually(t, func() bool {
+		_, _, err := cache.Get(ctx, "/range/a")
+		return errors.Is(err, ErrKeyNotFound)
+	}, 10*time.Second, 10*time.Millisecond)
+
+	_, _, err = cache.Get(ctx, "/range/b")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	value, _, err := cache.Get(ctx, "/other/a")
+	assert.NoError(t, err)
+	assert.Equal(t, testStruct{"/other/a", 1}, value)
+
+	assert.NoError(t, cache.Close())
+	assert.NoError(t, client.Close())
+}
+
+func TestCache_InvalidateOnNotificationsGap(t *testing.T) {
+	client := &blockingSyncClient{release: make(chan struct{})}
+	close(client.release)
+	client.value.Store(&testStruct{"hello", 1})
+
+	// The cache is not registered with a cache manager, so that no real
+	// notification can invalidate the entries
+	ci := newTestCacheImpl(t, client)
+
+	ctx := context.Background()
+	_, _, err := ci.Get(ctx, "/key")
+	assert.NoError(t, err)
+
+	ci.keysMutex.Lock()
+	assert.Len(t, ci.keys, 1)
+	ci.keysMutex.Unlock()
+
+	// The stream was resumed from the last offset, nothing was missed
+	ci.handleNotification(&Notification{Type: NotificationsStreamRestarted, VersionId: -1})
+
+	ci.keysMutex.Lock()
+	assert.Len(t, ci.keys, 1)
+	ci.keysMutex.Unlock()
+
+	ci.handleNotification(&Notification{Type: NotificationsStreamRestarted, VersionId: -1, OffsetLost: true})
+
+	ci.keysMutex.Lock()
+	assert.Empty(t, ci.keys)
+	ci.keysMutex.Unlock()
+
+	assert.NoError(t, ci.Close())
+}
+
+func TestCache_InvalidationDiscardsLoadsOfSameKey(t *testing.T) {
+	client := &blockingSyncClient{release: make(chan struct{})}
+	client.value.Store(&testStruct{"hello", 1})
+	ci := newTestCacheImpl(t, client)
+
+	callA, _ := ci.startLoad("/a")
+	callB, _ := ci.startLoad("/b")
+
+	// Only the load of the invalidated key is discarded
+	ci.invalidate("/b")
+	close(client.release)
+	<-callA.done
+	<-callB.done
+
+	ci.keysMutex.Lock()
+	_, cachedA := ci.keys["/a"]
+	_, cachedB := ci.keys["/b"]
+	ci.keysMutex.Unlock()
+	assert.True(t, cachedA)
+	assert.False(t, cachedB)
+
+	assert.NoError(t, ci.Close())
+}
+
+func TestCache_ConsistencyVerified(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+	defer standaloneServer.Close()
+
+	client, err := NewSyncClient(standaloneServer.ServiceAddr())
+	assert.NoError(t, err)
+
+	// The cache is not registered with a cache manager, so that the entry
+	// cannot be invalidated by the notification of the put
+	cache := newTestCacheImpl(t, client, Consistency(ConsistencyVerified))
+
+	ctx := context.Background()
+	k1 := newKey()
+	_, _, err = cache.Put(ctx, k1, testStruct{"hello", 1})
+	assert.NoError(t, err)
+	_, _, err = cache.Get(ctx, k1)
+	assert.NoError(t, err)
+
+	// Simulate a stale entry, by replacing the cached value with one that has
+	// an older version
+	cache.keysMutex.Lock()
+	entry := cache.keys[k1]
+	cache.keysMutex.Unlock()
+	require.NotNil(t, entry)
+	stale, _ := entry.result.Get()
+	stale.value = testStruct{"stale", 0}
+	stale.version.VersionId--
+	entry.result = cachedResult[testStruct](optionalOf(stale))
+
+	value, _, err := cache.Get(ctx, k1, Consistency(ConsistencyEventual))
+	assert.NoError(t, err)
+	assert.Equal(t, testStruct{"stale", 0}, value)
+
+	value, _, err = cache.Get(ctx, k1)
+	assert.NoError(t, err)
+	assert.Equal(t, testStruct{"hello", 1}, value)
+
+	assert.NoError(t, cache.Close())
+	assert.NoError(t, client.Close())
+}
+
+type blockingSyncClient struct {
+	SyncClient
+	gets    atomic.Int32
+	value   atomic.Pointer[testStruct]
+	release chan struct{}
+}
+
+func (c *blockingSyncClient) Get(ctx context.Context, key string, _ ...GetOption) (string, []byte, Version, error) {
+	c.gets.Add(1)
+	select {
+	case <-c.release:
+	case <-ctx.Done():
+		return key, nil, Version{}, ctx.Err()
+	}
+	data, err := json.Marshal(c.value.Load())
+	return key, data, Version{VersionId: int64(c.gets.Load())}, err
+}
+
+func newTestCacheImpl(t *testing.T, client SyncClient, options ...CacheOption) *cacheImpl[testStruct] {
+	t.Helper()
+	opts, err := newCacheOptions(options)
+	assert.NoError(t, err)
+	c, err := newCacheImpl[testStruct](client, json.Marshal, json.Unmarshal, opts, DefaultRequestTimeout,
+		metrics.NewCacheMetrics(noop.NewMeterProvider(), "test"), nil, 0)
+	assert.NoError(t, err)
+	return c
+}
+
+func TestCache_ConcurrentMissesAreCollapsed(t *testing.T) {
+	client := &blockingSyncClient{release: make(chan struct{})}
+	client.value.Store(&testStruct{"hello", 1})
+	c := newTestCacheImpl(t, client)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, _, err := c.Get(context.Background(), "/key")
+			assert.NoError(t, err)
+			assert.Equal(t, testStruct{"hello", 1}, value)
+		}()
+	}
+
+	// Give time to all the callers to join the load in progress
+	time.Sleep(100 * time.Millisecond)
+	close(client.release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, client.gets.Load())
+	assert.NoError(t, c.Close())
+}
+
+func TestCache_StaleWhileRevalidate(t *testing.T) {
+	client := &blockingSyncClient{release: make(chan struct{})}
+	close(client.release)
+	client.value.Store(&testStruct{"hello", 1})
+	c := newTestCacheImpl(t, client, CacheTTL(50*time.Millisecond), CacheStaleWhileRevalidate(time.Hour))
+
+	ctx := context.Background()
+	value, _, err := c.Get(ctx, "/key")
+	assert.NoError(t, err)
+	assert.Equal(t, testStruct{"hello", 1}, value)
+	c.valueCache.Wait()
+
+	time.Sleep(100 * time.Millisecond)
+	client.value.Store(&testStruct{"hello", 2})
+
+	// The stale value is served, while being reloaded
+	value, _, err = c.Get(ctx, "/key")
+	assert.NoError(t, err)
+	assert.Equal(t, testStruct{"hello", 1}, value)
+
+	assert.Eventually(t, func() bool {
+		value, _, err := c.Get(ctx, "/key")
+		return err == nil && value.B == 2
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.NoError(t, c.Close())
+}
+
+func TestCache_RefreshAhead(t *testing.T) {
+	client := &blockingSyncClient{release: make(chan struct{})}
+	close(client.release)
+	client.value.Store(&testStruct{"hello", 1})
+	c := newTestCacheImpl(t, client, CacheTTL(time.Second), CacheRefreshAhead(0.1))
+
+	ctx := context.Background()
+	_, _, err := c.Get(ctx, "/key")
+	assert.NoError(t, err)
+	c.valueCache.Wait()
+
+	time.Sleep(200 * time.Millisecond)
+	client.value.Store(&testStruct{"hello", 2})
+
+	value, _, err := c.Get(ctx, "/key")
+	assert.NoError(t, err)
+	assert.Equal(t, testStruct{"hello", 1}, value)
+
+	assert.Eventually(t, func() bool {
+		value, _, err := c.Get(ctx, "/key")
+		return err == nil && value.B == 2
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.NoError(t, c.Close())
+}
+
+func TestCache_CloseStopsLoads(t *testing.T) {
+	client := &blockingSyncClient{release: make(chan struct{})}
+	client.value.Store(&testStruct{"hello", 1})
+	c := newTestCacheImpl(t, client)
+
+	call, started := c.startLoad("/key")
+	assert.True(t, started)
+
+	assert.NoError(t, c.Close())
+	select {
+	case <-call.done:
+		assert.ErrorIs(t, call.err, context.Canceled)
+	case <-time.After(10 * time.Second):
+		assert.Fail(t, "load not stopped by the close")
+	}
+}
@@ -18,8 +18,10 @@ import (
 	"context"
 	"errors"
 	"io"
+	"time"
 
-	"github.com/oxia-db/oxia/oxia/internal/batch"
+	"github.com/oxia-db/oxia-client-golang/internal"
+	"github.com/oxia-db/oxia-client-golang/internal/batch"
 )
 
 const (
@@ -40,8 +42,34 @@ var (
 	// ErrRequestTooLarge is returned when a request is larger than the maximum batch size.
 	ErrRequestTooLarge = batch.ErrRequestTooLarge
 
+	// ErrBackpressure is returned when there's no room for a request among the pending
+	// requests. See [WithMaxPendingBytes] and [WithMaxPendingRequests].
+	ErrBackpressure = batch.ErrBackpressure
+
+	// ErrSessionNotFound The session of an ephemeral record does not exist on the
+	// server, e.g. because it has expired.
+	ErrSessionNotFound = errors.New("session not found")
+
 	// ErrUnknownStatus Unknown error.
 	ErrUnknownStatus = errors.New("unknown status")
+
+	// ErrShardNotAvailable There is currently no shard assigned for the key, or the
+	// shard is not known. This can happen while the shard assignments are being
+	// updated. See [WithWaitForShardAssignments].
+	ErrShardNotAvailable = internal.ErrShardNotAvailable
+
+	// ErrClientClosed The client was already closed.
+	ErrClientClosed = errors.New("client closed")
+
+	// ErrInvalidServiceAddress The service address passed to the client cannot be parsed.
+	ErrInvalidServiceAddress = internal.ErrInvalidServiceAddress
+
+	// ErrLeaseExpired The lease was not kept alive in time, and the records attached
+	// to it were deleted.
+	ErrLeaseExpired = errors.New("lease expired")
+
+	// ErrLeaseRevoked The lease was explicitly revoked.
+	ErrLeaseRevoked = errors.New("lease revoked")
 )
 
 // AsyncClient Oxia client with methods suitable for asynchronous operations.
@@ -111,7 +139,33 @@ type AsyncClient interface {
 
 	// GetNotifications creates a new subscription to receive the notifications
 	// from Oxia for any change that is applied to the database
-	GetNotifications() (Notifications, error)
+	//
+	// The buffering of the notifications can be tuned with [NotificationsBufferSize]
+	// and [NotificationsOverflowPolicy].
+	GetNotifications(options ...NotificationsOption) (Notifications, error)
+
+	// GrantLease creates a new [Lease], with its own time-to-live, to which
+	// ephemeral records can be attached with the [WithLease] option.
+	GrantLease(ctx context.Context, ttl time.Duration) (Lease, error)
+
+	// Topology returns a snapshot of the shards, with their hash ranges and
+	// leaders, as currently known by the client.
+	Topology() Topology
+
+	// TopologyEvents creates a subscription to the changes in the topology,
+	// such as shard splits and leader moves.
+	// The channel is closed when the context is canceled or the client is closed.
+	TopologyEvents(ctx context.Context) <-chan TopologyEvent
+
+	// Flush waits until all the operations that were submitted so far are
+	// completed, or until the context is done.
+	Flush(ctx context.Context) error
+
+	// CloseWithContext closes the client gracefully: the pending operations are
+	// sent and acknowledged before the sessions and the connections are closed.
+	// When the context is done, the operations that are still pending are
+	// failed, and the client is closed right away.
+	CloseWithContext(ctx context.Context) error
 }
 
 // SyncClient is the main interface to perform operations with Oxia.
@@ -178,7 +232,28 @@ type SyncClient interface {
 
 	// GetNotifications creates a new subscription to receive the notifications
 	// from Oxia for any change that is applied to the database
-	GetNotifications() (Notifications, error)
+	//
+	// The buffering of the notifications can be tuned with [NotificationsBufferSize]
+	// and [NotificationsOverflowPolicy].
+	GetNotifications(options ...NotificationsOption) (Notifications, error)
+
+	// GrantLease creates a new [Lease], with its own time-to-live, to which
+	// ephemeral records can be attached with the [WithLease] option.
+	GrantLease(ctx context.Context, ttl time.Duration) (Lease, error)
+
+	// Topology returns a snapshot of the shards, with their hash ranges and
+	// leaders, as currently known by the client.
+	Topology() Topology
+
+	// TopologyEvents creates a subscription to the changes in the topology,
+	// such as shard splits and leader moves.
+	// The channel is closed when the context is canceled or the client is closed.
+	TopologyEvents(ctx context.Context) <-chan TopologyEvent
+
+	// CloseWithContext closes the client gracefully: the operations that are
+	// in flight are completed before the sessions and the connections are
+	// closed. When the context is done, the client is closed right away.
+	CloseWithContext(ctx context.Context) error
 }
 
 // Version includes some information regarding the state of a record.
@@ -274,6 +349,19 @@ const (
 	KeyDeleted
 	// KeyRangeRangeDeleted A range of keys was deleted.
 	KeyRangeRangeDeleted
+	// NotificationsDropped Some notifications were discarded because the consumer was
+	// not keeping up. See [OverflowDropOldest].
+	NotificationsDropped
+	// ShardTopologyChanged Shards were added or removed (eg: after a shard split).
+	// Notifications for the affected keys might have been missed and consumers
+	// should re-sync their state if needed. Only published with
+	// [NotificationsTopologyEvents].
+	ShardTopologyChanged
+	// NotificationsStreamRestarted The notifications stream of a shard was interrupted
+	// and then re-established. The notifications are resumed from the last one that was
+	// received, unless OffsetLost is set, though consumers might have acted on stale
+	// state in the meantime. Only published with [NotificationsStreamRestartEvents].
+	NotificationsStreamRestarted
 )
 
 func (n NotificationType) String() string {
@@ -286,6 +374,12 @@ func (n NotificationType) String() string {
 		return "KeyDeleted"
 	case KeyRangeRangeDeleted:
 		return "KeyRangeRangeDeleted"
+	case NotificationsDropped:
+		return "NotificationsDropped"
+	case ShardTopologyChanged:
+		return "ShardTopologyChanged"
+	case NotificationsStreamRestarted:
+		return "NotificationsStreamRestarted"
 	}
 
 	return "Unknown"
@@ -305,4 +399,58 @@ type Notification struct {
 	// In case of a KeyRangeRangeDeleted notification, this would represent
 	// the end (excluded) of the range of keys
 	KeyRangeEnd string
+
+	// In case of a NotificationsDropped notification, the number of notifications
+	// that were discarded
+	DroppedCount int
+
+	// In case of a NotificationsStreamRestarted notification, whether the stream
+	// could not be resumed from the last notification that was received, so that
+	// some notifications might have been missed
+	OffsetLost bool
+}
+
+// SessionEventType represents the type of a session lifecycle event.
+type SessionEventType int
+
+const (
+	// SessionCreated A new session was established with a shard.
+	SessionCreated SessionEventType = iota
+	// SessionExpired The session was terminated by the server, because it was not
+	// kept alive in time. All the ephemeral records created with the session were
+	// deleted.
+	SessionExpired
+	// SessionClosed The session was closed by the client.
+	SessionClosed
+)
+
+func (t SessionEventType) String() string {
+	switch t {
+	case SessionCreated:
+		return "SessionCreated"
+	case SessionExpired:
+		return "SessionExpired"
+	case SessionClosed:
+		return "SessionClosed"
+	}
+
+	return "Unknown"
+}
+
+// SessionEvent reports a change in the lifecycle of the session that the client
+// holds with a shard. Sessions are used for the ephemeral records.
+// See [WithSessionEventListener].
+type SessionEvent struct {
+	// The type of the event
+	Type SessionEventType
+
+	// The shard to which the session belongs
+	Shard int64
+
+	// The id of the session
+	SessionId int64
+
+	// In case of a SessionExpired or SessionClosed event, the error that was
+	// encountered, if any
+	Err error
 }
@@ -0,0 +1,101 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"sync"
+
+	"github.com/oxia-db/oxia/common/compare"
+)
+
+// An ephemeral record that was created by the client, and that will be
+// re-created when its session expires.
+type ephemeralRecord struct {
+	shardId int64
+	key     string
+	value   []byte
+	options []PutOption
+}
+
+// Keeps track of the ephemeral records created by the client, when the
+// re-registration of the ephemerals is enabled.
+type ephemeralRegistry struct {
+	sync.Mutex
+	records map[string]*ephemeralRecord
+}
+
+func newEphemeralRegistry() *ephemeralRegistry {
+	return &ephemeralRegistry{
+		records: make(map[string]*ephemeralRecord),
+	}
+}
+
+func (r *ephemeralRegistry) add(shardId int64, key string, value []byte, opts *putOptions) {
+	if len(opts.sequenceKeysDeltas) > 0 {
+		// The key is assigned by the server, we would not be able to re-create the
+		// same record
+		return
+	}
+
+	// The record is only re-created if nobody else has taken the key in the meantime
+	options := []PutOption{Ephemeral(), ExpectedRecordNotExists()}
+	if opts.partitionKey != nil {
+		options = append(options, PartitionKey(*opts.partitionKey))
+	}
+	for _, idx := range opts.secondaryIndexes {
+		options = append(options, idx)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.records[key] = &ephemeralRecord{
+		shardId: shardId,
+		key:     key,
+		value:   value,
+		options: options,
+	}
+}
+
+func (r *ephemeralRegistry) remove(key string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.records, key)
+}
+
+func (r *ephemeralRegistry) removeRange(minKeyInclusive string, maxKeyExclusive string) {
+	r.Lock()
+	defer r.Unlock()
+	for key := range r.records {
+		if compare.CompareWithSlash([]byte(key), []byte(minKeyInclusive)) >= 0 &&
+			compare.CompareWithSlash([]byte(key), []byte(maxKeyExclusive)) < 0 {
+			delete(r.records, key)
+		}
+	}
+}
+
+// Removes and returns all the records that were created in the shard.
+func (r *ephemeralRegistry) take(shardId int64) []*ephemeralRecord {
+	r.Lock()
+	defer r.Unlock()
+
+	var res []*ephemeralRecord
+	for key, record := range r.records {
+		if record.shardId == shardId {
+			res = append(res, record)
+			delete(r.records, key)
+		}
+	}
+	return res
+}
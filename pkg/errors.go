@@ -0,0 +1,166 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/oxia-db/oxia-client-golang/internal"
+)
+
+const (
+	operationPut         = "put"
+	operationDelete      = "delete"
+	operationDeleteRange = "delete_range"
+	operationGet         = "get"
+	operationList        = "list"
+	operationRangeScan   = "range_scan"
+
+	// The shard of an [Error] when the failure happened before the shard of
+	// the operation was known.
+	unknownShard int64 = -1
+)
+
+// Error is the error of a failed operation, with the context in which it
+// failed. It wraps the cause of the failure, which can be checked with
+// errors.Is, while the Error itself can be retrieved with errors.As:
+//
+//	var oxiaErr *oxia.Error
+//	if errors.As(res.Err, &oxiaErr) && oxiaErr.Retriable {
+//	    ...
+//	}
+//
+// [ErrKeyNotFound] and [ErrUnexpectedVersionId] are the expected outcomes of
+// the operations, rather than failures, so they are returned as they are.
+type Error struct {
+	// Operation is the name of the operation, e.g. "put" or "range_scan"
+	Operation string
+	// Key is the key of the operation. It's empty for the operations on a
+	// range of keys.
+	Key string
+	// ShardId is the shard the operation was sent to, or -1 if it failed
+	// before its shard was known.
+	ShardId int64
+	// Leader is the address of the leader of the shard, if known.
+	Leader string
+	// Code is the gRPC code of the cause of the failure.
+	Code codes.Code
+	// Attempts is the number of times the request was sent by the retrier. It's
+	// 0 if the operation failed before being sent, e.g. because it was cancelled
+	// while waiting in its batch, rejected with [ErrBackpressure] or
+	// [ErrRequestTooLarge], or because the client was being closed.
+	Attempts int
+	// Retriable is whether the failure is considered temporary by the retry
+	// policy, so that the operation could succeed if attempted again.
+	Retriable bool
+	// Err is the cause of the failure.
+	Err error
+}
+
+func (e *Error) Error() string {
+	sb := strings.Builder{}
+	sb.WriteString(e.Operation)
+	if e.Key != "" {
+		fmt.Fprintf(&sb, " %q", e.Key)
+	}
+	if e.ShardId != unknownShard {
+		fmt.Fprintf(&sb, " on shard %d", e.ShardId)
+		if e.Leader != "" {
+			fmt.Fprintf(&sb, " (leader %s)", e.Leader)
+		}
+	}
+	if e.Attempts > 1 {
+		fmt.Fprintf(&sb, " failed after %d attempts: %v", e.Attempts, e.Err)
+	} else {
+		fmt.Fprintf(&sb, " failed: %v", e.Err)
+	}
+	return sb.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wraps the failure of an operation in an Error.
+func (c *clientImpl) newError(operation string, key string, shardId int64, err error) error {
+	if err == nil || errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrUnexpectedVersionId) {
+		return err
+	}
+	var oxiaErr *Error
+	if errors.As(err, &oxiaErr) {
+		return err
+	}
+
+	e := &Error{
+		Operation: operation,
+		Key:       key,
+		ShardId:   shardId,
+		Err:       err,
+	}
+
+	var requestErr *internal.RequestError
+	switch {
+	case errors.As(err, &requestErr):
+		e.ShardId = requestErr.ShardId
+		e.Attempts = requestErr.Attempts
+		e.Retriable = requestErr.Retriable
+		e.Err = requestErr.Err
+	case errors.Is(err, ErrShardNotAvailable):
+		e.Retriable = true
+	default:
+		e.Retriable = c.retrier.ShouldRetry(internal.RetryOperation{
+			Type:       retryOperationType(operation),
+			Idempotent: true,
+		}, err)
+	}
+
+	if e.ShardId != unknownShard {
+		// Runs on the batcher of the shard, so it must not wait for the
+		// assignments to be updated
+		if leader, ok := c.shardManager.LookupLeader(e.ShardId); ok {
+			e.Leader = leader
+		}
+	}
+	e.Code = errorCode(e.Err)
+	return e
+}
+
+func retryOperationType(operation string) internal.RetryOperationType {
+	switch operation {
+	case operationPut, operationDelete, operationDeleteRange:
+		return internal.RetryOperationWrite
+	default:
+		return internal.RetryOperationRead
+	}
+}
+
+func errorCode(err error) codes.Code {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	case errors.Is(err, ErrShardNotAvailable):
+		return codes.Unavailable
+	default:
+		return status.Code(err)
+	}
+}
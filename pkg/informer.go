@@ -0,0 +1,370 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/pkg/errors"
+
+	"github.com/oxia-db/oxia/common/compare"
+	"github.com/oxia-db/oxia/common/process"
+	time2 "github.com/oxia-db/oxia/common/time"
+)
+
+// Informer maintains a local copy of all the records within a range of keys,
+// which is kept up to date by following the notifications feed.
+//
+// The local copy is initially populated with a [SyncClient.RangeScan]. When
+// notifications might have been missed (eg: after a [NotificationsDropped] or a
+// [ShardTopologyChanged] event), the view is re-synced with a new scan, and the
+// differences are reported to the event handlers.
+type Informer interface {
+	io.Closer
+
+	// List returns all the records in the local view, sorted by key.
+	List() []InformerRecord
+
+	// Get returns the record associated with the key from the local view.
+	Get(key string) (record InformerRecord, found bool)
+
+	// HasSynced reports whether the initial listing of the records has completed.
+	HasSynced() bool
+
+	// WaitForSync blocks until the initial listing of the records has completed, or
+	// the context is done.
+	WaitForSync(ctx context.Context) error
+
+	// AddEventHandler registers a handler for the changes in the local view.
+	// The handler will receive an OnAdd event for every record that is already in
+	// the view.
+	// Handlers are invoked sequentially, from a single go-routine, and they must
+	// not call AddEventHandler.
+	AddEventHandler(handler InformerEventHandler)
+}
+
+// InformerRecord is a record stored in the local view of an [Informer].
+type InformerRecord struct {
+	Key     string
+	Value   []byte
+	Version Version
+}
+
+// InformerEventHandler receives the changes applied to the local view of an
+// [Informer]. Any of the functions can be left nil.
+type InformerEventHandler struct {
+	OnAdd    func(record InformerRecord)
+	OnUpdate func(oldRecord InformerRecord, newRecord InformerRecord)
+	OnDelete func(record InformerRecord)
+}
+
+// NewInformer creates an [Informer] for all the records with keys in the range
+// `[minKeyInclusive, maxKeyExclusive)`.
+// Note: Oxia uses a custom sorting order that treats `/` characters in special way.
+// Refer to this documentation for the specifics:
+// https://oxia-db.github.io/docs/features/oxia-key-sorting
+func NewInformer(client SyncClient, minKeyInclusive string, maxKeyExclusive string) (Informer, error) {
+	notifications, err := client.GetNotifications(NotificationsTopologyEvents())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create notifications client")
+	}
+
+	i := &informer{
+		client:          client,
+		notifications:   notifications,
+		minKeyInclusive: minKeyInclusive,
+		maxKeyExclusive: maxKeyExclusive,
+		records:         make(map[string]InformerRecord),
+		syncedCh:        make(chan struct{}),
+		log: slog.With(
+			slog.String("component", "oxia-informer"),
+			slog.String("min-key-inclusive", minKeyInclusive),
+			slog.String("max-key-exclusive", maxKeyExclusive),
+		),
+	}
+	// The informer is stopped when the client is closed
+	i.ctx, i.cancel = context.WithCancel(clientContext(client))
+
+	go process.DoWithLabels(
+		i.ctx,
+		map[string]string{
+			"oxia": "informer",
+		},
+		i.run,
+	)
+
+	return i, nil
+}
+
+type informer struct {
+	recordsMutex sync.RWMutex
+	records      map[string]InformerRecord
+
+	// Serializes the changes to the view with the invocation of the handlers
+	dispatchMutex sync.Mutex
+	handlers      []InformerEventHandler
+
+	client          SyncClient
+	notifications   Notifications
+	minKeyInclusive string
+	maxKeyExclusive string
+
+	synced   atomic.Bool
+	syncedCh chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	log    *slog.Logger
+}
+
+func (i *informer) List() []InformerRecord {
+	i.recordsMutex.RLock()
+	res := make([]InformerRecord, 0, len(i.records))
+	for _, r := range i.records {
+		res = append(res, r)
+	}
+	i.recordsMutex.RUnlock()
+
+	sort.Slice(res, func(a, b int) bool {
+		return compare.CompareWithSlash([]byte(res[a].Key), []byte(res[b].Key)) < 0
+	})
+	return res
+}
+
+func (i *informer) Get(key string) (InformerRecord, bool) {
+	i.recordsMutex.RLock()
+	defer i.recordsMutex.RUnlock()
+
+	r, found := i.records[key]
+	return r, found
+}
+
+func (i *informer) HasSynced() bool {
+	return i.synced.Load()
+}
+
+func (i *informer) WaitForSync(ctx context.Context) error {
+	select {
+	case <-i.syncedCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-i.ctx.Done():
+		return errors.New("informer is closed")
+	}
+}
+
+func (i *informer) AddEventHandler(handler InformerEventHandler) {
+	i.dispatchMutex.Lock()
+	defer i.dispatchMutex.Unlock()
+
+	if handler.OnAdd != nil {
+		for _, r := range i.List() {
+			handler.OnAdd(r)
+		}
+	}
+
+	i.handlers = append(i.handlers, handler)
+}
+
+func (i *informer) Close() error {
+	i.cancel()
+	return i.notifications.Close()
+}
+
+func (i *informer) run() {
+	// The notifications subscription is already active, so any change that
+	// happens during the scan will be applied afterward
+	if err := i.resyncWithRetries(); err != nil {
+		return
+	}
+
+	i.synced.Store(true)
+	close(i.syncedCh)
+
+	for {
+		select {
+		case n, ok := <-i.notifications.Ch():
+			if !ok {
+				return
+			}
+			if err := i.handleNotification(n); err != nil {
+				if i.ctx.Err() != nil {
+					return
+				}
+
+				i.log.Warn(
+					"Failed to apply notification, re-syncing",
+					slog.String("key", n.Key),
+					slog.Any("error", err),
+				)
+				if err = i.resyncWithRetries(); err != nil {
+					return
+				}
+			}
+
+		case <-i.ctx.Done():
+			return
+		}
+	}
+}
+
+func (i *informer) handleNotification(n *Notification) error {
+	switch n.Type {
+	case KeyCreated, KeyModified:
+		if !i.inRange(n.Key) {
+			return nil
+		}
+		if existing, found := i.Get(n.Key); found && existing.Version.VersionId >= n.VersionId {
+			// We already have this version, or a more recent one
+			return nil
+		}
+		return i.fetch(n.Key)
+
+	case KeyDeleted:
+		if i.inRange(n.Key) {
+			i.apply(n.Key, nil)
+		}
+		return nil
+
+	case KeyRangeRangeDeleted:
+		for _, r := range i.List() {
+			if compare.CompareWithSlash([]byte(r.Key), []byte(n.Key)) >= 0 &&
+				compare.CompareWithSlash([]byte(r.Key), []byte(n.KeyRangeEnd)) < 0 {
+				i.apply(r.Key, nil)
+			}
+		}
+		return nil
+
+	case NotificationsDropped, ShardTopologyChanged:
+		i.log.Info(
+			"Notifications might have been missed, re-syncing",
+			slog.Any("type", n.Type),
+		)
+		return i.resyncWithRetries()
+	}
+
+	return nil
+}
+
+// Reads the current value of a record and applies it to the view.
+func (i *informer) fetch(key string) error {
+	_, value, version, err := i.client.Get(i.ctx, key)
+	switch {
+	case errors.Is(err, ErrKeyNotFound):
+		// The record was deleted in the meantime. The view is updated right
+		// away, and the notification of the deletion will be a no-op.
+		i.apply(key, nil)
+		return nil
+	case err != nil:
+		return err
+	}
+
+	i.apply(key, &InformerRecord{Key: key, Value: value, Version: version})
+	return nil
+}
+
+func (i *informer) resyncWithRetries() error {
+	err := backoff.RetryNotify(i.resync, time2.NewBackOff(i.ctx), func(err error, duration time.Duration) {
+		i.log.Warn(
+			"Failed to list records, retrying later",
+			slog.Any("error", err),
+			slog.Duration("retry-after", duration),
+		)
+	})
+	if err != nil && !errors.Is(err, context.Canceled) {
+		i.log.Error(
+			"Failed to list records",
+			slog.Any("error", err),
+		)
+	}
+	return err
+}
+
+// Lists all the records in the range and reconciles the view with them.
+func (i *informer) resync() error {
+	current := make(map[string]InformerRecord)
+	for r := range i.client.RangeScan(i.ctx, i.minKeyInclusive, i.maxKeyExclusive) {
+		if r.Err != nil {
+			return r.Err
+		}
+		current[r.Key] = InformerRecord{Key: r.Key, Value: r.Value, Version: r.Version}
+	}
+
+	for _, existing := range i.List() {
+		if _, found := current[existing.Key]; !found {
+			i.apply(existing.Key, nil)
+		}
+	}
+
+	for key := range current {
+		r := current[key]
+		i.apply(key, &r)
+	}
+	return nil
+}
+
+// Updates the view and notifies the handlers. A nil record means that the key
+// was deleted.
+func (i *informer) apply(key string, record *InformerRecord) {
+	i.dispatchMutex.Lock()
+	defer i.dispatchMutex.Unlock()
+
+	i.recordsMutex.Lock()
+	existing, found := i.records[key]
+	switch {
+	case record == nil && !found:
+		i.recordsMutex.Unlock()
+		return
+	case record == nil:
+		delete(i.records, key)
+	case found && existing.Version.VersionId == record.Version.VersionId:
+		// No change
+		i.recordsMutex.Unlock()
+		return
+	default:
+		i.records[key] = *record
+	}
+	i.recordsMutex.Unlock()
+
+	for _, h := range i.handlers {
+		switch {
+		case record == nil:
+			if h.OnDelete != nil {
+				h.OnDelete(existing)
+			}
+		case found:
+			if h.OnUpdate != nil {
+				h.OnUpdate(existing, *record)
+			}
+		default:
+			if h.OnAdd != nil {
+				h.OnAdd(*record)
+			}
+		}
+	}
+}
+
+func (i *informer) inRange(key string) bool {
+	return compare.CompareWithSlash([]byte(key), []byte(i.minKeyInclusive)) >= 0 &&
+		compare.CompareWithSlash([]byte(key), []byte(i.maxKeyExclusive)) < 0
+}
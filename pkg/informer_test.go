@@ -0,0 +1,142 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oxia-db/oxia/node"
+)
+
+type informerEvents struct {
+	sync.Mutex
+	added   []string
+	updated []string
+	deleted []string
+}
+
+func (e *informerEvents) handler() InformerEventHandler {
+	return InformerEventHandler{
+		OnAdd: func(r InformerRecord) {
+			e.Lock()
+			defer e.Unlock()
+			e.added = append(e.added, r.Key)
+		},
+		OnUpdate: func(_ InformerRecord, r InformerRecord) {
+			e.Lock()
+			defer e.Unlock()
+			e.updated = append(e.updated, r.Key)
+		},
+		OnDelete: func(r InformerRecord) {
+			e.Lock()
+			defer e.Unlock()
+			e.deleted = append(e.deleted, r.Key)
+		},
+	}
+}
+
+func (e *informerEvents) counts() (int, int, int) {
+	e.Lock()
+	defer e.Unlock()
+	return len(e.added), len(e.updated), len(e.deleted)
+}
+
+func TestInformer(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+	defer standaloneServer.Close()
+
+	client, err := NewSyncClient(standaloneServer.ServiceAddr())
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	_, _, err = client.Put(ctx, "/informer/a", []byte("a-0"))
+	assert.NoError(t, err)
+	_, _, err = client.Put(ctx, "/other/a", []byte("x"))
+	assert.NoError(t, err)
+
+	informer, err := NewInformer(client, "/informer/", "/informer//")
+	assert.NoError(t, err)
+
+	assert.NoError(t, informer.WaitForSync(ctx))
+	assert.True(t, informer.HasSynced())
+
+	events := &informerEvents{}
+	informer.AddEventHandler(events.handler())
+	added, _, _ := events.counts()
+	assert.Equal(t, 1, added)
+
+	_, _, err = client.Put(ctx, "/informer/b", []byte("b-0"))
+	assert.NoError(t, err)
+	_, _, err = client.Put(ctx, "/informer/a", []byte("a-1"))
+	assert.NoError(t, err)
+	_, _, err = client.Put(ctx, "/other/b", []byte("x"))
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		added, updated, _ := events.counts()
+		return added == 2 && updated == 1
+	}, 10*time.Second, 10*time.Millisecond)
+
+	r, found := informer.Get("/informer/a")
+	assert.True(t, found)
+	assert.Equal(t, []byte("a-1"), r.Value)
+
+	_, found = informer.Get("/other/a")
+	assert.False(t, found)
+
+	records := informer.List()
+	assert.Len(t, records, 2)
+	assert.Equal(t, "/informer/a", records[0].Key)
+	assert.Equal(t, "/informer/b", records[1].Key)
+
+	assert.NoError(t, client.Delete(ctx, "/informer/a"))
+	assert.NoError(t, client.DeleteRange(ctx, "/informer/b", "/informer/c"))
+
+	assert.Eventually(t, func() bool {
+		_, _, deleted := events.counts()
+		return deleted == 2
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Empty(t, informer.List())
+
+	assert.NoError(t, informer.Close())
+	assert.NoError(t, client.Close())
+}
+
+func TestInformer_ClientClosed(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+	defer standaloneServer.Close()
+
+	client, err := NewSyncClient(standaloneServer.ServiceAddr())
+	assert.NoError(t, err)
+
+	inf, err := NewInformer(client, "/informer/", "/informer//")
+	assert.NoError(t, err)
+	assert.NoError(t, inf.WaitForSync(context.Background()))
+
+	// Closing the client stops the informer, even if it's not closed
+	assert.NoError(t, client.Close())
+	assert.Eventually(t, func() bool {
+		return inf.(*informer).ctx.Err() != nil
+	}, 10*time.Second, 10*time.Millisecond)
+
+	assert.NoError(t, inf.Close())
+}
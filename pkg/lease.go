@@ -0,0 +1,145 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/status"
+
+	"github.com/oxia-db/oxia/common/concurrent"
+	"github.com/oxia-db/oxia/common/constant"
+)
+
+// Lease controls the lifetime of a group of ephemeral records, independently from
+// the session that the client uses for the records created with [Ephemeral].
+//
+// Records are attached to a lease with the [WithLease] option. They are
+// automatically deleted when the lease is revoked, or when it's not kept alive
+// within its time-to-live.
+//
+// Leases are not kept alive automatically: the owner is expected to call
+// [Lease.KeepAliveOnce] periodically, at an interval shorter than the TTL.
+type Lease interface {
+	// TTL returns the time-to-live of the lease.
+	TTL() time.Duration
+
+	// KeepAliveOnce extends the lifetime of the lease by its TTL.
+	// Returns [ErrLeaseExpired] if the lease was already expired.
+	KeepAliveOnce(ctx context.Context) error
+
+	// Revoke terminates the lease and deletes all the records attached to it.
+	Revoke() error
+}
+
+type lease struct {
+	client   *clientImpl
+	ttl      time.Duration
+	sessions *sessions
+	revoked  atomic.Bool
+	expired  atomic.Bool
+}
+
+func newLease(c *clientImpl, ttl time.Duration) *lease {
+	options := c.options
+	options.sessionTimeout = ttl
+
+	s := newSessions(c.ctx, c.shardManager, c.clientPool, c.retrier, options, c.options.sessionEventListener)
+	s.manualKeepAlive = true
+	return &lease{
+		client:   c,
+		ttl:      ttl,
+		sessions: s,
+	}
+}
+
+// Creates the sessions on all the shards, so that the lifetime of the lease
+// starts when it's granted.
+func (l *lease) start(ctx context.Context) error {
+	shards := l.client.shardManager.GetAll()
+	wg := concurrent.NewWaitGroup(len(shards))
+	for _, shardId := range shards {
+		go l.sessions.executeWithSessionId(shardId, func(_ int64, err error) {
+			if err != nil {
+				wg.Fail(err)
+			} else {
+				wg.Done()
+			}
+		})
+	}
+
+	return wg.Wait(ctx)
+}
+
+func (l *lease) TTL() time.Duration {
+	return l.ttl
+}
+
+func (l *lease) checkValid() error {
+	if l.revoked.Load() {
+		return ErrLeaseRevoked
+	}
+	if l.expired.Load() {
+		return ErrLeaseExpired
+	}
+	return nil
+}
+
+func (l *lease) executeWithSessionId(shardId int64, callback func(int64, error)) {
+	if err := l.checkValid(); err != nil {
+		callback(-1, err)
+		return
+	}
+
+	l.sessions.executeWithSessionId(shardId, callback)
+}
+
+func (l *lease) KeepAliveOnce(ctx context.Context) error {
+	if err := l.checkValid(); err != nil {
+		return err
+	}
+
+	l.sessions.Lock()
+	sessions := make([]*clientSession, 0, len(l.sessions.sessionsByShard))
+	for _, cs := range l.sessions.sessionsByShard {
+		sessions = append(sessions, cs)
+	}
+	l.sessions.Unlock()
+
+	for _, cs := range sessions {
+		err := cs.keepAliveOnce(ctx)
+		if status.Code(err) == constant.CodeSessionNotFound {
+			l.expired.Store(true)
+			l.sessions.notify(SessionEvent{Type: SessionExpired, Shard: cs.shardId, SessionId: cs.id(), Err: err})
+			return ErrLeaseExpired
+		} else if err != nil {
+			return errors.Wrap(err, "failed to keep alive the lease")
+		}
+	}
+
+	return nil
+}
+
+func (l *lease) Revoke() error {
+	if l.revoked.Swap(true) {
+		return nil
+	}
+
+	l.client.removeLease(l)
+	return l.sessions.Close()
+}
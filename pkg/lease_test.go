@@ -0,0 +1,106 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oxia-db/oxia/node"
+)
+
+func TestLease(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+	defer standaloneServer.Close()
+
+	client, err := NewSyncClient(standaloneServer.ServiceAddr())
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = client.GrantLease(ctx, 0)
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+
+	lease, err := client.GrantLease(ctx, 3*time.Second)
+	assert.NoError(t, err)
+	assert.Equal(t, 3*time.Second, lease.TTL())
+
+	_, version, err := client.Put(ctx, "/lease/a", []byte("a"), WithLease(lease))
+	assert.NoError(t, err)
+	assert.True(t, version.Ephemeral)
+
+	// The record survives for as long as the lease is kept alive
+	for i := 0; i < 5; i++ {
+		time.Sleep(1 * time.Second)
+		assert.NoError(t, lease.KeepAliveOnce(ctx))
+	}
+	_, _, _, err = client.Get(ctx, "/lease/a")
+	assert.NoError(t, err)
+
+	// Records attached to the client session are not affected by the lease expiration
+	_, _, err = client.Put(ctx, "/lease/b", []byte("b"), Ephemeral())
+	assert.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		_, _, _, err := client.Get(ctx, "/lease/a")
+		return errors.Is(err, ErrKeyNotFound)
+	}, 30*time.Second, 100*time.Millisecond)
+
+	assert.ErrorIs(t, lease.KeepAliveOnce(ctx), ErrLeaseExpired)
+	_, _, err = client.Put(ctx, "/lease/c", []byte("c"), WithLease(lease))
+	assert.ErrorIs(t, err, ErrLeaseExpired)
+
+	_, _, _, err = client.Get(ctx, "/lease/b")
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.Close())
+}
+
+func TestLease_Revoke(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+	defer standaloneServer.Close()
+
+	client, err := NewSyncClient(standaloneServer.ServiceAddr())
+	assert.NoError(t, err)
+	otherClient, err := NewSyncClient(standaloneServer.ServiceAddr())
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	lease, err := client.GrantLease(ctx, 10*time.Second)
+	assert.NoError(t, err)
+
+	_, _, err = otherClient.Put(ctx, "/lease/a", []byte("a"), WithLease(lease))
+	assert.ErrorIs(t, err, ErrInvalidOptions)
+
+	_, _, err = client.Put(ctx, "/lease/a", []byte("a"), WithLease(lease))
+	assert.NoError(t, err)
+
+	assert.NoError(t, lease.Revoke())
+
+	_, _, _, err = client.Get(ctx, "/lease/a")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	assert.ErrorIs(t, lease.KeepAliveOnce(ctx), ErrLeaseRevoked)
+	_, _, err = client.Put(ctx, "/lease/a", []byte("a"), WithLease(lease))
+	assert.ErrorIs(t, err, ErrLeaseRevoked)
+
+	assert.NoError(t, client.Close())
+	assert.NoError(t, otherClient.Close())
+}
@@ -0,0 +1,148 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"io"
+	"sync"
+
+	"go.uber.org/multierr"
+)
+
+// MultiNamespaceClient gives access to multiple namespaces of the same Oxia
+// cluster. The clients of all the namespaces share the gRPC connections and
+// the metrics, while each of them has its own shard assignments, sessions and
+// batchers.
+type MultiNamespaceClient interface {
+	io.Closer
+
+	// Namespace returns the client for the given namespace. The same client is
+	// returned for as long as it's not closed.
+	Namespace(name string) (SyncClient, error)
+}
+
+type multiNamespaceClient struct {
+	sync.Mutex
+
+	options   clientOptions
+	resources *clientResources
+	clients   map[string]*syncClientImpl
+	closed    bool
+}
+
+// NewMultiNamespaceClient creates a new Oxia client that can access multiple
+// namespaces through a single pool of connections.
+//
+// The ServiceAddress and the ClientOption arguments are the same as in [NewSyncClient],
+// and apply to the clients of all the namespaces. The [WithNamespace] option is ignored.
+// Example:
+//
+//	client, err := oxia.NewMultiNamespaceClient("my-oxia-service:6648")
+//	users, err := client.Namespace("users")
+func NewMultiNamespaceClient(serviceAddress string, opts ...ClientOption) (MultiNamespaceClient, error) {
+	options, err := newClientOptions(serviceAddress, append([]ClientOption{WithAdaptiveBatchLinger(DefaultBatchLinger)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, err := newClientResources(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return &multiNamespaceClient{
+		options:   options,
+		resources: resources,
+		clients:   make(map[string]*syncClientImpl),
+	}, nil
+}
+
+func (m *multiNamespaceClient) Namespace(name string) (SyncClient, error) {
+	if name == "" {
+		return nil, ErrInvalidOptionNamespace
+	}
+
+	c, err := m.get(name)
+	if err != nil {
+		return nil, err
+	}
+	if c != nil {
+		return c, nil
+	}
+
+	// The client is created without holding the lock, since it can take long
+	// to reach the cluster, and the other namespaces must not wait for it
+	options := m.options
+	options.namespace = name
+	asyncClient, err := newAsyncClient(options, m.resources, true)
+	if err != nil {
+		return nil, err
+	}
+
+	m.Lock()
+	defer m.Unlock()
+
+	existing, ok := m.clients[name]
+	if m.closed || ok {
+		// Closed, or created concurrently by another caller
+		err = asyncClient.Close()
+		if m.closed {
+			return nil, multierr.Append(ErrClientClosed, err)
+		}
+		return existing, nil
+	}
+
+	c = newSyncClient(asyncClient).(*syncClientImpl)
+	c.onClose = func() { m.remove(name, c) }
+	m.clients[name] = c
+	return c, nil
+}
+
+func (m *multiNamespaceClient) get(name string) (*syncClientImpl, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.closed {
+		return nil, ErrClientClosed
+	}
+	return m.clients[name], nil
+}
+
+func (m *multiNamespaceClient) remove(name string, c *syncClientImpl) {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.clients[name] == c {
+		delete(m.clients, name)
+	}
+}
+
+func (m *multiNamespaceClient) Close() error {
+	m.Lock()
+	if m.closed {
+		m.Unlock()
+		return nil
+	}
+	m.closed = true
+	clients := m.clients
+	m.clients = make(map[string]*syncClientImpl)
+	m.Unlock()
+
+	var err error
+	for _, c := range clients {
+		err = multierr.Append(err, c.Close())
+	}
+	return multierr.Append(err, m.resources.clientPool.Close())
+}
@@ -0,0 +1,100 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oxia-db/oxia/node"
+)
+
+func TestMultiNamespaceClient(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+	defer standaloneServer.Close()
+
+	client, err := NewMultiNamespaceClient(standaloneServer.ServiceAddr())
+	assert.NoError(t, err)
+
+	_, err = client.Namespace("")
+	assert.ErrorIs(t, err, ErrInvalidOptionNamespace)
+
+	// The namespace doesn't exist, though the other namespaces are still usable
+	_, err = client.Namespace("not-existing")
+	assert.Error(t, err)
+
+	ns, err := client.Namespace(DefaultNamespace)
+	assert.NoError(t, err)
+
+	same, err := client.Namespace(DefaultNamespace)
+	assert.NoError(t, err)
+	assert.Same(t, ns, same)
+
+	ctx := context.Background()
+	_, _, err = ns.Put(ctx, "/a", []byte("0"))
+	assert.NoError(t, err)
+
+	// Closing the client of a namespace doesn't affect the shared connections
+	assert.NoError(t, ns.Close())
+
+	ns, err = client.Namespace(DefaultNamespace)
+	assert.NoError(t, err)
+	assert.NotSame(t, same, ns)
+
+	_, value, _, err := ns.Get(ctx, "/a")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("0"), value)
+
+	assert.NoError(t, client.Close())
+
+	_, err = client.Namespace(DefaultNamespace)
+	assert.ErrorIs(t, err, ErrClientClosed)
+}
+
+func TestMultiNamespaceClient_Concurrent(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+	defer standaloneServer.Close()
+
+	client, err := NewMultiNamespaceClient(standaloneServer.ServiceAddr())
+	assert.NoError(t, err)
+
+	// The clients created concurrently for the same namespace are all
+	// discarded, except one
+	clients := make([]SyncClient, 5)
+	var wg sync.WaitGroup
+	for i := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := client.Namespace(DefaultNamespace)
+			assert.NoError(t, err)
+			clients[i] = c
+		}()
+	}
+	wg.Wait()
+
+	for _, c := range clients {
+		assert.Same(t, clients[0], c)
+	}
+	_, _, err = clients[0].Put(context.Background(), "/a", []byte("0"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, client.Close())
+}
@@ -20,24 +20,41 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff/v4"
+	"go.uber.org/multierr"
 
 	"github.com/oxia-db/oxia/common/concurrent"
 	"github.com/oxia-db/oxia/common/process"
 	"github.com/oxia-db/oxia/common/rpc"
-	time2 "github.com/oxia-db/oxia/common/time"
 
-	"github.com/oxia-db/oxia/oxia/internal"
+	"github.com/oxia-db/oxia-client-golang/internal"
+	"github.com/oxia-db/oxia-client-golang/internal/metrics"
 	"github.com/oxia-db/oxia/proto"
 )
 
 type notifications struct {
 	multiplexCh  chan *Notification
-	closeCh      chan any
 	shardManager internal.ShardManager
 	clientPool   rpc.ClientPool
+	retrier      *internal.Retrier
+	options      *notificationsOptions
+	metrics      *metrics.NotificationsMetrics
+
+	// Guards the overflow handling, when the policy is not [OverflowBlock]
+	overflowMutex    sync.Mutex
+	spill            *spillBuffer
+	spillNotEmptyC   chan struct{}
+	spillSpaceC      chan struct{}
+	spillDrainerDone chan struct{}
+
+	// Guards the set of shards being followed
+	shardsMutex    sync.Mutex
+	shardManagers  map[int64]*shardNotificationsManager
+	shardsWg       sync.WaitGroup
+	removeListener func()
 
 	initWaitGroup concurrent.WaitGroup
 	ctx           context.Context
@@ -47,23 +64,53 @@ type notifications struct {
 	cancelMultiplexChanClosed context.CancelFunc
 }
 
-func newNotifications(ctx context.Context, options clientOptions, clientPool rpc.ClientPool, shardManager internal.ShardManager) (*notifications, error) {
+func newNotifications(ctx context.Context, options clientOptions, notificationsOpts *notificationsOptions,
+	clientPool rpc.ClientPool, shardManager internal.ShardManager, retrier *internal.Retrier) (*notifications, error) {
 	nm := &notifications{
-		multiplexCh:  make(chan *Notification, 100),
-		closeCh:      make(chan any),
-		shardManager: shardManager,
-		clientPool:   clientPool,
+		multiplexCh:   make(chan *Notification, notificationsOpts.bufferSize),
+		shardManager:  shardManager,
+		clientPool:    clientPool,
+		retrier:       retrier,
+		options:       notificationsOpts,
+		shardManagers: make(map[int64]*shardNotificationsManager),
 	}
 
+	if notificationsOpts.overflowPolicy == OverflowSpillToDisk {
+		var err error
+		if nm.spill, err = newSpillBuffer(notificationsOpts.spillDir, notificationsOpts.maxSpillBytes); err != nil {
+			return nil, err
+		}
+		nm.spillNotEmptyC = make(chan struct{}, 1)
+		nm.spillSpaceC = make(chan struct{}, 1)
+		nm.spillDrainerDone = make(chan struct{})
+	}
+
+	nm.metrics = metrics.NewNotificationsMetrics(options.meterProvider, nm.queueDepth)
 	nm.ctx, nm.cancel = context.WithCancel(ctx)
 	nm.ctxMultiplexChanClosed, nm.cancelMultiplexChanClosed = context.WithCancel(context.Background())
 
-	// Create a notification manager for each shard
+	// Create a notification manager for each shard. The listener is registered
+	// first, so that no assignment change can be missed, though it will not
+	// be able to act until the initial set of shards is in place.
+	nm.shardsMutex.Lock()
+	nm.removeListener = shardManager.AddListener(nm.onShardAssignmentsUpdate)
+
 	shards := shardManager.GetAll()
 	nm.initWaitGroup = concurrent.NewWaitGroup(len(shards))
 
 	for _, shard := range shards {
-		newShardNotificationsManager(shard, nm)
+		nm.startShard(shard, nm.initWaitGroup)
+	}
+	nm.shardsMutex.Unlock()
+
+	if nm.spill != nil {
+		go process.DoWithLabels(
+			nm.ctx,
+			map[string]string{
+				"oxia": "notifications-spill-drainer",
+			},
+			nm.drainSpill,
+		)
 	}
 
 	go process.DoWithLabels(
@@ -72,10 +119,26 @@ func newNotifications(ctx context.Context, options clientOptions, clientPool rpc
 			"oxia": "notifications-manager-close",
 		},
 		func() {
+			<-nm.ctx.Done()
+
+			// Stop following the assignments. Once we have gone through the
+			// mutex, no new shard manager can be started.
+			nm.shardsMutex.Lock()
+			nm.removeListener()
+			nm.shardsMutex.Unlock()
+
 			// Wait until all the shards managers are done before
 			// closing the user-facing channel
-			for i := 0; i < len(shards); i++ {
-				<-nm.closeCh
+			nm.shardsWg.Wait()
+
+			if nm.spill != nil {
+				<-nm.spillDrainerDone
+				if err := nm.spill.Close(); err != nil {
+					slog.Warn(
+						"Failed to remove notifications spill file",
+						slog.Any("error", err),
+					)
+				}
 			}
 
 			close(nm.multiplexCh)
@@ -88,7 +151,8 @@ func newNotifications(ctx context.Context, options clientOptions, clientPool rpc
 	defer cancel()
 
 	if err := nm.initWaitGroup.Wait(timeoutCtx); err != nil {
-		return nil, err
+		nm.cancel()
+		return nil, multierr.Append(err, nm.metrics.Close())
 	}
 
 	return nm, nil
@@ -111,33 +175,266 @@ func (nm *notifications) Close() error {
 	for range nm.multiplexCh { //nolint:revive
 	}
 
+	if nm.metrics != nil {
+		return nm.metrics.Close()
+	}
 	return nil
 }
 
+func (nm *notifications) queueDepth() int64 {
+	depth := int64(len(nm.multiplexCh))
+	if nm.spill != nil {
+		nm.overflowMutex.Lock()
+		depth += int64(nm.spill.Len())
+		nm.overflowMutex.Unlock()
+	}
+	return depth
+}
+
+// Publishes a notification to the user-facing channel, applying the configured
+// overflow policy when the channel is full.
+func (nm *notifications) publish(ctx context.Context, n *Notification) error {
+	switch nm.options.overflowPolicy {
+	case OverflowDropOldest:
+		nm.publishDropOldest(n)
+		return nil
+	case OverflowSpillToDisk:
+		return nm.publishWithSpill(ctx, n)
+	default:
+		select {
+		case nm.multiplexCh <- n:
+			return nil
+
+		// Unblock from channel write when we're closing down
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (nm *notifications) publishDropOldest(n *Notification) {
+	nm.overflowMutex.Lock()
+	defer nm.overflowMutex.Unlock()
+
+	select {
+	case nm.multiplexCh <- n:
+		return
+	default:
+	}
+
+	// The channel is full. Make room for a gap marker and for the
+	// new notification by discarding the oldest ones. Since all the
+	// writers hold the mutex, the space cannot be taken by anyone else.
+	dropped := 0
+	for len(nm.multiplexCh) > cap(nm.multiplexCh)-2 {
+		select {
+		case old := <-nm.multiplexCh:
+			if old.Type == NotificationsDropped {
+				// Carry over the count of a gap marker we're discarding
+				dropped += old.DroppedCount
+			} else {
+				dropped++
+			}
+		default:
+		}
+	}
+
+	nm.metrics.RecordDropped(dropped)
+	nm.multiplexCh <- &Notification{
+		Type:         NotificationsDropped,
+		VersionId:    -1,
+		DroppedCount: dropped,
+	}
+	nm.multiplexCh <- n
+}
+
+func (nm *notifications) publishWithSpill(ctx context.Context, n *Notification) error {
+	for {
+		nm.overflowMutex.Lock()
+
+		// Preserve the ordering: as long as there are spilled notifications,
+		// the new ones have to go through the spill buffer as well
+		if nm.spill.Len() == 0 {
+			select {
+			case nm.multiplexCh <- n:
+				nm.overflowMutex.Unlock()
+				return nil
+			default:
+			}
+		}
+
+		if !nm.spill.IsFull() {
+			err := nm.spill.Push(n)
+			nm.overflowMutex.Unlock()
+			if err != nil {
+				return err
+			}
+
+			nm.metrics.RecordSpilled()
+			signal(nm.spillNotEmptyC)
+			return nil
+		}
+
+		nm.overflowMutex.Unlock()
+
+		// Both the memory and the disk buffers are full, wait for
+		// the consumer to catch up
+		select {
+		case <-nm.spillSpaceC:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Moves the spilled notifications into the user-facing channel, as the
+// consumer makes progress.
+func (nm *notifications) drainSpill() {
+	defer close(nm.spillDrainerDone)
+
+	for {
+		nm.overflowMutex.Lock()
+		n, err := nm.spill.Peek()
+		if err != nil {
+			slog.Error(
+				"Failed to read spilled notifications, discarding them",
+				slog.Any("error", err),
+			)
+
+			dropped := nm.spill.Len()
+			nm.spill.Reset()
+			nm.metrics.RecordDropped(dropped)
+			n = &Notification{
+				Type:         NotificationsDropped,
+				VersionId:    -1,
+				DroppedCount: dropped,
+			}
+		}
+		nm.overflowMutex.Unlock()
+
+		if n == nil {
+			select {
+			case <-nm.spillNotEmptyC:
+				continue
+			case <-nm.ctx.Done():
+				return
+			}
+		}
+
+		select {
+		case nm.multiplexCh <- n:
+		case <-nm.ctx.Done():
+			return
+		}
+
+		nm.overflowMutex.Lock()
+		if err == nil {
+			nm.spill.Pop()
+		}
+		nm.overflowMutex.Unlock()
+
+		signal(nm.spillSpaceC)
+	}
+}
+
+// Must be called while holding the shardsMutex.
+func (nm *notifications) startShard(shard int64, initWaitGroup concurrent.WaitGroup) {
+	nm.shardsWg.Add(1)
+	nm.shardManagers[shard] = newShardNotificationsManager(shard, nm, initWaitGroup)
+}
+
+func (nm *notifications) onShardAssignmentsUpdate(update internal.ShardAssignmentsUpdate) {
+	nm.shardsMutex.Lock()
+	defer nm.shardsMutex.Unlock()
+
+	if nm.ctx.Err() != nil {
+		// Already closed
+		return
+	}
+
+	changed := false
+	for _, shard := range update.Removed {
+		if snm, ok := nm.shardManagers[shard.Id]; ok {
+			snm.log.Info("Shard was removed, stopping notifications")
+			snm.cancel()
+			delete(nm.shardManagers, shard.Id)
+			changed = true
+		}
+	}
+
+	for _, shard := range update.Added {
+		if _, ok := nm.shardManagers[shard.Id]; !ok {
+			slog.Info(
+				"Shard was added, starting notifications",
+				slog.Int64("shard", shard.Id),
+			)
+			nm.startShard(shard.Id, nil)
+			changed = true
+		}
+	}
+
+	if !changed || !nm.options.topologyEvents {
+		return
+	}
+
+	// The listener is invoked from the shard assignments stream, we
+	// cannot block it while waiting for the consumer
+	nm.shardsWg.Add(1)
+	go process.DoWithLabels(
+		nm.ctx,
+		map[string]string{
+			"oxia": "notifications-topology-change",
+		},
+		func() {
+			defer nm.shardsWg.Done()
+			_ = nm.publish(nm.ctx, &Notification{
+				Type:      ShardTopologyChanged,
+				VersionId: -1,
+			})
+		},
+	)
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+var notificationsRetryOperation = internal.RetryOperation{Type: internal.RetryOperationNotifications, Idempotent: true}
+
 // Manages the notifications for a specific shard.
 type shardNotificationsManager struct {
 	shard              int64
 	ctx                context.Context
+	cancel             context.CancelFunc
 	nm                 *notifications
+	initWaitGroup      concurrent.WaitGroup
 	backoff            backoff.BackOff
 	lastOffsetReceived int64
 	initialized        bool
+	streamFailed       bool
 	log                *slog.Logger
 }
 
-func newShardNotificationsManager(shard int64, nm *notifications) *shardNotificationsManager {
+// The initWaitGroup is only set for the shards that are present when the
+// subscription is created.
+func newShardNotificationsManager(shard int64, nm *notifications, initWaitGroup concurrent.WaitGroup) *shardNotificationsManager {
 	snm := &shardNotificationsManager{
 		shard:              shard,
-		ctx:                nm.ctx,
 		nm:                 nm,
+		initWaitGroup:      initWaitGroup,
 		lastOffsetReceived: -1,
-		backoff:            time2.NewBackOffWithInitialInterval(nm.ctx, 1*time.Second),
 		log: slog.With(
 			slog.String("component", "oxia-notifications-manager"),
 			slog.Int64("shard", shard),
 		),
 	}
 
+	snm.ctx, snm.cancel = context.WithCancel(nm.ctx)
+	snm.backoff = nm.retrier.NewBackOff(snm.ctx, notificationsRetryOperation)
+
 	go process.DoWithLabels(
 		snm.ctx,
 		map[string]string{
@@ -151,8 +448,8 @@ func newShardNotificationsManager(shard int64, nm *notifications) *shardNotifica
 }
 
 func (snm *shardNotificationsManager) getNotificationsWithRetries() { //nolint:revive
-	_ = backoff.RetryNotify(snm.getNotifications,
-		snm.backoff, func(err error, duration time.Duration) {
+	_ = snm.nm.retrier.Retry(notificationsRetryOperation, snm.backoff, snm.getNotifications,
+		func(err error, duration time.Duration) {
 			if !errors.Is(err, context.Canceled) {
 				snm.log.Error(
 					"Error while getting notifications",
@@ -161,15 +458,16 @@ func (snm *shardNotificationsManager) getNotificationsWithRetries() { //nolint:r
 				)
 			}
 
-			if !snm.initialized {
+			if !snm.initialized && snm.initWaitGroup != nil {
 				snm.initialized = true
-				snm.nm.initWaitGroup.Fail(err)
+				snm.initWaitGroup.Fail(err)
 				snm.nm.cancel()
 			}
+			snm.streamFailed = true
 		})
 
 	// Signal that this shard notification manager is now closed
-	snm.nm.closeCh <- nil
+	snm.nm.shardsWg.Done()
 }
 
 func (snm *shardNotificationsManager) multiplexNotificationBatch(nb *proto.NotificationBatch) error {
@@ -180,20 +478,20 @@ func (snm *shardNotificationsManager) multiplexNotificationBatch(nb *proto.Notif
 		// needed to ensure that the notification cursor is created on the
 		// server side.
 		snm.initialized = true
-		snm.nm.initWaitGroup.Done()
+		if snm.initWaitGroup != nil {
+			snm.initWaitGroup.Done()
+		}
 		snm.lastOffsetReceived = nb.Offset
 		return nil
 	}
 
 	for key, n := range nb.Notifications {
-		select {
-		case snm.nm.multiplexCh <- convertNotification(key, n):
-
-		// Unblock from channel write when we're closing down
-		case <-snm.ctx.Done():
-			return snm.ctx.Err()
+		if err := snm.nm.publish(snm.ctx, convertNotification(key, n)); err != nil {
+			return err
 		}
 	}
+
+	snm.nm.metrics.RecordLag(snm.shard, nb.Timestamp)
 	return nil
 }
 
@@ -233,7 +531,10 @@ func (snm *shardNotificationsManager) multiplexNotifications(notifications proto
 }
 
 func (snm *shardNotificationsManager) getNotifications() error {
-	leader := snm.nm.shardManager.Leader(snm.shard)
+	leader, err := snm.nm.shardManager.Leader(snm.shard)
+	if err != nil {
+		return err
+	}
 
 	client, err := snm.nm.clientPool.GetClientRpc(leader)
 	if err != nil {
@@ -258,6 +559,21 @@ func (snm *shardNotificationsManager) getNotifications() error {
 
 	snm.backoff.Reset()
 
+	if snm.streamFailed && snm.initialized {
+		snm.streamFailed = false
+		snm.log.Info("Notifications stream re-established")
+		if snm.nm.options.restartEvents {
+			err := snm.nm.publish(snm.ctx, &Notification{
+				Type:       NotificationsStreamRestarted,
+				VersionId:  -1,
+				OffsetLost: startOffsetExclusive == nil,
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
 	return snm.multiplexNotifications(notifications)
 }
 
@@ -0,0 +1,150 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.uber.org/multierr"
+)
+
+const spillRecordHeaderSize = 4
+
+// spillBuffer is a FIFO queue of notifications backed by a temporary file.
+//
+// Records are appended as a length-prefixed JSON encoding of the notification.
+// The file is truncated every time the queue becomes empty, so that the disk
+// usage is bounded by the max size of the buffer.
+//
+// The spillBuffer is not thread-safe.
+type spillBuffer struct {
+	file        *os.File
+	maxBytes    int64
+	readOffset  int64
+	writeOffset int64
+	count       int
+
+	head     *Notification
+	headSize int64
+}
+
+func newSpillBuffer(dir string, maxBytes int64) (*spillBuffer, error) {
+	file, err := os.CreateTemp(dir, "oxia-notifications-*.spill")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create notifications spill file")
+	}
+
+	return &spillBuffer{
+		file:     file,
+		maxBytes: maxBytes,
+	}, nil
+}
+
+func (sb *spillBuffer) Len() int {
+	return sb.count
+}
+
+func (sb *spillBuffer) IsFull() bool {
+	return sb.writeOffset-sb.readOffset >= sb.maxBytes
+}
+
+func (sb *spillBuffer) Push(n *Notification) error {
+	data, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	record := make([]byte, spillRecordHeaderSize+len(data))
+	binary.BigEndian.PutUint32(record, uint32(len(data)))
+	copy(record[spillRecordHeaderSize:], data)
+
+	if _, err = sb.file.WriteAt(record, sb.writeOffset); err != nil {
+		return errors.Wrap(err, "failed to write to notifications spill file")
+	}
+
+	sb.writeOffset += int64(len(record))
+	sb.count++
+	return nil
+}
+
+// Peek returns the oldest notification in the buffer, without removing it.
+// It returns nil if the buffer is empty.
+func (sb *spillBuffer) Peek() (*Notification, error) {
+	if sb.count == 0 {
+		return nil, nil
+	}
+
+	if sb.head != nil {
+		return sb.head, nil
+	}
+
+	header := make([]byte, spillRecordHeaderSize)
+	if _, err := sb.file.ReadAt(header, sb.readOffset); err != nil {
+		return nil, errors.Wrap(err, "failed to read from notifications spill file")
+	}
+
+	data := make([]byte, binary.BigEndian.Uint32(header))
+	if _, err := sb.file.ReadAt(data, sb.readOffset+spillRecordHeaderSize); err != nil {
+		return nil, errors.Wrap(err, "failed to read from notifications spill file")
+	}
+
+	n := &Notification{}
+	if err := json.Unmarshal(data, n); err != nil {
+		return nil, errors.Wrap(err, "failed to decode spilled notification")
+	}
+
+	sb.head = n
+	sb.headSize = int64(spillRecordHeaderSize + len(data))
+	return n, nil
+}
+
+// Pop removes the notification previously returned by Peek.
+func (sb *spillBuffer) Pop() {
+	if sb.head == nil {
+		return
+	}
+
+	sb.readOffset += sb.headSize
+	sb.count--
+	sb.head = nil
+	sb.headSize = 0
+
+	if sb.count == 0 {
+		sb.Reset()
+	}
+}
+
+// Reset discards all the notifications in the buffer.
+func (sb *spillBuffer) Reset() {
+	sb.readOffset = 0
+	sb.writeOffset = 0
+	sb.count = 0
+	sb.head = nil
+	sb.headSize = 0
+
+	// Reclaim the disk space. A failure here is harmless, since we are
+	// going to overwrite the file from the beginning anyway.
+	_ = sb.file.Truncate(0)
+}
+
+func (sb *spillBuffer) Close() error {
+	return multierr.Combine(
+		sb.file.Close(),
+		os.Remove(sb.file.Name()),
+	)
+}
@@ -16,9 +16,14 @@ package oxia
 
 import (
 	"context"
+	"log/slog"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/metric/noop"
+
+	"github.com/oxia-db/oxia-client-golang/internal"
+	"github.com/oxia-db/oxia-client-golang/internal/metrics"
 )
 
 func TestNotificationsClose(t *testing.T) {
@@ -49,3 +54,141 @@ func TestNotificationsClose(t *testing.T) {
 	assert.Equal(t, false, ok)
 	assert.Nil(t, n)
 }
+
+func TestNotificationsOptions(t *testing.T) {
+	for _, item := range []struct {
+		name        string
+		options     []NotificationsOption
+		expectedErr error
+	}{
+		{"default", nil, nil},
+		{"zero buffer", []NotificationsOption{NotificationsBufferSize(0)}, ErrInvalidOptions},
+		{"drop-oldest small buffer", []NotificationsOption{
+			NotificationsBufferSize(1), NotificationsOverflowPolicy(OverflowDropOldest)}, ErrInvalidOptions},
+		{"drop-oldest", []NotificationsOption{
+			NotificationsBufferSize(2), NotificationsOverflowPolicy(OverflowDropOldest)}, nil},
+		{"spill zero size", []NotificationsOption{NotificationsSpillToDisk("", 0)}, ErrInvalidOptions},
+	} {
+		t.Run(item.name, func(t *testing.T) {
+			_, err := newNotificationsOptions(item.options)
+			assert.ErrorIs(t, err, item.expectedErr)
+		})
+	}
+}
+
+func TestNotificationsDropOldest(t *testing.T) {
+	nm := &notifications{
+		multiplexCh: make(chan *Notification, 3),
+		options: &notificationsOptions{
+			overflowPolicy: OverflowDropOldest,
+		},
+	}
+	nm.metrics = metrics.NewNotificationsMetrics(noop.NewMeterProvider(), nm.queueDepth)
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		assert.NoError(t, nm.publish(context.Background(), &Notification{Key: key}))
+	}
+
+	assert.Equal(t, 3, len(nm.multiplexCh))
+
+	n := <-nm.multiplexCh
+	assert.Equal(t, "d", n.Key)
+
+	n = <-nm.multiplexCh
+	assert.Equal(t, NotificationsDropped, n.Type)
+	assert.Equal(t, 3, n.DroppedCount)
+
+	n = <-nm.multiplexCh
+	assert.Equal(t, "e", n.Key)
+}
+
+func TestNotificationsSpillToDisk(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	spill, err := newSpillBuffer(t.TempDir(), 1024*1024)
+	assert.NoError(t, err)
+
+	nm := &notifications{
+		multiplexCh: make(chan *Notification, 2),
+		options: &notificationsOptions{
+			overflowPolicy: OverflowSpillToDisk,
+		},
+		spill:            spill,
+		spillNotEmptyC:   make(chan struct{}, 1),
+		spillSpaceC:      make(chan struct{}, 1),
+		spillDrainerDone: make(chan struct{}),
+		ctx:              ctx,
+	}
+	nm.metrics = metrics.NewNotificationsMetrics(noop.NewMeterProvider(), nm.queueDepth)
+
+	keys := []string{"a", "b", "c", "d", "e"}
+	for _, key := range keys {
+		assert.NoError(t, nm.publish(ctx, &Notification{Key: key, VersionId: 1}))
+	}
+	assert.EqualValues(t, 5, nm.queueDepth())
+
+	go nm.drainSpill()
+
+	for _, key := range keys {
+		n := <-nm.multiplexCh
+		assert.Equal(t, key, n.Key)
+		assert.EqualValues(t, 1, n.VersionId)
+	}
+
+	cancel()
+	<-nm.spillDrainerDone
+	assert.NoError(t, spill.Close())
+}
+
+func TestSpillBuffer(t *testing.T) {
+	sb, err := newSpillBuffer(t.TempDir(), 100)
+	assert.NoError(t, err)
+
+	n, err := sb.Peek()
+	assert.NoError(t, err)
+	assert.Nil(t, n)
+
+	for !sb.IsFull() {
+		assert.NoError(t, sb.Push(&Notification{Type: KeyModified, Key: "/key"}))
+	}
+	count := sb.Len()
+	assert.Greater(t, count, 1)
+
+	for i := 0; i < count; i++ {
+		n, err = sb.Peek()
+		assert.NoError(t, err)
+		assert.Equal(t, &Notification{Type: KeyModified, Key: "/key"}, n)
+		sb.Pop()
+	}
+
+	assert.Equal(t, 0, sb.Len())
+	assert.False(t, sb.IsFull())
+	assert.NoError(t, sb.Close())
+}
+
+func TestNotificationsTopologyEventsOptIn(t *testing.T) {
+	for _, topologyEvents := range []bool{false, true} {
+		nm := &notifications{
+			multiplexCh: make(chan *Notification, 1),
+			options:     &notificationsOptions{topologyEvents: topologyEvents},
+			shardManagers: map[int64]*shardNotificationsManager{
+				1: {shard: 1, cancel: func() {}, log: slog.Default()},
+			},
+		}
+		nm.ctx, nm.cancel = context.WithCancel(context.Background())
+
+		nm.onShardAssignmentsUpdate(internal.ShardAssignmentsUpdate{Removed: []internal.Shard{{Id: 1}}})
+		nm.shardsWg.Wait()
+
+		assert.Empty(t, nm.shardManagers)
+		if topologyEvents {
+			n := <-nm.multiplexCh
+			assert.Equal(t, ShardTopologyChanged, n.Type)
+			assert.EqualValues(t, -1, n.VersionId)
+		} else {
+			assert.Empty(t, nm.multiplexCh)
+		}
+		nm.cancel()
+	}
+}
@@ -14,6 +14,12 @@
 
 package oxia
 
+import (
+	"context"
+
+	"github.com/oxia-db/oxia-client-golang/pkg/batch"
+)
+
 // BaseOption is an option that applies to all the client operations.
 type BaseOption interface {
 	PutOption
@@ -27,6 +33,8 @@ type BaseOption interface {
 
 type baseOptions struct {
 	partitionKey *string
+	priority     PriorityLevel
+	ctx          context.Context
 }
 
 type baseOptionsIf interface {
@@ -80,3 +88,99 @@ func PartitionKey(partitionKey string) BaseOption {
 		partitionKey: &partitionKey,
 	}
 }
+
+// --------------------------------------------------------------------------------------------
+
+// ContextOption is an option that ties an operation to a context. See [WithContext].
+type ContextOption interface {
+	PutOption
+	GetOption
+	DeleteOption
+	DeleteRangeOption
+}
+
+type contextOpt struct {
+	ctx context.Context
+}
+
+func (o *contextOpt) applyPut(opts *putOptions) {
+	opts.ctx = o.ctx
+}
+
+func (o *contextOpt) applyDelete(opts *deleteOptions) {
+	opts.ctx = o.ctx
+}
+
+func (o *contextOpt) applyDeleteRange(opts *deleteRangeOptions) {
+	opts.ctx = o.ctx
+}
+
+func (o *contextOpt) applyGet(opts *getOptions) {
+	opts.ctx = o.ctx
+}
+
+// WithContext ties an operation of the [AsyncClient] to a context.
+// If the context is done before the operation is sent to the server, the
+// operation is dropped and fails with the error of the context. The deadline
+// of the context also bounds the request that carries the operation.
+//
+// The [SyncClient] operations are always tied to the context they're invoked with.
+func WithContext(ctx context.Context) ContextOption {
+	return &contextOpt{ctx}
+}
+
+// --------------------------------------------------------------------------------------------
+
+// PriorityLevel is the priority with which an operation is sent. See [Priority].
+type PriorityLevel = batch.Priority
+
+const (
+	// PriorityNormal is the default priority of the operations.
+	PriorityNormal = batch.PriorityNormal
+
+	// PriorityHigh is meant for the operations that are latency sensitive, like
+	// the ones of leases and locks.
+	PriorityHigh = batch.PriorityHigh
+)
+
+// PriorityOption is an option that sets the priority of an operation. See [Priority].
+type PriorityOption interface {
+	PutOption
+	GetOption
+	DeleteOption
+	DeleteRangeOption
+}
+
+type priorityOpt struct {
+	priority PriorityLevel
+}
+
+func (o *priorityOpt) applyPut(opts *putOptions) {
+	opts.priority = o.priority
+}
+
+func (o *priorityOpt) applyDelete(opts *deleteOptions) {
+	opts.priority = o.priority
+}
+
+func (o *priorityOpt) applyDeleteRange(opts *deleteRangeOptions) {
+	opts.priority = o.priority
+}
+
+func (o *priorityOpt) applyGet(opts *getOptions) {
+	opts.priority = o.priority
+}
+
+// Priority sets the priority of an operation. Within the requests to a shard,
+// the operations with [PriorityHigh] are sent in batches of their own, ahead of
+// the ones with [PriorityNormal], and without waiting for the batch linger. To
+// keep the normal operations from being starved, a few batches of high
+// priority operations at most are sent in a row.
+//
+// Since they are not ordered with respect to each other, a high priority write
+// can overtake an earlier normal priority write to the same key, which would
+// then be applied last. The writes whose order matters should be sent with the
+// same priority.
+func Priority(level PriorityLevel) PriorityOption {
+	return &priorityOpt{level}
+}
@@ -0,0 +1,233 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultCacheMaxCost     = 64 * 1024 * 1024
+	DefaultCacheTTL         = 5 * time.Minute
+	DefaultCacheNegativeTTL = 5 * time.Minute
+	DefaultCacheName        = "default"
+)
+
+type cacheOptions struct {
+	name        string
+	maxCost     int64
+	ttl         time.Duration
+	negativeTTL time.Duration
+	consistency ConsistencyLevel
+
+	refreshAhead         float64
+	staleWhileRevalidate time.Duration
+}
+
+// CacheOption represents an option for [NewCache].
+type CacheOption interface {
+	applyCache(opts *cacheOptions)
+}
+
+func newCacheOptions(opts []CacheOption) (*cacheOptions, error) {
+	cacheOpts := &cacheOptions{
+		name:        DefaultCacheName,
+		ttl:         DefaultCacheTTL,
+		negativeTTL: DefaultCacheNegativeTTL,
+	}
+	for _, opt := range opts {
+		opt.applyCache(cacheOpts)
+	}
+
+	if cacheOpts.maxCost < 0 {
+		return nil, errors.Wrap(ErrInvalidOptions, "cache max cost must be greater than zero")
+	}
+	if cacheOpts.ttl <= 0 {
+		return nil, errors.Wrap(ErrInvalidOptions, "cache TTL must be greater than zero")
+	}
+	if cacheOpts.negativeTTL < 0 {
+		return nil, errors.Wrap(ErrInvalidOptions, "cache negative TTL must not be negative")
+	}
+	if cacheOpts.refreshAhead < 0 || cacheOpts.refreshAhead >= 1 {
+		return nil, errors.Wrap(ErrInvalidOptions, "cache refresh-ahead factor must be in the range [0, 1)")
+	}
+	if cacheOpts.staleWhileRevalidate < 0 {
+		return nil, errors.Wrap(ErrInvalidOptions, "cache stale-while-revalidate window must not be negative")
+	}
+	if cacheOpts.consistency != ConsistencyEventual && cacheOpts.consistency != ConsistencyVerified {
+		return nil, errors.Wrap(ErrInvalidOptions, "invalid cache consistency level")
+	}
+	return cacheOpts, nil
+}
+
+type cacheName struct {
+	name string
+}
+
+func (o *cacheName) applyCache(opts *cacheOptions) {
+	opts.name = o.name
+}
+
+// CacheName sets the name used to identify the cache in the metrics.
+func CacheName(name string) CacheOption {
+	return &cacheName{name}
+}
+
+type cacheMaxCost struct {
+	maxCost int64
+}
+
+func (o *cacheMaxCost) applyCache(opts *cacheOptions) {
+	opts.maxCost = o.maxCost
+}
+
+// CacheMaxCost sets the max size, in bytes, of the serialized values held by the
+// cache. Default is [DefaultCacheMaxCost].
+//
+// When set, the cache will not take part in the memory budget shared by the other
+// caches of the client. See [WithCacheMemoryBudget].
+func CacheMaxCost(maxCost int64) CacheOption {
+	return &cacheMaxCost{maxCost}
+}
+
+type cacheTTL struct {
+	ttl time.Duration
+}
+
+func (o *cacheTTL) applyCache(opts *cacheOptions) {
+	opts.ttl = o.ttl
+}
+
+// CacheTTL sets how long a value is kept in the cache after it was read from the
+// server. Default is [DefaultCacheTTL].
+func CacheTTL(ttl time.Duration) CacheOption {
+	return &cacheTTL{ttl}
+}
+
+type cacheNegativeTTL struct {
+	negativeTTL time.Duration
+}
+
+func (o *cacheNegativeTTL) applyCache(opts *cacheOptions) {
+	opts.negativeTTL = o.negativeTTL
+}
+
+// CacheNegativeTTL sets how long the cache remembers that a key does not exist.
+// A value of zero disables the caching of non-existing keys.
+// Default is [DefaultCacheNegativeTTL].
+func CacheNegativeTTL(negativeTTL time.Duration) CacheOption {
+	return &cacheNegativeTTL{negativeTTL}
+}
+
+type cacheRefreshAhead struct {
+	factor float64
+}
+
+func (o *cacheRefreshAhead) applyCache(opts *cacheOptions) {
+	opts.refreshAhead = o.factor
+}
+
+// CacheRefreshAhead enables the background reload of the entries that are read
+// after `factor` of their TTL has elapsed, so that popular entries do not expire.
+// eg: with a factor of 0.8 and a TTL of 5 minutes, an entry read after 4 minutes
+// is reloaded, while the cached value is returned.
+// The factor must be in the range [0, 1). Default is 0, which disables it.
+func CacheRefreshAhead(factor float64) CacheOption {
+	return &cacheRefreshAhead{factor}
+}
+
+type cacheStaleWhileRevalidate struct {
+	window time.Duration
+}
+
+func (o *cacheStaleWhileRevalidate) applyCache(opts *cacheOptions) {
+	opts.staleWhileRevalidate = o.window
+}
+
+// CacheStaleWhileRevalidate keeps serving the entries for up to `window` after
+// their TTL has expired, while a single background load refreshes them.
+// Default is 0, which disables it.
+func CacheStaleWhileRevalidate(window time.Duration) CacheOption {
+	return &cacheStaleWhileRevalidate{window}
+}
+
+// ConsistencyLevel controls whether the values served by a [Cache] can be stale.
+type ConsistencyLevel int
+
+const (
+	// ConsistencyEventual serves the cached values as they are. Changes made by other
+	// clients are reflected once the corresponding notification is received.
+	ConsistencyEventual ConsistencyLevel = iota
+	// ConsistencyVerified checks the version of a cached value against the server
+	// before returning it, without transferring the value itself. The value is reloaded
+	// if it was changed.
+	ConsistencyVerified
+)
+
+func (l ConsistencyLevel) String() string {
+	switch l {
+	case ConsistencyEventual:
+		return "eventual"
+	case ConsistencyVerified:
+		return "verified"
+	}
+	return "unknown"
+}
+
+// CacheGetOption represents an option for the [Cache.Get] operation.
+type CacheGetOption interface {
+	applyCacheGet(opts *cacheGetOptions)
+}
+
+type cacheGetOptions struct {
+	consistency ConsistencyLevel
+}
+
+func newCacheGetOptions(defaults *cacheOptions, opts []CacheGetOption) *cacheGetOptions {
+	getOpts := &cacheGetOptions{
+		consistency: defaults.consistency,
+	}
+	for _, opt := range opts {
+		opt.applyCacheGet(getOpts)
+	}
+	return getOpts
+}
+
+// ConsistencyOption is an option that applies both to [NewCache], to set the default
+// for all the reads, and to [Cache.Get], to override it for a single read.
+type ConsistencyOption interface {
+	CacheOption
+	CacheGetOption
+}
+
+type consistency struct {
+	level ConsistencyLevel
+}
+
+func (o *consistency) applyCache(opts *cacheOptions) {
+	opts.consistency = o.level
+}
+
+func (o *consistency) applyCacheGet(opts *cacheGetOptions) {
+	opts.consistency = o.level
+}
+
+// Consistency sets the [ConsistencyLevel] of the cache reads.
+// Default is [ConsistencyEventual].
+func Consistency(level ConsistencyLevel) ConsistencyOption {
+	return &consistency{level}
+}
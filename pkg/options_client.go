@@ -31,40 +31,88 @@ import (
 )
 
 const (
-	DefaultBatchLinger         = 5 * time.Millisecond
-	DefaultMaxRequestsPerBatch = 1000
-	DefaultMaxBatchSize        = 128 * 1024
-	DefaultRequestTimeout      = 30 * time.Second
-	DefaultSessionTimeout      = 15 * time.Second
-	DefaultNamespace           = constant.DefaultNamespace
+	DefaultBatchLinger          = 5 * time.Millisecond
+	DefaultMaxRequestsPerBatch  = 1000
+	DefaultMaxBatchSize         = 128 * 1024
+	DefaultMaxReadBatchSize     = 1024 * 1024
+	DefaultWriteStreamsPerShard = 1
+	DefaultRequestTimeout       = 30 * time.Second
+	DefaultSessionTimeout       = 15 * time.Second
+	DefaultNamespace            = constant.DefaultNamespace
 )
 
 var (
-	ErrInvalidOptionBatchLinger         = errors.New("BatchLinger must be greater than or equal to zero")
-	ErrInvalidOptionMaxRequestsPerBatch = errors.New("MaxRequestsPerBatch must be greater than zero")
-	ErrInvalidOptionMaxBatchSize        = errors.New("MaxBatchSize must be greater than zero")
-	ErrInvalidOptionRequestTimeout      = errors.New("RequestTimeout must be greater than zero")
-	ErrInvalidOptionSessionTimeout      = errors.New("SessionTimeout must be greater than zero")
-	ErrInvalidOptionIdentity            = errors.New("Identity must be non-empty")
-	ErrInvalidOptionNamespace           = errors.New("Namespace cannot be empty")
-	ErrInvalidOptionTLS                 = errors.New("Tls cannot be empty")
-	ErrInvalidOptionAuthentication      = errors.New("Authentication cannot be empty")
+	ErrInvalidOptionBatchLinger          = errors.New("BatchLinger must be greater than or equal to zero")
+	ErrInvalidOptionMaxRequestsPerBatch  = errors.New("MaxRequestsPerBatch must be greater than zero")
+	ErrInvalidOptionMaxBatchSize         = errors.New("MaxBatchSize must be greater than zero")
+	ErrInvalidOptionRequestTimeout       = errors.New("RequestTimeout must be greater than zero")
+	ErrInvalidOptionSessionTimeout       = errors.New("SessionTimeout must be greater than zero")
+	ErrInvalidOptionIdentity             = errors.New("Identity must be non-empty")
+	ErrInvalidOptionNamespace            = errors.New("Namespace cannot be empty")
+	ErrInvalidOptionTLS                  = errors.New("Tls cannot be empty")
+	ErrInvalidOptionAuthentication       = errors.New("Authentication cannot be empty")
+	ErrInvalidOptionCacheMemoryBudget    = errors.New("CacheMemoryBudget must be greater than zero")
+	ErrInvalidOptionShardStrategy        = errors.New("ShardStrategy cannot be empty")
+	ErrInvalidOptionMaxPendingBytes      = errors.New("MaxPendingBytes must be greater than zero")
+	ErrInvalidOptionMaxPendingRequests   = errors.New("MaxPendingRequests must be greater than zero")
+	ErrInvalidOptionRetryPolicy          = errors.New("RetryPolicy cannot be empty")
+	ErrInvalidOptionMaxReadBatchSize     = errors.New("MaxReadBatchSize must be greater than zero")
+	ErrInvalidOptionWriteStreamsPerShard = errors.New("WriteStreamsPerShard must be greater than zero")
 )
 
+// BackpressurePolicy controls what happens to a new request when the limits set with
+// [WithMaxPendingBytes] or [WithMaxPendingRequests] are reached.
+type BackpressurePolicy int
+
+const (
+	// BackpressureBlock waits for room among the pending requests, for up to the request
+	// timeout. The context set with [WithContext] can stop the wait earlier. This is the
+	// default policy.
+	BackpressureBlock BackpressurePolicy = iota
+
+	// BackpressureFailFast fails the request right away with [ErrBackpressure].
+	BackpressureFailFast
+)
+
+func (p BackpressurePolicy) String() string {
+	switch p {
+	case BackpressureBlock:
+		return "Block"
+	case BackpressureFailFast:
+		return "FailFast"
+	}
+
+	return "Unknown"
+}
+
 // clientOptions contains options for the Oxia client.
 type clientOptions struct {
-	serviceAddress         string
-	namespace              string
-	batchLinger            time.Duration
-	maxRequestsPerBatch    int
-	maxBatchSize           int
-	requestTimeout         time.Duration
-	meterProvider          metric.MeterProvider
-	sessionTimeout         time.Duration
-	identity               string
-	tls                    *tls.Config
-	authentication         auth.Authentication
-	sessionKeepAliveTicker time.Duration
+	serviceAddress          string
+	namespace               string
+	batchLinger             time.Duration
+	adaptiveBatchLinger     bool
+	maxRequestsPerBatch     int
+	maxBatchSize            int
+	requestTimeout          time.Duration
+	meterProvider           metric.MeterProvider
+	sessionTimeout          time.Duration
+	identity                string
+	tls                     *tls.Config
+	authentication          auth.Authentication
+	sessionKeepAliveTicker  time.Duration
+	cacheMemoryBudget       int64
+	sessionEventListener    func(SessionEvent)
+	reRegisterEphemerals    bool
+	shardStrategy           ShardStrategy
+	waitForShardAssignments bool
+	maxPendingBytes         int64
+	maxPendingRequests      int
+	backpressurePolicy      BackpressurePolicy
+	retryPolicy             RetryPolicy
+	maxReadBatchSize        int
+	streamReads             bool
+	writeStreamsPerShard    int
+	coalesceWrites          bool
 }
 
 func defaultIdentity() string {
@@ -85,15 +133,18 @@ type ClientOption interface {
 
 func newClientOptions(serviceAddress string, opts ...ClientOption) (clientOptions, error) {
 	options := clientOptions{
-		serviceAddress:      serviceAddress,
-		namespace:           constant.DefaultNamespace,
-		batchLinger:         DefaultBatchLinger,
-		maxRequestsPerBatch: DefaultMaxRequestsPerBatch,
-		maxBatchSize:        DefaultMaxBatchSize,
-		requestTimeout:      DefaultRequestTimeout,
-		meterProvider:       noop.NewMeterProvider(),
-		sessionTimeout:      DefaultSessionTimeout,
-		identity:            defaultIdentity(),
+		serviceAddress:       serviceAddress,
+		namespace:            constant.DefaultNamespace,
+		batchLinger:          DefaultBatchLinger,
+		maxRequestsPerBatch:  DefaultMaxRequestsPerBatch,
+		maxBatchSize:         DefaultMaxBatchSize,
+		maxReadBatchSize:     DefaultMaxReadBatchSize,
+		writeStreamsPerShard: DefaultWriteStreamsPerShard,
+		requestTimeout:       DefaultRequestTimeout,
+		meterProvider:        noop.NewMeterProvider(),
+		sessionTimeout:       DefaultSessionTimeout,
+		identity:             defaultIdentity(),
+		retryPolicy:          NewDefaultRetryPolicy(),
 	}
 	var errs error
 	var err error
@@ -137,6 +188,23 @@ func WithBatchLinger(batchLinger time.Duration) ClientOption {
 			return options, ErrInvalidOptionBatchLinger
 		}
 		options.batchLinger = batchLinger
+		options.adaptiveBatchLinger = false
+		return options, nil
+	})
+}
+
+// WithAdaptiveBatchLinger makes the batcher adapt the linger to the load, up to `maxBatchLinger`.
+// When there are no requests in flight, a request is sent right away. Under load, the requests that
+// arrive while a batch is in flight are sent together, and the batcher waits longer for more requests,
+// based on the number of queued requests and the recent execution times of the batches.
+// This option overrides [WithBatchLinger], and vice versa.
+func WithAdaptiveBatchLinger(maxBatchLinger time.Duration) ClientOption {
+	return clientOptionFunc(func(options clientOptions) (clientOptions, error) {
+		if maxBatchLinger < 0 {
+			return options, ErrInvalidOptionBatchLinger
+		}
+		options.batchLinger = maxBatchLinger
+		options.adaptiveBatchLinger = true
 		return options, nil
 	})
 }
@@ -220,6 +288,171 @@ func WithAuthentication(authentication auth.Authentication) ClientOption {
 	})
 }
 
+// WithCacheMemoryBudget makes all the [Cache] instances created from the client share
+// a single memory budget of `maxCost` bytes, instead of each of them having its own.
+// Caches created with the [CacheMaxCost] option are excluded from the shared budget.
+func WithCacheMemoryBudget(maxCost int64) ClientOption {
+	return clientOptionFunc(func(options clientOptions) (clientOptions, error) {
+		if maxCost <= 0 {
+			return options, ErrInvalidOptionCacheMemoryBudget
+		}
+		options.cacheMemoryBudget = maxCost
+		return options, nil
+	})
+}
+
+// WithShardStrategy overrides the way the keys are mapped to the shards.
+// By default, the client follows the shard key router announced by the servers.
+func WithShardStrategy(shardStrategy ShardStrategy) ClientOption {
+	return clientOptionFunc(func(options clientOptions) (clientOptions, error) {
+		if shardStrategy == nil {
+			return options, ErrInvalidOptionShardStrategy
+		}
+		options.shardStrategy = shardStrategy
+		return options, nil
+	})
+}
+
+// WithWaitForShardAssignments makes the operations on keys whose shard is temporarily
+// not available (eg: while a shard is being split) wait, up to the request timeout, for
+// the shard assignments to be updated. Otherwise, they fail immediately with
+// [ErrShardNotAvailable].
+func WithWaitForShardAssignments(wait bool) ClientOption {
+	return clientOptionFunc(func(options clientOptions) (clientOptions, error) {
+		options.waitForShardAssignments = wait
+		return options, nil
+	})
+}
+
+// WithMaxReadBatchSize limits the size of the responses of the read batches, so
+// that a few large values don't delay all the other gets of the batch. Since
+// the size of the values is not known in advance, it is estimated from the
+// previous responses of the shard. Default is [DefaultMaxReadBatchSize].
+func WithMaxReadBatchSize(maxReadBatchSize int) ClientOption {
+	return clientOptionFunc(func(options clientOptions) (clientOptions, error) {
+		if maxReadBatchSize <= 0 {
+			return options, ErrInvalidOptionMaxReadBatchSize
+		}
+		options.maxReadBatchSize = maxReadBatchSize
+		return options, nil
+	})
+}
+
+// WithStreamingReads completes each get as soon as its response is received,
+// instead of waiting for the responses of all the gets in the same batch.
+// Default is false.
+func WithStreamingReads(streamReads bool) ClientOption {
+	return clientOptionFunc(func(options clientOptions) (clientOptions, error) {
+		options.streamReads = streamReads
+		return options, nil
+	})
+}
+
+// WithWriteStreamsPerShard sets the number of parallel streams used to send
+// the write batches to each shard, which is also the number of write batches of
+// each shard that can be in flight at once. Each batch is sent on the stream
+// with the fewest pending batches, so that a slow batch doesn't hold back the
+// others. A batch that writes a key of a batch in flight, or that deletes a
+// range of keys, waits for the batches in flight to be completed, so that the
+// writes of each key are still applied in order.
+// When a stream fails, its pending batches that are idempotent are sent again
+// on a new stream. Default is [DefaultWriteStreamsPerShard].
+func WithWriteStreamsPerShard(writeStreamsPerShard int) ClientOption {
+	return clientOptionFunc(func(options clientOptions) (clientOptions, error) {
+		if writeStreamsPerShard <= 0 {
+			return options, ErrInvalidOptionWriteStreamsPerShard
+		}
+		options.writeStreamsPerShard = writeStreamsPerShard
+		return options, nil
+	})
+}
+
+// WithWriteCoalescing collapses the puts, and the deletes, of the same key that
+// are sent in the same batch into the last one. All of them complete with the
+// result of the last one. This saves work when the same keys are overwritten
+// often within the batch linger.
+// The puts with an expected version id, sequence keys, or that are ephemeral,
+// and the deletes with an expected version id, are never collapsed, nor are
+// the other writes of their keys. Default is false.
+func WithWriteCoalescing(coalesceWrites bool) ClientOption {
+	return clientOptionFunc(func(options clientOptions) (clientOptions, error) {
+		options.coalesceWrites = coalesceWrites
+		return options, nil
+	})
+}
+
+// WithRetryPolicy overrides the way the failed operations are retried. This
+// applies to the reads and writes, as well as to the streams of sessions,
+// notifications, sequence updates and shard assignments.
+// Default is [NewDefaultRetryPolicy].
+func WithRetryPolicy(retryPolicy RetryPolicy) ClientOption {
+	return clientOptionFunc(func(options clientOptions) (clientOptions, error) {
+		if retryPolicy == nil {
+			return options, ErrInvalidOptionRetryPolicy
+		}
+		options.retryPolicy = retryPolicy
+		return options, nil
+	})
+}
+
+// WithMaxPendingBytes limits the total size of the keys and values of the requests that were
+// submitted to the client and are not completed yet. The behavior when the limit is reached
+// is controlled by [WithBackpressurePolicy]. By default, there's no limit.
+func WithMaxPendingBytes(maxPendingBytes int64) ClientOption {
+	return clientOptionFunc(func(options clientOptions) (clientOptions, error) {
+		if maxPendingBytes <= 0 {
+			return options, ErrInvalidOptionMaxPendingBytes
+		}
+		options.maxPendingBytes = maxPendingBytes
+		return options, nil
+	})
+}
+
+// WithMaxPendingRequests limits the number of requests that were submitted to the client and
+// are not completed yet. The behavior when the limit is reached is controlled by
+// [WithBackpressurePolicy]. By default, there's no limit.
+func WithMaxPendingRequests(maxPendingRequests int) ClientOption {
+	return clientOptionFunc(func(options clientOptions) (clientOptions, error) {
+		if maxPendingRequests <= 0 {
+			return options, ErrInvalidOptionMaxPendingRequests
+		}
+		options.maxPendingRequests = maxPendingRequests
+		return options, nil
+	})
+}
+
+// WithBackpressurePolicy selects the behavior when the limits on the pending requests are
+// reached. Default is [BackpressureBlock].
+func WithBackpressurePolicy(policy BackpressurePolicy) ClientOption {
+	return clientOptionFunc(func(options clientOptions) (clientOptions, error) {
+		options.backpressurePolicy = policy
+		return options, nil
+	})
+}
+
+// WithSessionEventListener registers a function that gets invoked on every change in the
+// lifecycle of the sessions, eg: when a session expires and the ephemeral records that
+// were created with it are deleted.
+// The listener is invoked from the client internal go-routines and must not block.
+func WithSessionEventListener(listener func(event SessionEvent)) ClientOption {
+	return clientOptionFunc(func(options clientOptions) (clientOptions, error) {
+		options.sessionEventListener = listener
+		return options, nil
+	})
+}
+
+// WithReRegisterEphemerals makes the client remember the ephemeral records it has
+// created and re-create them, with a new session, when their session expires.
+// The records are only re-created if they don't exist, so that the changes made
+// by other clients in the meantime are not overwritten.
+// Ephemeral records created with sequence keys are not re-created.
+func WithReRegisterEphemerals(reRegister bool) ClientOption {
+	return clientOptionFunc(func(options clientOptions) (clientOptions, error) {
+		options.reRegisterEphemerals = reRegister
+		return options, nil
+	})
+}
+
 // WithSessionKeepAliveTicker is an internal API used to control the duration
 // of the session keep-alive ticker. This is for experimental use only.
 func withSessionKeepAliveTicker(ticker time.Duration) ClientOption {
@@ -0,0 +1,174 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultNotificationsBufferSize = 100
+	DefaultNotificationsSpillBytes = 64 * 1024 * 1024
+)
+
+// OverflowPolicy controls what happens when the consumer of a [Notifications]
+// subscription is not keeping up and the notifications buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock stops receiving notifications from the shards until the
+	// consumer frees up space in the buffer. This is the default policy.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest discards the oldest buffered notifications to make room
+	// for the new ones. A [NotificationsDropped] event is published in place of
+	// the discarded notifications.
+	OverflowDropOldest
+
+	// OverflowSpillToDisk writes the notifications that do not fit in the buffer
+	// into a bounded temporary file. Once the file is full, the policy falls back
+	// to blocking.
+	OverflowSpillToDisk
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "Block"
+	case OverflowDropOldest:
+		return "DropOldest"
+	case OverflowSpillToDisk:
+		return "SpillToDisk"
+	}
+
+	return "Unknown"
+}
+
+type notificationsOptions struct {
+	bufferSize     int
+	overflowPolicy OverflowPolicy
+	spillDir       string
+	maxSpillBytes  int64
+	topologyEvents bool
+	restartEvents  bool
+}
+
+// NotificationsOption represents an option for the [SyncClient.GetNotifications] operation.
+type NotificationsOption interface {
+	applyNotifications(opts *notificationsOptions)
+}
+
+func newNotificationsOptions(opts []NotificationsOption) (*notificationsOptions, error) {
+	notificationsOpts := &notificationsOptions{
+		bufferSize:     DefaultNotificationsBufferSize,
+		overflowPolicy: OverflowBlock,
+		spillDir:       os.TempDir(),
+		maxSpillBytes:  DefaultNotificationsSpillBytes,
+	}
+	for _, opt := range opts {
+		opt.applyNotifications(notificationsOpts)
+	}
+
+	if notificationsOpts.bufferSize <= 0 {
+		return nil, errors.Wrap(ErrInvalidOptions, "notifications buffer size must be greater than zero")
+	}
+
+	if notificationsOpts.overflowPolicy == OverflowDropOldest && notificationsOpts.bufferSize < 2 {
+		return nil, errors.Wrap(ErrInvalidOptions, "drop-oldest overflow policy requires a buffer size of at least 2")
+	}
+
+	if notificationsOpts.overflowPolicy == OverflowSpillToDisk && notificationsOpts.maxSpillBytes <= 0 {
+		return nil, errors.Wrap(ErrInvalidOptions, "notifications spill size must be greater than zero")
+	}
+
+	return notificationsOpts, nil
+}
+
+type notificationsBufferSize struct {
+	bufferSize int
+}
+
+func (o *notificationsBufferSize) applyNotifications(opts *notificationsOptions) {
+	opts.bufferSize = o.bufferSize
+}
+
+// NotificationsBufferSize sets how many notifications can be buffered in memory
+// before the [OverflowPolicy] kicks in. Default is [DefaultNotificationsBufferSize].
+func NotificationsBufferSize(bufferSize int) NotificationsOption {
+	return &notificationsBufferSize{bufferSize}
+}
+
+type notificationsOverflowPolicy struct {
+	policy OverflowPolicy
+}
+
+func (o *notificationsOverflowPolicy) applyNotifications(opts *notificationsOptions) {
+	opts.overflowPolicy = o.policy
+}
+
+// NotificationsOverflowPolicy selects the behavior when the notifications buffer
+// is full. Default is [OverflowBlock].
+func NotificationsOverflowPolicy(policy OverflowPolicy) NotificationsOption {
+	return &notificationsOverflowPolicy{policy}
+}
+
+type notificationsSpill struct {
+	dir      string
+	maxBytes int64
+}
+
+func (o *notificationsSpill) applyNotifications(opts *notificationsOptions) {
+	opts.overflowPolicy = OverflowSpillToDisk
+	opts.spillDir = o.dir
+	opts.maxSpillBytes = o.maxBytes
+}
+
+// NotificationsSpillToDisk enables the [OverflowSpillToDisk] policy, storing up to
+// `maxBytes` of overflowing notifications in a temporary file within `dir`.
+// An empty `dir` uses the default directory for temporary files.
+func NotificationsSpillToDisk(dir string, maxBytes int64) NotificationsOption {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	return &notificationsSpill{dir, maxBytes}
+}
+
+type notificationsTopologyEvents struct{}
+
+func (notificationsTopologyEvents) applyNotifications(opts *notificationsOptions) {
+	opts.topologyEvents = true
+}
+
+// NotificationsTopologyEvents enables the [ShardTopologyChanged] events, which are
+// published when shards are added or removed. They are not published by default,
+// since they don't refer to any key.
+func NotificationsTopologyEvents() NotificationsOption {
+	return notificationsTopologyEvents{}
+}
+
+type notificationsStreamRestartEvents struct{}
+
+func (notificationsStreamRestartEvents) applyNotifications(opts *notificationsOptions) {
+	opts.restartEvents = true
+}
+
+// NotificationsStreamRestartEvents enables the [NotificationsStreamRestarted] events,
+// which are published when the notifications stream of a shard is re-established.
+// They are not published by default, since they don't refer to any key.
+func NotificationsStreamRestartEvents() NotificationsOption {
+	return notificationsStreamRestartEvents{}
+}
@@ -20,6 +20,7 @@ type putOptions struct {
 	baseOptions
 	expectedVersion    *int64
 	ephemeral          bool
+	lease              Lease
 	sequenceKeysDeltas []uint64
 	secondaryIndexes   []*secondaryIdxOption
 }
@@ -115,3 +116,18 @@ func (s *secondaryIdxOption) applyPut(opts *putOptions) {
 func SecondaryIndex(indexName string, secondaryKey string) PutOption {
 	return &secondaryIdxOption{indexName, secondaryKey}
 }
+
+type withLease struct {
+	lease Lease
+}
+
+func (o *withLease) applyPut(opts *putOptions) {
+	opts.ephemeral = true
+	opts.lease = o.lease
+}
+
+// WithLease creates an ephemeral record whose lifecycle is tied to the [Lease],
+// instead of the client session. See [AsyncClient.GrantLease].
+func WithLease(lease Lease) PutOption {
+	return &withLease{lease}
+}
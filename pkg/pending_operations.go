@@ -0,0 +1,99 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// Keeps track of the operations that were submitted to the client and are not
+// completed yet, including the ones that have not reached a batcher, because
+// they are still waiting for their shard, their session or for room among the
+// pending requests.
+//
+// The operations are counted in groups: a flush closes the current group and
+// waits for it, so that the operations submitted after the flush don't delay it.
+type pendingOperations struct {
+	sync.Mutex
+	current *operationsGroup
+	// The closed groups that still have operations to complete
+	flushing []*operationsGroup
+}
+
+type operationsGroup struct {
+	pending int
+	closed  bool
+	done    chan struct{}
+}
+
+func newOperationsGroup() *operationsGroup {
+	return &operationsGroup{done: make(chan struct{})}
+}
+
+func newPendingOperations() *pendingOperations {
+	return &pendingOperations{current: newOperationsGroup()}
+}
+
+// start records a new operation. The returned function must be called once
+// its result is delivered.
+func (p *pendingOperations) start() (done func()) {
+	p.Lock()
+	defer p.Unlock()
+
+	g := p.current
+	g.pending++
+	return sync.OnceFunc(func() {
+		p.Lock()
+		defer p.Unlock()
+
+		g.pending--
+		if g.pending == 0 && g.closed {
+			close(g.done)
+			p.flushing = slices.DeleteFunc(p.flushing, func(f *operationsGroup) bool { return f == g })
+		}
+	})
+}
+
+// flush closes the current group and returns a function that waits for all
+// the operations started so far to complete, or for the context to be done.
+func (p *pendingOperations) flush() (wait func(ctx context.Context) error) {
+	p.Lock()
+	defer p.Unlock()
+
+	g := p.current
+	g.closed = true
+	p.current = newOperationsGroup()
+	if g.pending == 0 {
+		close(g.done)
+	} else {
+		p.flushing = append(p.flushing, g)
+	}
+
+	// The groups closed by concurrent flushes hold operations that were
+	// started earlier, so they must be waited for as well
+	groups := append([]*operationsGroup{g}, p.flushing...)
+	return func(ctx context.Context) error {
+		for _, group := range groups {
+			select {
+			case <-group.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	}
+}
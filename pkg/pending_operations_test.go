@@ -0,0 +1,106 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oxia-db/oxia-client-golang/internal/batch"
+	"github.com/oxia-db/oxia-client-golang/internal/model"
+	commonbatch "github.com/oxia-db/oxia-client-golang/pkg/batch"
+	"github.com/oxia-db/oxia/proto"
+)
+
+func TestPendingOperations(t *testing.T) {
+	p := newPendingOperations()
+	assert.NoError(t, p.flush()(context.Background()))
+
+	first := p.start()
+	wait := p.flush()
+	// Not waited for by the flush, since it was started later
+	second := p.start()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, wait(ctx), context.DeadlineExceeded)
+
+	// A later flush also waits for the operations of the earlier one
+	waitAll := p.flush()
+	second()
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, waitAll(ctx), context.DeadlineExceeded)
+
+	first()
+	first()
+	assert.NoError(t, wait(context.Background()))
+	assert.NoError(t, waitAll(context.Background()))
+	assert.Empty(t, p.flushing)
+}
+
+type channelBatcher struct {
+	calls chan any
+}
+
+func (b *channelBatcher) Add(call any) {
+	b.calls <- call
+}
+
+func (*channelBatcher) Flush(context.Context) error {
+	return nil
+}
+
+func (*channelBatcher) Run() {}
+
+func (*channelBatcher) Close() error {
+	return nil
+}
+
+func TestAsyncClientImpl_FlushWaitsForShard(t *testing.T) {
+	batcher := &channelBatcher{calls: make(chan any, 1)}
+	newBatcher := func(context.Context, *int64) commonbatch.Batcher { return batcher }
+	shardManager := &waitingShardManager{assigned: make(chan struct{})}
+	c := &clientImpl{
+		shardManager:      shardManager,
+		options:           clientOptions{waitForShardAssignments: true},
+		writeBatchManager: batch.NewManager(context.Background(), newBatcher, nil),
+		readBatchManager:  batch.NewManager(context.Background(), newBatcher, nil),
+		operations:        newPendingOperations(),
+		ctx:               context.Background(),
+	}
+
+	// The put is still waiting for its shard, so it's not in any batcher
+	ch := c.Put("/a", []byte("v"))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, c.Flush(ctx), context.DeadlineExceeded)
+
+	flushed := make(chan error, 1)
+	go func() {
+		flushed <- c.Flush(context.Background())
+	}()
+
+	close(shardManager.assigned)
+	call := (<-batcher.calls).(model.PutCall)
+	assert.Empty(t, flushed)
+
+	call.Callback(&proto.PutResponse{Status: proto.Status_OK, Version: &proto.Version{}}, nil)
+	assert.NoError(t, (<-ch).Err)
+	assert.NoError(t, <-flushed)
+}
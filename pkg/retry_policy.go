@@ -0,0 +1,52 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"github.com/oxia-db/oxia-client-golang/internal"
+)
+
+// RetryPolicy decides whether and when the failed operations are retried.
+// See [WithRetryPolicy].
+type RetryPolicy = internal.RetryPolicy
+
+// RetryOperation describes an operation that failed and may be retried.
+type RetryOperation = internal.RetryOperation
+
+// RetryOperationType identifies the kind of operation that is retried.
+type RetryOperationType = internal.RetryOperationType
+
+const (
+	RetryOperationWrite            = internal.RetryOperationWrite
+	RetryOperationRead             = internal.RetryOperationRead
+	RetryOperationSession          = internal.RetryOperationSession
+	RetryOperationNotifications    = internal.RetryOperationNotifications
+	RetryOperationSequenceUpdates  = internal.RetryOperationSequenceUpdates
+	RetryOperationShardAssignments = internal.RetryOperationShardAssignments
+)
+
+// RetryBudget limits the retries of an operation. A zero value means no limit.
+type RetryBudget = internal.RetryBudget
+
+// DefaultRetryPolicy retries with an exponential backoff. Its fields can be
+// changed to tune the retries, after it's created with [NewDefaultRetryPolicy].
+type DefaultRetryPolicy = internal.DefaultRetryPolicy
+
+// NewDefaultRetryPolicy creates the policy used when none is set on the client.
+// The reads and writes are retried until the request timeout, when the shard
+// leader is unavailable or has changed.
+func NewDefaultRetryPolicy() *DefaultRetryPolicy {
+	return internal.NewDefaultRetryPolicy()
+}
@@ -24,18 +24,20 @@ import (
 
 	"github.com/oxia-db/oxia/common/process"
 	"github.com/oxia-db/oxia/common/rpc"
-	time2 "github.com/oxia-db/oxia/common/time"
 
-	"github.com/oxia-db/oxia/oxia/internal"
+	"github.com/oxia-db/oxia-client-golang/internal"
 	"github.com/oxia-db/oxia/proto"
 )
 
+var sequenceUpdatesRetryOperation = internal.RetryOperation{Type: internal.RetryOperationSequenceUpdates, Idempotent: true}
+
 type sequenceUpdates struct {
 	prefixKey    string
 	partitionKey string
 	ch           chan string
 	shardManager internal.ShardManager
 	clientPool   rpc.ClientPool
+	retrier      *internal.Retrier
 
 	ctx     context.Context
 	backoff backoff.BackOff
@@ -43,15 +45,16 @@ type sequenceUpdates struct {
 }
 
 func newSequenceUpdates(ctx context.Context, prefixKey string, partitionKey string,
-	clientPool rpc.ClientPool, shardManager internal.ShardManager) <-chan string {
+	clientPool rpc.ClientPool, shardManager internal.ShardManager, retrier *internal.Retrier) <-chan string {
 	su := &sequenceUpdates{
 		prefixKey:    prefixKey,
 		partitionKey: partitionKey,
 		ch:           make(chan string),
 		shardManager: shardManager,
 		clientPool:   clientPool,
+		retrier:      retrier,
 		ctx:          ctx,
-		backoff:      time2.NewBackOffWithInitialInterval(ctx, 1*time.Second),
+		backoff:      retrier.NewBackOff(ctx, sequenceUpdatesRetryOperation),
 		log: slog.With(
 			slog.String("component", "oxia-get-sequence-updates"),
 			slog.String("key", "key"),
@@ -71,8 +74,8 @@ func newSequenceUpdates(ctx context.Context, prefixKey string, partitionKey stri
 }
 
 func (su *sequenceUpdates) getSequenceUpdatesWithRetries() { //nolint:revive
-	_ = backoff.RetryNotify(su.getSequenceUpdates,
-		su.backoff, func(err error, duration time.Duration) {
+	_ = su.retrier.Retry(sequenceUpdatesRetryOperation, su.backoff, su.getSequenceUpdates,
+		func(err error, duration time.Duration) {
 			if !errors.Is(err, context.Canceled) {
 				su.log.Error(
 					"Error while getting sequence updates",
@@ -87,8 +90,14 @@ func (su *sequenceUpdates) getSequenceUpdatesWithRetries() { //nolint:revive
 }
 
 func (su *sequenceUpdates) getSequenceUpdates() error {
-	shard := su.shardManager.Get(su.partitionKey)
-	leader := su.shardManager.Leader(shard)
+	shard, err := su.shardManager.Get(su.partitionKey)
+	if err != nil {
+		return err
+	}
+	leader, err := su.shardManager.Leader(shard)
+	if err != nil {
+		return err
+	}
 
 	client, err := su.clientPool.GetClientRpc(leader)
 	if err != nil {
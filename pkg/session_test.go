@@ -62,3 +62,155 @@ loop:
 		return assert.NoError(t, err) && assert.Empty(t, keys)
 	}, 10*time.Second, 1*time.Second)
 }
+
+func TestSessionEventsAndReRegisterEphemerals(t *testing.T) {
+	config := node.NewTestConfig(t.TempDir())
+	standaloneServer, err := node.NewStandalone(config)
+	assert.NoError(t, err)
+	defer standaloneServer.Close()
+
+	events := make(chan SessionEvent, 100)
+	client, err := NewSyncClient(standaloneServer.ServiceAddr(),
+		// force the server to expire the session
+		withSessionKeepAliveTicker(10*time.Second),
+		WithSessionTimeout(3*time.Second),
+		WithReRegisterEphemerals(true),
+		WithSessionEventListener(func(event SessionEvent) {
+			events <- event
+		}))
+	assert.NoError(t, err)
+
+	ctx := context.Background()
+	_, v1, err := client.Put(ctx, "/re-register/a", []byte("a"), Ephemeral())
+	assert.NoError(t, err)
+
+	// Deleted records are not re-created
+	_, _, err = client.Put(ctx, "/re-register/b", []byte("b"), Ephemeral())
+	assert.NoError(t, err)
+	assert.NoError(t, client.Delete(ctx, "/re-register/b"))
+
+	event := <-events
+	assert.Equal(t, SessionCreated, event.Type)
+	sessionId := event.SessionId
+
+	event = <-events
+	assert.Equal(t, SessionExpired, event.Type)
+	assert.Equal(t, sessionId, event.SessionId)
+
+	event = <-events
+	assert.Equal(t, SessionCreated, event.Type)
+	assert.NotEqual(t, sessionId, event.SessionId)
+
+	assert.Eventually(t, func() bool {
+		_, value, version, err := client.Get(ctx, "/re-register/a")
+		return err == nil && string(value) == "a" && version.VersionId != v1.VersionId &&
+			version.SessionId == event.SessionId
+	}, 30*time.Second, 100*time.Millisecond)
+
+	_, _, _, err = client.Get(ctx, "/re-register/b")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+
+	assert.NoError(t, client.Close())
+}
+
+func TestSessionKeepAliveGivesUp(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+
+	policy := NewDefaultRetryPolicy()
+	policy.Budgets[RetryOperationSession] = RetryBudget{MaxRetries: 1}
+	events := make(chan SessionEvent, 100)
+	client, err := NewAsyncClient(standaloneServer.ServiceAddr(),
+		withSessionKeepAliveTicker(2*time.Second),
+		WithRetryPolicy(policy),
+		WithSessionEventListener(func(event SessionEvent) {
+			events <- event
+		}))
+	assert.NoError(t, err)
+	c := client.(*clientImpl)
+
+	assert.NoError(t, (<-client.Put("/a", []byte("a"), Ephemeral())).Err)
+	event := <-events
+	assert.Equal(t, SessionCreated, event.Type)
+	sessionId := event.SessionId
+
+	// The heartbeats fail until the budget is exhausted
+	assert.NoError(t, standaloneServer.Close())
+	select {
+	case event = <-events:
+	case <-time.After(30 * time.Second):
+		assert.Fail(t, "the session was not given up")
+	}
+	assert.Equal(t, SessionExpired, event.Type)
+	assert.Equal(t, sessionId, event.SessionId)
+	assert.Error(t, event.Err)
+
+	// The next operations start a new session
+	c.sessions.Lock()
+	assert.Empty(t, c.sessions.sessionsByShard)
+	c.sessions.Unlock()
+
+	_ = client.Close()
+}
+
+func TestEphemeralRegistry(t *testing.T) {
+	r := newEphemeralRegistry()
+	opts, err := newPutOptions([]PutOption{Ephemeral(), PartitionKey("x")})
+	assert.NoError(t, err)
+
+	r.add(1, "/a", []byte("a"), opts)
+	r.add(1, "/b", []byte("b"), opts)
+	r.add(1, "/c/d", []byte("c"), opts)
+	r.add(2, "/e", []byte("e"), opts)
+
+	seqOpts, err := newPutOptions([]PutOption{Ephemeral(), PartitionKey("x"), SequenceKeysDeltas(1)})
+	assert.NoError(t, err)
+	r.add(1, "/seq", []byte("s"), seqOpts)
+
+	r.remove("/b")
+	r.removeRange("/c/", "/c//")
+
+	records := r.take(1)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "/a", records[0].key)
+	assert.Len(t, records[0].options, 3)
+
+	assert.Empty(t, r.take(1))
+	assert.Len(t, r.take(2), 1)
+}
+
+func TestEphemeralsKeptOnFailedDelete(t *testing.T) {
+	standaloneServer, err := node.NewStandalone(node.NewTestConfig(t.TempDir()))
+	assert.NoError(t, err)
+	defer standaloneServer.Close()
+
+	client, err := NewAsyncClient(standaloneServer.ServiceAddr(), WithReRegisterEphemerals(true))
+	assert.NoError(t, err)
+	c := client.(*clientImpl)
+
+	assert.NoError(t, (<-client.Put("/ephemeral/a", []byte("a"), Ephemeral())).Err)
+	isTracked := func() bool {
+		c.ephemerals.Lock()
+		defer c.ephemerals.Unlock()
+		_, found := c.ephemerals.records["/ephemeral/a"]
+		return found
+	}
+	assert.True(t, isTracked())
+
+	// The record still exists after a failed delete
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, <-client.Delete("/ephemeral/a", WithContext(ctx)), context.Canceled)
+	assert.True(t, isTracked())
+	assert.ErrorIs(t, <-client.DeleteRange("/ephemeral/", "/ephemeral//", WithContext(ctx)), context.Canceled)
+	assert.True(t, isTracked())
+
+	assert.NoError(t, <-client.Delete("/ephemeral/a"))
+	assert.False(t, isTracked())
+
+	assert.NoError(t, (<-client.Put("/ephemeral/a", []byte("a"), Ephemeral())).Err)
+	assert.NoError(t, <-client.DeleteRange("/ephemeral/", "/ephemeral//"))
+	assert.False(t, isTracked())
+
+	assert.NoError(t, client.Close())
+}
@@ -29,18 +29,20 @@ import (
 	"github.com/oxia-db/oxia/common/constant"
 	"github.com/oxia-db/oxia/common/process"
 	"github.com/oxia-db/oxia/common/rpc"
-	time2 "github.com/oxia-db/oxia/common/time"
 
-	"github.com/oxia-db/oxia/oxia/internal"
+	"github.com/oxia-db/oxia-client-golang/internal"
 	"github.com/oxia-db/oxia/proto"
 )
 
-func newSessions(ctx context.Context, shardManager internal.ShardManager, pool rpc.ClientPool, options clientOptions) *sessions {
+func newSessions(ctx context.Context, shardManager internal.ShardManager, pool rpc.ClientPool,
+	retrier *internal.Retrier, options clientOptions, listener func(SessionEvent)) *sessions {
 	s := &sessions{
 		clientIdentity:  options.identity,
+		listener:        listener,
 		ctx:             ctx,
 		shardManager:    shardManager,
 		pool:            pool,
+		retrier:         retrier,
 		sessionsByShard: map[int64]*clientSession{},
 		clientOpts:      options,
 		log: slog.With(
@@ -57,9 +59,31 @@ type sessions struct {
 	ctx             context.Context
 	shardManager    internal.ShardManager
 	pool            rpc.ClientPool
+	retrier         *internal.Retrier
 	sessionsByShard map[int64]*clientSession
 	log             *slog.Logger
 	clientOpts      clientOptions
+	listener        func(SessionEvent)
+
+	// When set, the sessions are only kept alive by explicit calls to
+	// keepAliveOnce. This is used for the leases.
+	manualKeepAlive bool
+}
+
+// Must not be called while holding the sessions or the session locks, since
+// the listener might start new sessions.
+func (s *sessions) notify(event SessionEvent) {
+	s.log.Debug(
+		"Session event",
+		slog.Any("type", event.Type),
+		slog.Int64("shard", event.Shard),
+		slog.Int64("session-id", event.SessionId),
+		slog.Any("error", event.Err),
+	)
+
+	if s.listener != nil {
+		s.listener(event)
+	}
 }
 
 func (s *sessions) executeWithSessionId(shardId int64, callback func(int64, error)) {
@@ -110,6 +134,7 @@ func (s *sessions) Close() error {
 type clientSession struct {
 	sync.Mutex
 	started   chan error
+	created   bool
 	shardId   int64
 	sessionId int64
 	log       *slog.Logger
@@ -141,9 +166,10 @@ func (cs *clientSession) executeWithId(callback func(int64, error)) {
 }
 
 func (cs *clientSession) createSessionWithRetries() {
-	backOff := time2.NewBackOff(cs.ctx)
-	err := backoff.RetryNotify(cs.createSession,
-		backOff, func(err error, duration time.Duration) {
+	operation := internal.RetryOperation{Type: internal.RetryOperationSession, Idempotent: true}
+	backOff := cs.sessions.retrier.NewBackOff(cs.ctx, operation)
+	err := cs.sessions.retrier.Retry(operation, backOff, cs.createSession,
+		func(err error, duration time.Duration) {
 			if !errors.Is(err, context.Canceled) {
 				cs.log.Error(
 					"Error while creating session",
@@ -177,25 +203,34 @@ func (cs *clientSession) createSession() error {
 	}
 	sessionId := createSessionResponse.SessionId
 	cs.Lock()
-	defer cs.Unlock()
 	cs.sessionId = sessionId
+	cs.created = true
 	cs.log = cs.log.With(
 		slog.Int64("session-id", sessionId),
 		slog.String("client-identity", cs.sessions.clientIdentity),
 	)
 	close(cs.started)
 	cs.log.Debug("Successfully created session")
+	cs.Unlock()
+
+	cs.sessions.notify(SessionEvent{Type: SessionCreated, Shard: cs.shardId, SessionId: sessionId})
+
+	if cs.sessions.manualKeepAlive {
+		return nil
+	}
 
 	go process.DoWithLabels(
 		cs.ctx,
 		map[string]string{
 			"oxia":    "session-keep-alive",
 			"shard":   fmt.Sprintf("%d", cs.shardId),
-			"session": fmt.Sprintf("%x016", cs.sessionId),
+			"session": fmt.Sprintf("%x016", sessionId),
 		},
 		func() {
-			backOff := time2.NewBackOff(cs.sessions.ctx)
-			err := backoff.RetryNotify(func() error {
+			operation := internal.RetryOperation{Type: internal.RetryOperationSession, Idempotent: true}
+			backOff := cs.sessions.retrier.NewBackOff(cs.sessions.ctx, operation)
+			expired := false
+			err := cs.sessions.retrier.Retry(operation, backOff, func() error {
 				err := cs.keepAlive()
 				if status.Code(err) == constant.CodeSessionNotFound {
 					cs.log.Error(
@@ -203,11 +238,8 @@ func (cs *clientSession) createSession() error {
 						slog.Any("error", err),
 					)
 
-					cs.sessions.Lock()
-					defer cs.sessions.Unlock()
-					cs.Lock()
-					defer cs.Unlock()
-					delete(cs.sessions.sessionsByShard, cs.shardId)
+					cs.remove()
+					expired = true
 					return backoff.Permanent(err)
 				}
 				return err
@@ -219,11 +251,20 @@ func (cs *clientSession) createSession() error {
 				)
 			})
 
-			if err != nil && !errors.Is(err, context.Canceled) {
+			switch {
+			case expired:
+				cs.sessions.notify(SessionEvent{Type: SessionExpired, Shard: cs.shardId, SessionId: sessionId, Err: err})
+			case err != nil && !errors.Is(err, context.Canceled) && cs.ctx.Err() == nil:
 				cs.log.Error(
-					"Failed to keep alive session",
+					"Failed to keep alive session, giving up on it",
 					slog.Any("error", err),
 				)
+
+				// Without the heartbeats, the session is going to expire, so
+				// the new operations need a new session
+				cs.remove()
+				cs.cancel()
+				cs.sessions.notify(SessionEvent{Type: SessionExpired, Shard: cs.shardId, SessionId: sessionId, Err: err})
 			}
 		},
 	)
@@ -231,14 +272,40 @@ func (cs *clientSession) createSession() error {
 	return nil
 }
 
+// Removes the session from the ones used by the operations, if it's still
+// the session of its shard.
+func (cs *clientSession) remove() {
+	cs.sessions.Lock()
+	defer cs.sessions.Unlock()
+	if cs.sessions.sessionsByShard[cs.shardId] == cs {
+		delete(cs.sessions.sessionsByShard, cs.shardId)
+	}
+}
+
 func (cs *clientSession) getRpc() (proto.OxiaClientClient, error) {
-	leader := cs.sessions.shardManager.Leader(cs.shardId)
+	leader, err := cs.sessions.shardManager.Leader(cs.shardId)
+	if err != nil {
+		return nil, err
+	}
 	return cs.sessions.pool.GetClientRpc(leader)
 }
 
+func (cs *clientSession) id() int64 {
+	cs.Lock()
+	defer cs.Unlock()
+	return cs.sessionId
+}
+
 func (cs *clientSession) Close() error {
 	cs.cancel()
 
+	sessionId := cs.id()
+	err := cs.closeSession(sessionId)
+	cs.sessions.notify(SessionEvent{Type: SessionClosed, Shard: cs.shardId, SessionId: sessionId, Err: err})
+	return err
+}
+
+func (cs *clientSession) closeSession(sessionId int64) error {
 	client, err := cs.getRpc()
 	if err != nil {
 		return err
@@ -248,13 +315,35 @@ func (cs *clientSession) Close() error {
 
 	if _, err = client.CloseSession(ctx, &proto.CloseSessionRequest{
 		Shard:     cs.shardId,
-		SessionId: cs.sessionId,
+		SessionId: sessionId,
 	}); err != nil {
 		return err
 	}
 	return nil
 }
 
+// Sends a single heartbeat for the session, if it was already created.
+func (cs *clientSession) keepAliveOnce(ctx context.Context) error {
+	cs.Lock()
+	created := cs.created
+	sessionId := cs.sessionId
+	cs.Unlock()
+
+	if !created {
+		return nil
+	}
+
+	client, err := cs.getRpc()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cs.sessions.clientOpts.requestTimeout)
+	defer cancel()
+	_, err = client.KeepAlive(ctx, &proto.SessionHeartbeat{Shard: cs.shardId, SessionId: sessionId})
+	return err
+}
+
 func (cs *clientSession) keepAlive() error {
 	cs.sessions.Lock()
 	cs.Lock()
@@ -0,0 +1,39 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"github.com/oxia-db/oxia-client-golang/internal"
+)
+
+// ShardStrategy decides which shard a key belongs to. A custom strategy can be
+// set with [WithShardStrategy].
+type ShardStrategy = internal.ShardStrategy
+
+// Shard describes a shard, as seen by a [ShardStrategy] and in the [Topology].
+type Shard = internal.Shard
+
+// HashRange is the range of key hashes owned by a [Shard].
+type HashRange = internal.HashRange
+
+var (
+	// ErrUnknownShardKeyRouter The servers announced a shard key router that
+	// is not supported by the client.
+	ErrUnknownShardKeyRouter = internal.ErrUnknownShardKeyRouter
+
+	// ErrUnknownShardBoundaries The servers announced a shard with boundaries
+	// that are not supported by the client.
+	ErrUnknownShardBoundaries = internal.ErrUnknownShardBoundaries
+)
@@ -17,7 +17,9 @@ package oxia
 import (
 	"context"
 	"sync"
+	"time"
 
+	"go.opentelemetry.io/otel/metric/noop"
 	"go.uber.org/multierr"
 )
 
@@ -26,6 +28,9 @@ type syncClientImpl struct {
 
 	asyncClient  AsyncClient
 	cacheManager *cacheManager
+
+	// Invoked when the client is closed, if set
+	onClose func()
 }
 
 // NewSyncClient creates a new Oxia client with the sync interface
@@ -33,12 +38,18 @@ type syncClientImpl struct {
 // ServiceAddress is the target host:port of any Oxia server to bootstrap the client. It is used for establishing the
 // shard assignments. Ideally this should be a load-balanced endpoint.
 //
+// Multiple bootstrap targets can be passed as a comma-separated list. Besides host:port addresses, the targets can be
+// `dns:///host:port`, resolved to all the addresses of the host, or `srv:///name`, resolved through DNS SRV records.
+// If the current endpoint fails, the client fails over to the next one.
+//
+// By default, the sync client batches the concurrent requests with an adaptive linger. See [WithAdaptiveBatchLinger].
+//
 // A list of ClientOption arguments can be passed to configure the Oxia client.
 // Example:
 //
 //	client, err := oxia.NewSyncClient("my-oxia-service:6648", oxia.WithRequestTimeout(30*time.Second))
 func NewSyncClient(serviceAddress string, opts ...ClientOption) (SyncClient, error) {
-	options := append([]ClientOption{WithBatchLinger(0)}, opts...)
+	options := append([]ClientOption{WithAdaptiveBatchLinger(DefaultBatchLinger)}, opts...)
 
 	asyncClient, err := NewAsyncClient(serviceAddress, options...)
 	if err != nil {
@@ -54,6 +65,17 @@ func newSyncClient(asyncClient AsyncClient) SyncClient {
 	}
 }
 
+// Returns a context that is canceled when the client is closed, for the
+// components that are built on top of the client.
+func clientContext(client SyncClient) context.Context {
+	if c, ok := client.(*syncClientImpl); ok {
+		if ac, ok := c.asyncClient.(*clientImpl); ok {
+			return ac.ctx
+		}
+	}
+	return context.Background()
+}
+
 func (c *syncClientImpl) getCacheManager() (*cacheManager, error) {
 	c.Lock()
 	defer c.Unlock()
@@ -62,23 +84,44 @@ func (c *syncClientImpl) getCacheManager() (*cacheManager, error) {
 		return c.cacheManager, nil
 	}
 
+	options := clientOptions{meterProvider: noop.NewMeterProvider(), requestTimeout: DefaultRequestTimeout}
+	if ac, ok := c.asyncClient.(*clientImpl); ok {
+		options = ac.options
+	}
+
 	var err error
-	c.cacheManager, err = newCacheManager(c)
+	c.cacheManager, err = newCacheManager(c, options)
 	return c.cacheManager, err
 }
 
 func (c *syncClientImpl) Close() error {
+	return c.close(c.asyncClient.Close)
+}
+
+func (c *syncClientImpl) CloseWithContext(ctx context.Context) error {
+	return c.close(func() error {
+		return c.asyncClient.CloseWithContext(ctx)
+	})
+}
+
+func (c *syncClientImpl) close(closeAsyncClient func() error) error {
 	c.Lock()
 	defer c.Unlock()
 
+	if c.onClose != nil {
+		c.onClose()
+	}
+
 	var err error
 	if c.cacheManager != nil {
 		err = c.cacheManager.Close()
 	}
-	return multierr.Combine(err, c.asyncClient.Close())
+	return multierr.Combine(err, closeAsyncClient())
 }
 
 func (c *syncClientImpl) Put(ctx context.Context, key string, value []byte, options ...PutOption) (string, Version, error) {
+	// Copy the options, to leave the slice of the caller untouched
+	options = append(options[:len(options):len(options)], WithContext(ctx))
 	select {
 	case r := <-c.asyncClient.Put(key, value, options...):
 		return r.Key, r.Version, r.Err
@@ -88,6 +131,8 @@ func (c *syncClientImpl) Put(ctx context.Context, key string, value []byte, opti
 }
 
 func (c *syncClientImpl) Delete(ctx context.Context, key string, options ...DeleteOption) error {
+	// Copy the options, to leave the slice of the caller untouched
+	options = append(options[:len(options):len(options)], WithContext(ctx))
 	select {
 	case err := <-c.asyncClient.Delete(key, options...):
 		return err
@@ -97,6 +142,8 @@ func (c *syncClientImpl) Delete(ctx context.Context, key string, options ...Dele
 }
 
 func (c *syncClientImpl) DeleteRange(ctx context.Context, minKeyInclusive string, maxKeyExclusive string, options ...DeleteRangeOption) error {
+	// Copy the options, to leave the slice of the caller untouched
+	options = append(options[:len(options):len(options)], WithContext(ctx))
 	select {
 	case err := <-c.asyncClient.DeleteRange(minKeyInclusive, maxKeyExclusive, options...):
 		return err
@@ -106,6 +153,8 @@ func (c *syncClientImpl) DeleteRange(ctx context.Context, minKeyInclusive string
 }
 
 func (c *syncClientImpl) Get(ctx context.Context, key string, options ...GetOption) (string, []byte, Version, error) {
+	// Copy the options, to leave the slice of the caller untouched
+	options = append(options[:len(options):len(options)], WithContext(ctx))
 	select {
 	case r := <-c.asyncClient.Get(key, options...):
 		return r.Key, r.Value, r.Version, r.Err
@@ -137,6 +186,18 @@ func (c *syncClientImpl) GetSequenceUpdates(ctx context.Context, prefixKey strin
 	return c.asyncClient.GetSequenceUpdates(ctx, prefixKey, options...)
 }
 
-func (c *syncClientImpl) GetNotifications() (Notifications, error) {
-	return c.asyncClient.GetNotifications()
+func (c *syncClientImpl) GetNotifications(options ...NotificationsOption) (Notifications, error) {
+	return c.asyncClient.GetNotifications(options...)
+}
+
+func (c *syncClientImpl) GrantLease(ctx context.Context, ttl time.Duration) (Lease, error) {
+	return c.asyncClient.GrantLease(ctx, ttl)
+}
+
+func (c *syncClientImpl) Topology() Topology {
+	return c.asyncClient.Topology()
+}
+
+func (c *syncClientImpl) TopologyEvents(ctx context.Context) <-chan TopologyEvent {
+	return c.asyncClient.TopologyEvents(ctx)
 }
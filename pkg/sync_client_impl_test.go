@@ -34,6 +34,10 @@ type neverCompleteAsyncClient struct {
 
 func (c *neverCompleteAsyncClient) Close() error { return nil }
 
+func (c *neverCompleteAsyncClient) CloseWithContext(context.Context) error { return nil }
+
+func (c *neverCompleteAsyncClient) Flush(context.Context) error { return nil }
+
 func (c *neverCompleteAsyncClient) Put(key string, value []byte, options ...PutOption) <-chan PutResult {
 	return make(chan PutResult)
 }
@@ -58,7 +62,7 @@ func (c *neverCompleteAsyncClient) RangeScan(ctx context.Context, minKeyInclusiv
 	panic("not implemented")
 }
 
-func (c *neverCompleteAsyncClient) GetNotifications() (Notifications, error) {
+func (c *neverCompleteAsyncClient) GetNotifications(options ...NotificationsOption) (Notifications, error) {
 	panic("not implemented")
 }
 
@@ -66,6 +70,18 @@ func (c *neverCompleteAsyncClient) GetSequenceUpdates(ctx context.Context, prefi
 	panic("not implemented")
 }
 
+func (c *neverCompleteAsyncClient) GrantLease(ctx context.Context, ttl time.Duration) (Lease, error) {
+	panic("not implemented")
+}
+
+func (c *neverCompleteAsyncClient) Topology() Topology {
+	panic("not implemented")
+}
+
+func (c *neverCompleteAsyncClient) TopologyEvents(ctx context.Context) <-chan TopologyEvent {
+	panic("not implemented")
+}
+
 func TestCancelContext(t *testing.T) {
 	_asyncClient := &neverCompleteAsyncClient{}
 	syncClient := newSyncClient(_asyncClient)
@@ -0,0 +1,127 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"context"
+	"sync"
+
+	"github.com/oxia-db/oxia/common/process"
+
+	"github.com/oxia-db/oxia-client-golang/internal"
+)
+
+// Topology is a snapshot of the shards of the namespace, with their hash
+// ranges and leaders.
+type Topology struct {
+	// Shards sorted by hash range
+	Shards []Shard
+}
+
+// TopologyEvent describes how the topology has changed after the client has
+// received new shard assignments: shards that were added or removed, eg: by a
+// split, and shards whose leader has moved.
+type TopologyEvent = internal.ShardAssignmentsUpdate
+
+// LeaderChange describes a shard whose leader has moved to a different node.
+type LeaderChange = internal.LeaderChange
+
+func (c *clientImpl) Topology() Topology {
+	return Topology{Shards: c.shardManager.GetShards()}
+}
+
+func (c *clientImpl) TopologyEvents(ctx context.Context) <-chan TopologyEvent {
+	te := &topologyEvents{
+		ch:     make(chan TopologyEvent),
+		signal: make(chan struct{}, 1),
+	}
+	removeListener := c.shardManager.AddListener(te.enqueue)
+
+	go process.DoWithLabels(
+		ctx,
+		map[string]string{
+			"oxia": "topology-events",
+		},
+		func() {
+			te.run(ctx, c.ctx)
+			removeListener()
+			close(te.ch)
+		},
+	)
+	return te.ch
+}
+
+// The number of topology events that are queued for a subscriber. The events
+// beyond it are merged into the last queued one.
+const maxPendingTopologyEvents = 16
+
+// Forwards the updates of the shard assignments to a subscriber. The updates
+// are queued, so that a slow subscriber never blocks the shard manager.
+type topologyEvents struct {
+	sync.Mutex
+	pending []TopologyEvent
+	signal  chan struct{}
+	ch      chan TopologyEvent
+}
+
+func (te *topologyEvents) enqueue(event TopologyEvent) {
+	te.Lock()
+	if last := len(te.pending) - 1; last >= maxPendingTopologyEvents-1 {
+		merged := te.pending[last].Merge(event)
+		if merged.IsEmpty() {
+			te.pending = te.pending[:last]
+		} else {
+			te.pending[last] = merged
+		}
+	} else {
+		te.pending = append(te.pending, event)
+	}
+	te.Unlock()
+
+	select {
+	case te.signal <- struct{}{}:
+	default:
+	}
+}
+
+func (te *topologyEvents) take() []TopologyEvent {
+	te.Lock()
+	defer te.Unlock()
+	events := te.pending
+	te.pending = nil
+	return events
+}
+
+func (te *topologyEvents) run(ctx context.Context, clientCtx context.Context) {
+	for {
+		for _, event := range te.take() {
+			select {
+			case te.ch <- event:
+			case <-ctx.Done():
+				return
+			case <-clientCtx.Done():
+				return
+			}
+		}
+
+		select {
+		case <-te.signal:
+		case <-ctx.Done():
+			return
+		case <-clientCtx.Done():
+			return
+		}
+	}
+}
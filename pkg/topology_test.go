@@ -0,0 +1,113 @@
+// Copyright 2023-2025 The Oxia Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package oxia
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/oxia-db/oxia/node"
+)
+
+func TestTopology(t *testing.T) {
+	config := node.NewTestConfig(t.TempDir())
+	config.NumShards = 2
+	standaloneServer, err := node.NewStandalone(config)
+	assert.NoError(t, err)
+	defer standaloneServer.Close()
+
+	client, err := NewSyncClient(standaloneServer.ServiceAddr())
+	assert.NoError(t, err)
+	defer client.Close()
+
+	topology := client.Topology()
+	assert.Len(t, topology.Shards, 2)
+	assert.EqualValues(t, 0, topology.Shards[0].HashRange.MinInclusive)
+	assert.Equal(t, topology.Shards[0].HashRange.MaxInclusive+1, topology.Shards[1].HashRange.MinInclusive)
+	assert.EqualValues(t, math.MaxUint32, topology.Shards[1].HashRange.MaxInclusive)
+	for _, shard := range topology.Shards {
+		assert.NotEmpty(t, shard.Leader)
+	}
+
+	// The channel is closed once the subscription is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := client.TopologyEvents(ctx)
+	cancel()
+	assert.Eventually(t, func() bool {
+		_, ok := <-ch
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestTopologyEvents_SlowSubscriber(t *testing.T) {
+	te := &topologyEvents{
+		ch:     make(chan TopologyEvent),
+		signal: make(chan struct{}, 1),
+	}
+
+	// Enqueuing never blocks, even if nobody is receiving
+	for i := 0; i < 10; i++ {
+		te.enqueue(TopologyEvent{LeaderChanges: []LeaderChange{{
+			Shard:          Shard{Id: int64(i), Leader: "l2"},
+			PreviousLeader: "l1",
+		}}})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		te.run(ctx, context.Background())
+		close(done)
+	}()
+
+	for i := 0; i < 10; i++ {
+		event := <-te.ch
+		assert.EqualValues(t, i, event.LeaderChanges[0].Shard.Id)
+	}
+
+	te.enqueue(TopologyEvent{Removed: []Shard{{Id: 10}}})
+	event := <-te.ch
+	assert.EqualValues(t, 10, event.Removed[0].Id)
+
+	cancel()
+	<-done
+}
+
+func TestTopologyEvents_Bounded(t *testing.T) {
+	te := &topologyEvents{
+		ch:     make(chan TopologyEvent),
+		signal: make(chan struct{}, 1),
+	}
+
+	// The events beyond the limit are merged into the last queued one
+	for i := 0; i < maxPendingTopologyEvents+4; i++ {
+		te.enqueue(TopologyEvent{LeaderChanges: []LeaderChange{{
+			Shard:          Shard{Id: int64(i), Leader: "l2"},
+			PreviousLeader: "l1",
+		}}})
+	}
+	assert.Len(t, te.pending, maxPendingTopologyEvents)
+	assert.Len(t, te.pending[maxPendingTopologyEvents-1].LeaderChanges, 5)
+
+	// The changes that cancel each other out are left out
+	te.enqueue(TopologyEvent{Added: []Shard{{Id: 100}}})
+	te.enqueue(TopologyEvent{Removed: []Shard{{Id: 100}}})
+	assert.Len(t, te.pending, maxPendingTopologyEvents)
+	assert.Len(t, te.pending[maxPendingTopologyEvents-1].LeaderChanges, 5)
+}